@@ -1,13 +1,20 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"log"
 	"net/http"
+	"time"
 
+	"github.com/bit2swaz/junto/internal/auth"
 	"github.com/bit2swaz/junto/internal/database"
 	"github.com/bit2swaz/junto/internal/handlers"
+	"github.com/bit2swaz/junto/internal/jobs"
+	"github.com/bit2swaz/junto/internal/mailer"
 	"github.com/bit2swaz/junto/internal/middleware"
+	"github.com/bit2swaz/junto/internal/oidc"
+	"github.com/bit2swaz/junto/internal/problem"
 	"github.com/bit2swaz/junto/internal/websocket"
 	"github.com/go-chi/chi/v5"
 	chiMiddleware "github.com/go-chi/chi/v5/middleware"
@@ -21,38 +28,135 @@ func main() {
 	}
 	defer db.Close()
 
-	authHandler := &handlers.AuthHandler{DB: db}
-	coupleHandler := &handlers.CoupleHandler{DB: db}
+	keys, err := auth.NewKeyManager(context.Background(), db)
+	if err != nil {
+		log.Fatal(err)
+	}
+	go keys.Start(context.Background())
+
+	passwordPolicy, err := auth.LoadPasswordPolicy()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	hub := websocket.NewHub(db, keys)
+	authHandler := &handlers.AuthHandler{
+		DB:             db,
+		Mailer:         mailer.NewFromEnv(),
+		Keys:           keys,
+		Providers:      oidc.ProvidersFromEnv(),
+		Hub:            hub,
+		PasswordPolicy: passwordPolicy,
+	}
+	jwksHandler := &handlers.JWKSHandler{Keys: keys}
+	accountHandler := &handlers.AccountHandler{DB: db, Mailer: authHandler.Mailer}
 	vaultHandler := &handlers.VaultHandler{DB: db}
-	hub := websocket.NewHub(db)
+	coupleHandler := &handlers.CoupleHandler{DB: db, Hub: hub}
+	deletionJob := &jobs.AccountDeletion{DB: db, Hub: hub, Interval: time.Hour}
+	go deletionJob.Run(context.Background())
+	unlinkJob := &jobs.CoupleUnlink{DB: db, Hub: hub, Mailer: authHandler.Mailer, Interval: 15 * time.Minute}
+	go unlinkJob.Run(context.Background())
+	sessionHandler := &handlers.SessionHandler{DB: db, Hub: hub}
+	roomHandler := &handlers.RoomHandler{DB: db, Hub: hub}
+	tokenHandler := &handlers.TokenHandler{DB: db}
+	adminHandler := &handlers.AdminHandler{DB: db, Hub: hub}
+	profileHandler := &handlers.ProfileHandler{DB: db, Hub: hub}
 
 	r := chi.NewRouter()
 	r.Use(chiMiddleware.Logger)
 	r.Use(cors.Handler(cors.Options{
 		AllowedOrigins:   []string{"http://localhost:3000"},
-		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token"},
-		ExposedHeaders:   []string{"Link"},
+		AllowedMethods:   []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
+		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "If-Match", "X-CSRF-Token"},
+		ExposedHeaders:   []string{"ETag", "Link"},
 		AllowCredentials: true,
 		MaxAge:           300,
 	}))
 
+	r.NotFound(func(w http.ResponseWriter, r *http.Request) {
+		problem.Write(w, problem.CodeNotFound, "")
+	})
+
 	r.Get("/health", func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
 	})
 
+	r.Get("/.well-known/jwks.json", jwksHandler.ServeJWKS)
+
 	r.Post("/register", authHandler.Register)
 	r.Post("/login", authHandler.Login)
+	r.Post("/login/mfa/totp", authHandler.LoginTOTP)
+	r.Post("/login/mfa/recovery", authHandler.LoginRecoveryCode)
+	r.Post("/refresh", authHandler.Refresh)
+	r.Post("/auth/oidc/{provider}/start", authHandler.StartOIDC)
+	r.Post("/auth/oidc/{provider}/callback", authHandler.OIDCCallback)
+	r.Post("/password-reset/request", authHandler.RequestPasswordReset)
+	r.Post("/password-reset/confirm", authHandler.ConfirmPasswordReset)
+	// Authenticated by a ticket from /ws/ticket rather than a bearer token
+	r.Get("/ws", hub.HandleWebSocket)
+	r.Post("/verify-email", authHandler.VerifyEmail)
 
 	r.Group(func(r chi.Router) {
-		r.Use(middleware.AuthMiddleware)
-		r.Get("/me", authHandler.Me)
-		r.Post("/couples/code", coupleHandler.GeneratePairingCode)
-		r.Post("/couples/link", coupleHandler.LinkPartner)
+		r.Use(middleware.AuthMiddleware(db, keys))
+		// Personal access tokens reach only these routes, and only with
+		// the scope each handler asks for.
 		r.Post("/vault", vaultHandler.AddToVault)
 		r.Get("/vault", vaultHandler.GetVaultItems)
-		r.Get("/ws", hub.HandleWebSocket)
+		r.Get("/vault/archive", vaultHandler.GetArchivedVaultItems)
+		r.Post("/room/touch", roomHandler.Touch)
+
+		r.Group(func(r chi.Router) {
+			r.Use(middleware.RequireSession)
+			r.Get("/me", authHandler.Me)
+			r.Delete("/me", accountHandler.DeleteAccount)
+			r.Post("/me/deletion/cancel", accountHandler.CancelDeletion)
+			r.Get("/me/export", accountHandler.ExportData)
+			r.Get("/me/security-events", accountHandler.SecurityEvents)
+			r.Get("/me/profile", profileHandler.GetProfile)
+			r.Patch("/me/profile", profileHandler.UpdateProfile)
+			r.Get("/users/{id}/avatar.svg", profileHandler.AvatarSVG)
+			r.Get("/users/{id}/avatar.png", profileHandler.AvatarPNG)
+			r.Post("/logout", authHandler.Logout)
+			r.Post("/logout-all", authHandler.LogoutAll)
+			r.Get("/me/sessions", sessionHandler.ListSessions)
+			r.Delete("/me/sessions/{id}", sessionHandler.RevokeSession)
+			r.Post("/me/tokens", tokenHandler.CreateToken)
+			r.Get("/me/tokens", tokenHandler.ListTokens)
+			r.Delete("/me/tokens/{id}", tokenHandler.DeleteToken)
+			r.Post("/verify-email/resend", authHandler.ResendVerification)
+			r.Post("/me/mfa/totp", authHandler.EnrollTOTP)
+			r.Post("/me/mfa/totp/verify", authHandler.ConfirmTOTP)
+			r.Delete("/me/mfa/totp", authHandler.DisableTOTP)
+			r.Group(func(r chi.Router) {
+				r.Use(middleware.RequireVerifiedEmail(db))
+				r.Post("/couples/code", coupleHandler.GeneratePairingCode)
+				r.Get("/couples/invite", coupleHandler.GetPairingInvite)
+				r.Get("/couples/invite/qr.png", coupleHandler.PairingInviteQRPNG)
+				r.Get("/couples/invite/qr.svg", coupleHandler.PairingInviteQRSVG)
+				r.Post("/couples/link", coupleHandler.LinkPartner)
+				r.Get("/couples/requests", coupleHandler.ListPairingRequests)
+				r.Post("/couples/requests/{id}/accept", coupleHandler.AcceptPairingRequest)
+				r.Post("/couples/requests/{id}/reject", coupleHandler.RejectPairingRequest)
+			})
+			r.Post("/couples/unlink", coupleHandler.RequestUnlink)
+			r.Get("/couples/unlink", coupleHandler.GetUnlink)
+			r.Post("/couples/unlink/cancel", coupleHandler.CancelUnlink)
+			r.Post("/couples/leave", coupleHandler.LeaveCouple)
+			r.Get("/couples/profile", coupleHandler.GetCoupleProfile)
+			r.Patch("/couples/profile", coupleHandler.UpdateCoupleProfile)
+			r.Post("/ws/ticket", hub.IssueTicket)
+			r.Route("/admin", func(r chi.Router) {
+				r.Use(middleware.RequireAdmin(db))
+				r.Get("/users", adminHandler.SearchUsers)
+				r.Post("/users/{id}/disable", adminHandler.DisableUser)
+				r.Post("/users/{id}/enable", adminHandler.EnableUser)
+				r.Get("/couples/{id}", adminHandler.GetCouple)
+				r.Post("/couples/{id}/unlink", adminHandler.UnlinkCouple)
+				r.Get("/hub", adminHandler.HubState)
+				r.Get("/audit", adminHandler.AuditLog)
+			})
+		})
 	})
 
 	log.Println("Starting server on :8080")
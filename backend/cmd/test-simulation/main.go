@@ -8,8 +8,13 @@ import (
 	"io"
 	"log"
 	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
 	"time"
 
+	"github.com/bit2swaz/junto/internal/mailer"
 	"github.com/coder/websocket"
 	"github.com/coder/websocket/wsjson"
 )
@@ -20,25 +25,26 @@ const wsURL = "ws://localhost:8080/ws"
 func main() {
 	// 1. Setup Users and Link them
 	fmt.Println("Setting up users...")
-	tokenA := setupUserAndGetToken("sim_user_a@junto.app", "password")
-	tokenB := setupUserAndGetToken("sim_user_b@junto.app", "password")
+	tokenA := setupUserAndGetToken("sim_user_a@junto.app", "sim-password-a")
+	tokenB := setupUserAndGetToken("sim_user_b@junto.app", "sim-password-b")
 
 	code := getPairingCode(tokenA)
-	linkPartner(tokenB, code)
+	request := linkPartner(tokenB, code)
+	acceptPairingRequest(tokenA, int64(request["id"].(float64)))
 	fmt.Println("Users linked.")
 
 	// 2. Connect Client A
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	connA, _, err := websocket.Dial(ctx, fmt.Sprintf("%s?token=%s", wsURL, tokenA), nil)
+	connA, _, err := websocket.Dial(ctx, fmt.Sprintf("%s?ticket=%s", wsURL, getWSTicket(tokenA)), nil)
 	if err != nil {
 		log.Fatalf("Client A failed to connect: %v", err)
 	}
 	defer connA.Close(websocket.StatusNormalClosure, "")
 
 	// 3. Connect Client B
-	connB, _, err := websocket.Dial(ctx, fmt.Sprintf("%s?token=%s", wsURL, tokenB), nil)
+	connB, _, err := websocket.Dial(ctx, fmt.Sprintf("%s?ticket=%s", wsURL, getWSTicket(tokenB)), nil)
 	if err != nil {
 		log.Fatalf("Client B failed to connect: %v", err)
 	}
@@ -104,7 +110,61 @@ func setupUserAndGetToken(email, password string) string {
 	postJSON("/register", map[string]string{"email": email, "password": password})
 	// Login
 	resp := postJSON("/login", map[string]string{"email": email, "password": password})
-	return resp["token"].(string)
+	token := resp["token"].(string)
+
+	// Only verified users can pair
+	me := doRequest("GET", "/me", nil, token)
+	if me["email_verified_at"] == nil {
+		verifyEmail(email, token)
+	}
+	return token
+}
+
+// verifyEmail asks for a fresh verification email and follows its link. The
+// server has to be writing mail to MAIL_OUTBOX_DIR, and this has to be run
+// with the same MAIL_OUTBOX_DIR.
+func verifyEmail(email, token string) {
+	dir := os.Getenv("MAIL_OUTBOX_DIR")
+	if dir == "" {
+		log.Fatal("Set MAIL_OUTBOX_DIR to the server's mail outbox so the users can be verified")
+	}
+
+	postJSONWithAuth("/verify-email/resend", nil, token)
+	msg, ok := lastMail(dir, email)
+	if !ok {
+		log.Fatalf("No verification email for %s in %s", email, dir)
+	}
+	match := verifyLinkPattern.FindStringSubmatch(msg.Body)
+	if match == nil {
+		log.Fatalf("No verification link in the last email to %s", email)
+	}
+	verifyToken, err := url.QueryUnescape(match[1])
+	if err != nil {
+		log.Fatalf("Bad verification link: %v", err)
+	}
+	postJSON("/verify-email", map[string]string{"token": verifyToken})
+}
+
+var verifyLinkPattern = regexp.MustCompile(`/verify-email\?token=(\S+)`)
+
+// lastMail finds the newest message to the given address in an outbox
+// directory. The outbox names its files so they sort in the order sent.
+func lastMail(dir, to string) (mailer.Message, bool) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		log.Fatalf("Reading mail outbox: %v", err)
+	}
+	for i := len(entries) - 1; i >= 0; i-- {
+		data, err := os.ReadFile(filepath.Join(dir, entries[i].Name()))
+		if err != nil {
+			continue
+		}
+		var msg mailer.Message
+		if json.Unmarshal(data, &msg) == nil && msg.To == to {
+			return msg, true
+		}
+	}
+	return mailer.Message{}, false
 }
 
 func getPairingCode(token string) string {
@@ -112,8 +172,17 @@ func getPairingCode(token string) string {
 	return resp["code"].(string)
 }
 
-func linkPartner(token, code string) {
-	postJSONWithAuth("/couples/link", map[string]string{"code": code}, token)
+func getWSTicket(token string) string {
+	resp := postJSONWithAuth("/ws/ticket", nil, token)
+	return resp["ticket"].(string)
+}
+
+func linkPartner(token, code string) map[string]interface{} {
+	return postJSONWithAuth("/couples/link", map[string]string{"code": code}, token)
+}
+
+func acceptPairingRequest(token string, id int64) {
+	postJSONWithAuth(fmt.Sprintf("/couples/requests/%d/accept", id), nil, token)
 }
 
 func postJSON(path string, body interface{}) map[string]interface{} {
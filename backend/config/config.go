@@ -0,0 +1,10 @@
+// Package config holds data files compiled into the server, so it finds
+// them wherever it is run from.
+package config
+
+import _ "embed"
+
+// CommonPasswords is the default password blocklist, one per line.
+//
+//go:embed common-passwords.txt
+var CommonPasswords string
@@ -0,0 +1,74 @@
+package auth
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// encryptionKey returns the 32-byte key used for secrets at rest (TOTP
+// secrets, signing keys), base64-encoded in ENCRYPTION_KEY. Deployments from
+// before signing keys were encrypted set MFA_ENCRYPTION_KEY instead, which
+// is still read when ENCRYPTION_KEY is unset. Generate one with
+// `openssl rand -base64 32`.
+func encryptionKey() ([]byte, error) {
+	name := "ENCRYPTION_KEY"
+	encoded := os.Getenv(name)
+	if encoded == "" {
+		name = "MFA_ENCRYPTION_KEY"
+		encoded = os.Getenv(name)
+	}
+	if encoded == "" {
+		return nil, errors.New("ENCRYPTION_KEY is not set")
+	}
+	key, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: %v", name, err)
+	}
+	if len(key) != 32 {
+		return nil, fmt.Errorf("%s must be 32 bytes", name)
+	}
+	return key, nil
+}
+
+// EncryptSecret seals plaintext with AES-256-GCM. The nonce is prepended to
+// the returned ciphertext.
+func EncryptSecret(plaintext []byte) ([]byte, error) {
+	gcm, err := newGCM()
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return gcm.Seal(nonce, nonce, plaintext, nil), nil
+}
+
+func DecryptSecret(ciphertext []byte) ([]byte, error) {
+	gcm, err := newGCM()
+	if err != nil {
+		return nil, err
+	}
+	if len(ciphertext) < gcm.NonceSize() {
+		return nil, errors.New("ciphertext too short")
+	}
+	nonce, sealed := ciphertext[:gcm.NonceSize()], ciphertext[gcm.NonceSize():]
+	return gcm.Open(nil, nonce, sealed, nil)
+}
+
+func newGCM() (cipher.AEAD, error) {
+	key, err := encryptionKey()
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,350 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/bit2swaz/junto/internal/database"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+const (
+	AlgEdDSA = "EdDSA"
+	AlgES256 = "ES256"
+
+	DefaultKeyRotation = 30 * 24 * time.Hour
+	// keyPrepublish is how long a new key sits in the JWKS before it signs
+	// anything, so other services have time to fetch it.
+	keyPrepublish = time.Hour
+	// keyReloadInterval bounds how stale one instance's view of keys
+	// created by another instance can be.
+	keyReloadInterval = time.Minute
+)
+
+var ErrNoSigningKey = errors.New("no active signing key")
+
+type signingKey struct {
+	id          string
+	alg         string
+	private     crypto.Signer
+	public      crypto.PublicKey
+	activatesAt time.Time
+	expiresAt   time.Time
+}
+
+// KeyManager owns the asymmetric keys used to sign and verify Junto JWTs.
+// Keys live in the database so every API instance shares them; the newest
+// active key signs, and every unexpired key verifies.
+type KeyManager struct {
+	db       database.Service
+	alg      string
+	rotation time.Duration
+
+	mu         sync.RWMutex
+	keys       []*signingKey // newest activation first
+	lastReload time.Time
+}
+
+// NewKeyManager reads JWT_SIGNING_ALG (EdDSA or ES256, default EdDSA) and
+// JWT_KEY_ROTATION (a Go duration, default 30 days) and loads the keys,
+// creating the first one if none exist. It fails if the key the private
+// keys are encrypted with is missing or invalid (see encryptionKey).
+func NewKeyManager(ctx context.Context, db database.Service) (*KeyManager, error) {
+	if _, err := encryptionKey(); err != nil {
+		return nil, err
+	}
+
+	alg := os.Getenv("JWT_SIGNING_ALG")
+	if alg == "" {
+		alg = AlgEdDSA
+	}
+	if alg != AlgEdDSA && alg != AlgES256 {
+		return nil, fmt.Errorf("unsupported JWT_SIGNING_ALG %q", alg)
+	}
+
+	rotation := DefaultKeyRotation
+	if v := os.Getenv("JWT_KEY_ROTATION"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid JWT_KEY_ROTATION: %v", err)
+		}
+		if d <= 2*keyPrepublish {
+			return nil, fmt.Errorf("JWT_KEY_ROTATION must be longer than %v", 2*keyPrepublish)
+		}
+		rotation = d
+	}
+
+	km := &KeyManager{db: db, alg: alg, rotation: rotation}
+	if err := km.Rotate(ctx); err != nil {
+		return nil, err
+	}
+	return km, nil
+}
+
+// Start runs scheduled rotation until ctx is cancelled.
+func (km *KeyManager) Start(ctx context.Context) {
+	ticker := time.NewTicker(keyReloadInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := km.Rotate(ctx); err != nil {
+				log.Printf("signing key rotation failed: %v", err)
+			}
+		}
+	}
+}
+
+// Rotate reloads keys and creates the next one once the current signing key
+// is close to the end of its rotation period.
+func (km *KeyManager) Rotate(ctx context.Context) error {
+	if err := km.reload(ctx); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	km.mu.RLock()
+	var newest *signingKey
+	if len(km.keys) > 0 {
+		newest = km.keys[0]
+	}
+	km.mu.RUnlock()
+
+	switch {
+	case newest == nil:
+		return km.createKey(ctx, now, time.Time{})
+	case newest.activatesAt.After(now):
+		// Next key already published, waiting for activation
+		return nil
+	case now.Sub(newest.activatesAt) >= km.rotation-keyPrepublish:
+		return km.createKey(ctx, newest.activatesAt.Add(km.rotation), newest.activatesAt)
+	}
+	return nil
+}
+
+// createKey creates a key activating at activatesAt to follow the one
+// activating at after. Instances that reach this at the same time are
+// serialized by the database, and all but the first leave it be.
+func (km *KeyManager) createKey(ctx context.Context, activatesAt, after time.Time) error {
+	var private crypto.Signer
+	switch km.alg {
+	case AlgES256:
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			return err
+		}
+		private = key
+	default:
+		_, key, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return err
+		}
+		private = key
+	}
+
+	privateDER, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		return err
+	}
+	publicDER, err := x509.MarshalPKIXPublicKey(private.Public())
+	if err != nil {
+		return err
+	}
+	encrypted, err := EncryptSecret(privateDER)
+	if err != nil {
+		return err
+	}
+
+	// Keep verifying for one more period so tokens signed at the very end
+	// of this key's life, and their refreshes, stay valid.
+	_, err = km.db.CreateSigningKey(ctx, &database.SigningKey{
+		ID:                  uuid.NewString(),
+		Algorithm:           km.alg,
+		PrivateKeyEncrypted: encrypted,
+		PublicKey:           publicDER,
+		ActivatesAt:         activatesAt,
+		ExpiresAt:           activatesAt.Add(2 * km.rotation),
+	}, after)
+	if err != nil {
+		return err
+	}
+	return km.reload(ctx)
+}
+
+func (km *KeyManager) reload(ctx context.Context) error {
+	rows, err := km.db.ListSigningKeys(ctx)
+	if err != nil {
+		return err
+	}
+
+	keys := make([]*signingKey, 0, len(rows))
+	for _, row := range rows {
+		privateDER, err := DecryptSecret(row.PrivateKeyEncrypted)
+		if err != nil {
+			return fmt.Errorf("decrypting signing key %s: %v", row.ID, err)
+		}
+		parsed, err := x509.ParsePKCS8PrivateKey(privateDER)
+		if err != nil {
+			return fmt.Errorf("parsing signing key %s: %v", row.ID, err)
+		}
+		private, ok := parsed.(crypto.Signer)
+		if !ok {
+			return fmt.Errorf("signing key %s is not a signer", row.ID)
+		}
+		keys = append(keys, &signingKey{
+			id:          row.ID,
+			alg:         row.Algorithm,
+			private:     private,
+			public:      private.Public(),
+			activatesAt: row.ActivatesAt,
+			expiresAt:   row.ExpiresAt,
+		})
+	}
+
+	km.mu.Lock()
+	km.keys = keys
+	km.lastReload = time.Now()
+	km.mu.Unlock()
+	return nil
+}
+
+func (km *KeyManager) currentKey() (*signingKey, error) {
+	now := time.Now()
+	km.mu.RLock()
+	defer km.mu.RUnlock()
+	for _, key := range km.keys {
+		if !key.activatesAt.After(now) && key.expiresAt.After(now) {
+			return key, nil
+		}
+	}
+	return nil, ErrNoSigningKey
+}
+
+// verificationKey finds a key by kid, reloading once if it is unknown in
+// case another instance just created it.
+func (km *KeyManager) verificationKey(kid string) (*signingKey, error) {
+	lookup := func() *signingKey {
+		km.mu.RLock()
+		defer km.mu.RUnlock()
+		for _, key := range km.keys {
+			if key.id == kid && key.expiresAt.After(time.Now()) {
+				return key
+			}
+		}
+		return nil
+	}
+
+	if key := lookup(); key != nil {
+		return key, nil
+	}
+
+	km.mu.RLock()
+	stale := time.Since(km.lastReload) > 5*time.Second
+	km.mu.RUnlock()
+	if stale {
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+		if err := km.reload(ctx); err != nil {
+			return nil, err
+		}
+		if key := lookup(); key != nil {
+			return key, nil
+		}
+	}
+	return nil, ErrInvalidToken
+}
+
+func (km *KeyManager) sign(claims jwt.Claims) (string, error) {
+	key, err := km.currentKey()
+	if err != nil {
+		return "", err
+	}
+
+	token := jwt.NewWithClaims(jwt.GetSigningMethod(key.alg), claims)
+	token.Header["kid"] = key.id
+	return token.SignedString(key.private)
+}
+
+func (km *KeyManager) parse(tokenString string, claims jwt.Claims) error {
+	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		key, err := km.verificationKey(kid)
+		if err != nil {
+			return nil, err
+		}
+		if token.Method.Alg() != key.alg {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+		return key.public, nil
+	}, jwt.WithValidMethods([]string{AlgEdDSA, AlgES256}), jwt.WithIssuer(tokenIssuer))
+	if err != nil || !token.Valid {
+		return ErrInvalidToken
+	}
+	return nil
+}
+
+// JWK is a public key in RFC 7517 form.
+type JWK struct {
+	KeyType   string `json:"kty"`
+	Curve     string `json:"crv"`
+	X         string `json:"x"`
+	Y         string `json:"y,omitempty"`
+	KeyID     string `json:"kid"`
+	Algorithm string `json:"alg"`
+	Use       string `json:"use"`
+}
+
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWKS returns every unexpired public key, including ones published ahead
+// of activation.
+func (km *KeyManager) JWKS() JWKS {
+	km.mu.RLock()
+	defer km.mu.RUnlock()
+
+	set := JWKS{Keys: []JWK{}}
+	now := time.Now()
+	for _, key := range km.keys {
+		if !key.expiresAt.After(now) {
+			continue
+		}
+		jwk := JWK{KeyID: key.id, Algorithm: key.alg, Use: "sig"}
+		switch pub := key.public.(type) {
+		case ed25519.PublicKey:
+			jwk.KeyType = "OKP"
+			jwk.Curve = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(pub)
+		case *ecdsa.PublicKey:
+			point, err := pub.Bytes()
+			if err != nil {
+				continue
+			}
+			// Uncompressed point: 0x04 || X || Y
+			jwk.KeyType = "EC"
+			jwk.Curve = "P-256"
+			jwk.X = base64.RawURLEncoding.EncodeToString(point[1:33])
+			jwk.Y = base64.RawURLEncoding.EncodeToString(point[33:])
+		default:
+			continue
+		}
+		set.Keys = append(set.Keys, jwk)
+	}
+	return set
+}
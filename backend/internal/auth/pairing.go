@@ -0,0 +1,24 @@
+package auth
+
+import (
+	"crypto/rand"
+	"fmt"
+	"math/big"
+)
+
+// NewPairingCode returns a random 6-digit code for people to read out or
+// type in. It is only as strong as its million values, so it is short-lived
+// and redeeming it is rate limited.
+func NewPairingCode() (string, error) {
+	n, err := rand.Int(rand.Reader, big.NewInt(1000000))
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%06d", n.Int64()), nil
+}
+
+// NewPairingToken returns the unguessable half of a pairing invite, used in
+// invite links and QR codes.
+func NewPairingToken() (string, error) {
+	return RandomToken(24)
+}
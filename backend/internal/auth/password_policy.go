@@ -0,0 +1,92 @@
+package auth
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/bit2swaz/junto/config"
+)
+
+const defaultMinPasswordLength = 8
+
+// PasswordPolicy decides which new passwords are acceptable.
+type PasswordPolicy struct {
+	MinLength int
+	blocklist map[string]struct{}
+}
+
+// DefaultPasswordPolicy only enforces the minimum length.
+var DefaultPasswordPolicy = NewPasswordPolicy(defaultMinPasswordLength, nil)
+
+func NewPasswordPolicy(minLength int, blocklist []string) *PasswordPolicy {
+	p := &PasswordPolicy{
+		MinLength: minLength,
+		blocklist: make(map[string]struct{}, len(blocklist)),
+	}
+	for _, pw := range blocklist {
+		p.blocklist[strings.ToLower(pw)] = struct{}{}
+	}
+	return p
+}
+
+// LoadPasswordPolicy reads PASSWORD_MIN_LENGTH and PASSWORD_BLOCKLIST_FILE.
+// The blocklist defaults to config/common-passwords.txt, which is built into
+// the binary.
+func LoadPasswordPolicy() (*PasswordPolicy, error) {
+	minLength := defaultMinPasswordLength
+	if v := os.Getenv("PASSWORD_MIN_LENGTH"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			return nil, fmt.Errorf("invalid PASSWORD_MIN_LENGTH %q", v)
+		}
+		minLength = n
+	}
+
+	var list io.Reader = strings.NewReader(config.CommonPasswords)
+	if path := os.Getenv("PASSWORD_BLOCKLIST_FILE"); path != "" {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, fmt.Errorf("reading PASSWORD_BLOCKLIST_FILE: %v", err)
+		}
+		defer f.Close()
+		list = f
+	}
+	blocklist, err := readBlocklist(list)
+	if err != nil {
+		return nil, err
+	}
+	if len(blocklist) == 0 {
+		return nil, errors.New("password blocklist is empty")
+	}
+	return NewPasswordPolicy(minLength, blocklist), nil
+}
+
+func readBlocklist(r io.Reader) ([]string, error) {
+	var list []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		list = append(list, line)
+	}
+	return list, scanner.Err()
+}
+
+// Check returns a user-facing reason the password is rejected, or nil.
+func (p *PasswordPolicy) Check(password string) error {
+	if utf8.RuneCountInString(password) < p.MinLength {
+		return fmt.Errorf("must be at least %d characters", p.MinLength)
+	}
+	if _, ok := p.blocklist[strings.ToLower(password)]; ok {
+		return fmt.Errorf("is too common")
+	}
+	return nil
+}
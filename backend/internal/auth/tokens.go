@@ -0,0 +1,133 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+const (
+	// AccessTokenTTL is kept short because access tokens are only checked
+	// against the session store, never individually revoked.
+	AccessTokenTTL  = 15 * time.Minute
+	RefreshTokenTTL = 30 * 24 * time.Hour
+	MFATokenTTL     = 5 * time.Minute
+)
+
+const (
+	TokenTypeAccess = "access"
+	// TokenTypeMFA marks a password-verified login that still needs a
+	// second factor. It is only accepted by the MFA login endpoints.
+	TokenTypeMFA = "mfa_pending"
+)
+
+// tokenIssuer is the iss claim other services should expect on Junto tokens.
+const tokenIssuer = "junto"
+
+var ErrInvalidToken = errors.New("invalid token")
+
+type Claims struct {
+	UserID    int64  `json:"user_id"`
+	SessionID string `json:"sid,omitempty"`
+	TokenType string `json:"typ"`
+	jwt.RegisteredClaims
+}
+
+func (km *KeyManager) NewAccessToken(userID int64, sessionID string) (string, time.Time, error) {
+	return km.signToken(Claims{
+		UserID:    userID,
+		SessionID: sessionID,
+		TokenType: TokenTypeAccess,
+	}, AccessTokenTTL)
+}
+
+func (km *KeyManager) ParseAccessToken(tokenString string) (*Claims, error) {
+	claims, err := km.parseToken(tokenString, TokenTypeAccess)
+	if err != nil {
+		return nil, err
+	}
+	if claims.SessionID == "" {
+		return nil, ErrInvalidToken
+	}
+	return claims, nil
+}
+
+func (km *KeyManager) NewMFAToken(userID int64) (string, time.Time, error) {
+	return km.signToken(Claims{
+		UserID:    userID,
+		TokenType: TokenTypeMFA,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID: uuid.NewString(),
+		},
+	}, MFATokenTTL)
+}
+
+func (km *KeyManager) ParseMFAToken(tokenString string) (*Claims, error) {
+	return km.parseToken(tokenString, TokenTypeMFA)
+}
+
+func (km *KeyManager) signToken(claims Claims, ttl time.Duration) (string, time.Time, error) {
+	now := time.Now()
+	expiresAt := now.Add(ttl)
+	claims.Issuer = tokenIssuer
+	claims.Subject = strconv.FormatInt(claims.UserID, 10)
+	claims.ExpiresAt = jwt.NewNumericDate(expiresAt)
+	claims.IssuedAt = jwt.NewNumericDate(now)
+
+	tokenString, err := km.sign(claims)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	return tokenString, expiresAt, nil
+}
+
+func (km *KeyManager) parseToken(tokenString, tokenType string) (*Claims, error) {
+	claims := &Claims{}
+	if err := km.parse(tokenString, claims); err != nil {
+		return nil, err
+	}
+	if claims.UserID == 0 || claims.TokenType != tokenType {
+		return nil, ErrInvalidToken
+	}
+	return claims, nil
+}
+
+// NewRefreshToken returns an opaque "<session>.<secret>" token together with
+// the hash of its secret, which is the only part that gets stored.
+func NewRefreshToken(sessionID string) (token, hash string, err error) {
+	secret, err := RandomToken(32)
+	if err != nil {
+		return "", "", err
+	}
+	return sessionID + "." + secret, HashToken(secret), nil
+}
+
+func ParseRefreshToken(token string) (sessionID, hash string, err error) {
+	sessionID, secret, ok := strings.Cut(token, ".")
+	if !ok || sessionID == "" || secret == "" {
+		return "", "", ErrInvalidToken
+	}
+	return sessionID, HashToken(secret), nil
+}
+
+// RandomToken returns n bytes of crypto/rand output, base64url encoded.
+func RandomToken(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
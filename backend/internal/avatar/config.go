@@ -0,0 +1,115 @@
+// Package avatar defines the avatar_config users store on their profile.
+// Every config names the schema version it follows; Parse accepts any
+// version it knows and returns it upgraded to the current one.
+package avatar
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/bit2swaz/junto/internal/validate"
+)
+
+// CurrentVersion is the schema version of Config.
+const CurrentVersion = 1
+
+// Choices for the fields of Config.
+var (
+	Bodies      = []string{"round", "square", "tall", "bean"}
+	Expressions = []string{"happy", "grin", "calm", "surprised", "sleepy", "wink"}
+	Accessories = []string{"glasses", "hat", "bow", "scarf", "headphones"}
+)
+
+// MaxAccessories caps how many accessories one avatar can wear.
+const MaxAccessories = 3
+
+var colorPattern = regexp.MustCompile(`^#[0-9a-fA-F]{6}$`)
+
+// Config describes an avatar. Colors are #rrggbb.
+type Config struct {
+	Version     int      `json:"version"`
+	Body        string   `json:"body"`
+	Colors      Colors   `json:"colors"`
+	Accessories []string `json:"accessories"`
+	Expression  string   `json:"expression"`
+}
+
+type Colors struct {
+	Body       string `json:"body"`
+	Accent     string `json:"accent"`
+	Background string `json:"background"`
+}
+
+// parsers reads each supported schema version into a current Config,
+// recording what is wrong with it on v.
+var parsers = map[int]func(raw json.RawMessage, v *validate.Validator) *Config{
+	1: parseV1,
+}
+
+// Parse validates raw against the schema version it names. The errors it
+// returns are validate.Errors with fields under "avatar_config".
+func Parse(raw json.RawMessage) (*Config, error) {
+	var v validate.Validator
+	var header struct {
+		Version int `json:"version"`
+	}
+	if !bytes.HasPrefix(bytes.TrimSpace(raw), []byte("{")) || json.Unmarshal(raw, &header) != nil {
+		v.Check(false, "avatar_config", "must be an object")
+		return nil, v.Err()
+	}
+	parse, ok := parsers[header.Version]
+	if !ok {
+		v.Check(false, "avatar_config.version", fmt.Sprintf("must be %d", CurrentVersion))
+		return nil, v.Err()
+	}
+
+	config := parse(raw, &v)
+	if err := v.Err(); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+func parseV1(raw json.RawMessage, v *validate.Validator) *Config {
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.DisallowUnknownFields()
+	var config Config
+	if err := dec.Decode(&config); err != nil {
+		v.Check(false, "avatar_config", "does not match schema version 1: "+err.Error())
+		return nil
+	}
+
+	v.Check(oneOf(config.Body, Bodies), "avatar_config.body", "must be one of "+strings.Join(Bodies, ", "))
+	v.Check(oneOf(config.Expression, Expressions), "avatar_config.expression", "must be one of "+strings.Join(Expressions, ", "))
+	v.Check(colorPattern.MatchString(config.Colors.Body), "avatar_config.colors.body", "must be a color as #rrggbb")
+	v.Check(colorPattern.MatchString(config.Colors.Accent), "avatar_config.colors.accent", "must be a color as #rrggbb")
+	v.Check(colorPattern.MatchString(config.Colors.Background), "avatar_config.colors.background", "must be a color as #rrggbb")
+
+	v.Check(len(config.Accessories) <= MaxAccessories, "avatar_config.accessories", fmt.Sprintf("can hold at most %d", MaxAccessories))
+	seen := make(map[string]bool)
+	for _, a := range config.Accessories {
+		v.Check(oneOf(a, Accessories), "avatar_config.accessories", "must each be one of "+strings.Join(Accessories, ", "))
+		v.Check(!seen[a], "avatar_config.accessories", "must not repeat "+a)
+		seen[a] = true
+	}
+
+	config.Colors.Body = strings.ToLower(config.Colors.Body)
+	config.Colors.Accent = strings.ToLower(config.Colors.Accent)
+	config.Colors.Background = strings.ToLower(config.Colors.Background)
+	if config.Accessories == nil {
+		config.Accessories = []string{}
+	}
+	return &config
+}
+
+func oneOf(s string, choices []string) bool {
+	for _, c := range choices {
+		if s == c {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,152 @@
+package avatar
+
+import (
+	"strconv"
+	"strings"
+
+	"golang.org/x/image/vector"
+)
+
+// kappa places the control points of a cubic Bézier that approximates a
+// quarter of an ellipse.
+const kappa = 0.5522848
+
+// path is a list of closed outlines, filled with the nonzero rule: an
+// outline drawn the other way round cuts a hole in the one around it.
+type path []segment
+
+// segment is a path command: 'M' and 'L' take one point, 'C' three and
+// 'Z' none.
+type segment struct {
+	op  byte
+	pts []float32
+}
+
+func (p path) svg() string {
+	var b strings.Builder
+	for i, s := range p {
+		if i > 0 {
+			b.WriteByte(' ')
+		}
+		b.WriteByte(s.op)
+		for j, v := range s.pts {
+			if j > 0 {
+				b.WriteByte(' ')
+			}
+			b.WriteString(strconv.FormatFloat(float64(v), 'f', -1, 32))
+		}
+	}
+	return b.String()
+}
+
+func (p path) rasterize(z *vector.Rasterizer, scale float32) {
+	for _, s := range p {
+		pts := make([]float32, len(s.pts))
+		for i, v := range s.pts {
+			pts[i] = v * scale
+		}
+		switch s.op {
+		case 'M':
+			z.MoveTo(pts[0], pts[1])
+		case 'L':
+			z.LineTo(pts[0], pts[1])
+		case 'C':
+			z.CubeTo(pts[0], pts[1], pts[2], pts[3], pts[4], pts[5])
+		case 'Z':
+			z.ClosePath()
+		}
+	}
+}
+
+// arc is a quarter-ellipse Bézier from (x0, y0) to (x1, y1) whose
+// corner, where the tangents meet, is (cx, cy).
+func arc(x0, y0, cx, cy, x1, y1 float32) segment {
+	return segment{'C', []float32{
+		x0 + (cx-x0)*kappa, y0 + (cy-y0)*kappa,
+		x1 + (cx-x1)*kappa, y1 + (cy-y1)*kappa,
+		x1, y1,
+	}}
+}
+
+// ellipse is drawn clockwise from its leftmost point.
+func ellipse(cx, cy, rx, ry float32) path {
+	return path{
+		{'M', []float32{cx - rx, cy}},
+		arc(cx-rx, cy, cx-rx, cy-ry, cx, cy-ry),
+		arc(cx, cy-ry, cx+rx, cy-ry, cx+rx, cy),
+		arc(cx+rx, cy, cx+rx, cy+ry, cx, cy+ry),
+		arc(cx, cy+ry, cx-rx, cy+ry, cx-rx, cy),
+		{'Z', nil},
+	}
+}
+
+// ellipseReversed is ellipse drawn anticlockwise, to cut a hole.
+func ellipseReversed(cx, cy, rx, ry float32) path {
+	return path{
+		{'M', []float32{cx - rx, cy}},
+		arc(cx-rx, cy, cx-rx, cy+ry, cx, cy+ry),
+		arc(cx, cy+ry, cx+rx, cy+ry, cx+rx, cy),
+		arc(cx+rx, cy, cx+rx, cy-ry, cx, cy-ry),
+		arc(cx, cy-ry, cx-rx, cy-ry, cx-rx, cy),
+		{'Z', nil},
+	}
+}
+
+// ring is a circle of radius r outlined width thick, inwards.
+func ring(cx, cy, r, width float32) path {
+	return append(ellipse(cx, cy, r, r), ellipseReversed(cx, cy, r-width, r-width)...)
+}
+
+// rect has corners rounded to radius r.
+func rect(x, y, w, h, r float32) path {
+	if r == 0 {
+		return polygon(x, y, x+w, y, x+w, y+h, x, y+h)
+	}
+	return path{
+		{'M', []float32{x + r, y}},
+		{'L', []float32{x + w - r, y}},
+		arc(x+w-r, y, x+w, y, x+w, y+r),
+		{'L', []float32{x + w, y + h - r}},
+		arc(x+w, y+h-r, x+w, y+h, x+w-r, y+h),
+		{'L', []float32{x + r, y + h}},
+		arc(x+r, y+h, x, y+h, x, y+h-r),
+		{'L', []float32{x, y + r}},
+		arc(x, y+r, x, y, x+r, y),
+		{'Z', nil},
+	}
+}
+
+// polygon joins the points given as x, y pairs.
+func polygon(xy ...float32) path {
+	p := path{{'M', xy[:2]}}
+	for i := 2; i+1 < len(xy); i += 2 {
+		p = append(p, segment{'L', xy[i : i+2]})
+	}
+	return append(p, segment{'Z', nil})
+}
+
+// smile is the lower half of an ellipse, flat side up at y.
+func smile(cx, y, rx, ry float32) path {
+	return path{
+		{'M', []float32{cx - rx, y}},
+		{'L', []float32{cx + rx, y}},
+		arc(cx+rx, y, cx+rx, y+ry, cx, y+ry),
+		arc(cx, y+ry, cx-rx, y+ry, cx-rx, y),
+		{'Z', nil},
+	}
+}
+
+// band is the upper half of an ellipse outline width thick, as worn by a
+// headband.
+func band(cx, cy, rx, ry, width float32) path {
+	irx, iry := rx-width, ry-width
+	return path{
+		{'M', []float32{cx - rx, cy}},
+		arc(cx-rx, cy, cx-rx, cy-ry, cx, cy-ry),
+		arc(cx, cy-ry, cx+rx, cy-ry, cx+rx, cy),
+		{'L', []float32{cx + irx, cy}},
+		arc(cx+irx, cy, cx+irx, cy-iry, cx, cy-iry),
+		arc(cx, cy-iry, cx-irx, cy-iry, cx-irx, cy),
+		{'Z', nil},
+	}
+}
@@ -0,0 +1,214 @@
+package avatar
+
+import (
+	"bytes"
+	"fmt"
+	"hash/fnv"
+	"image"
+	"image/color"
+	"image/png"
+	"strconv"
+
+	"golang.org/x/image/vector"
+)
+
+// RenderVersion changes whenever the drawing does, so that anything cached
+// from an older renderer is refetched.
+const RenderVersion = 1
+
+// Bounds on the size of a rendered avatar, in pixels.
+const (
+	MinSize     = 16
+	MaxSize     = 512
+	DefaultSize = 128
+)
+
+// Avatars are drawn in a 100x100 box and scaled to the requested size.
+const box = 100
+
+// ink is the color of the face.
+var ink = color.RGBA{0x2b, 0x2d, 0x42, 0xff}
+
+// frame is where a body's top edge, face and sides are.
+type frame struct {
+	top, face, halfWidth float32
+}
+
+var frames = map[string]frame{
+	"round":  {top: 26, face: 54, halfWidth: 32},
+	"square": {top: 26, face: 54, halfWidth: 32},
+	"tall":   {top: 14, face: 44, halfWidth: 24},
+	"bean":   {top: 32, face: 58, halfWidth: 36},
+}
+
+// Palettes Default picks from.
+var (
+	defaultBodyColors       = []string{"#ffb3c1", "#a0c4ff", "#caffbf", "#ffd6a5", "#bdb2ff", "#9bf6ff"}
+	defaultAccentColors     = []string{"#3a86ff", "#ff006e", "#fb5607", "#8338ec", "#06d6a0"}
+	defaultBackgroundColors = []string{"#fefae0", "#f1faee", "#fdf0f5", "#eef4ff"}
+)
+
+// Default is the avatar of someone who never configured one. It is derived
+// from seed, so each user keeps the same one.
+func Default(seed int64) *Config {
+	h := fnv.New64a()
+	fmt.Fprint(h, seed)
+	n := h.Sum64()
+	pick := func(choices []string) string {
+		c := choices[n%uint64(len(choices))]
+		n /= uint64(len(choices))
+		return c
+	}
+	return &Config{
+		Version: CurrentVersion,
+		Body:    pick(Bodies),
+		Colors: Colors{
+			Body:       pick(defaultBodyColors),
+			Accent:     pick(defaultAccentColors),
+			Background: pick(defaultBackgroundColors),
+		},
+		Accessories: []string{},
+		Expression:  pick(Expressions),
+	}
+}
+
+// SVG draws c as an SVG image size pixels square.
+func SVG(c *Config, size int) []byte {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d">`, size, size, box, box)
+	for _, s := range shapes(c) {
+		fmt.Fprintf(&buf, `<path fill="#%02x%02x%02x" d="%s"/>`, s.fill.R, s.fill.G, s.fill.B, s.path.svg())
+	}
+	buf.WriteString(`</svg>`)
+	return buf.Bytes()
+}
+
+// PNG draws c as a PNG image size pixels square.
+func PNG(c *Config, size int) ([]byte, error) {
+	img := image.NewRGBA(image.Rect(0, 0, size, size))
+	scale := float32(size) / box
+	for _, s := range shapes(c) {
+		z := vector.NewRasterizer(size, size)
+		s.path.rasterize(z, scale)
+		z.Draw(img, img.Bounds(), image.NewUniform(s.fill), image.Point{})
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// shape is one filled path of an avatar, in box coordinates.
+type shape struct {
+	fill color.RGBA
+	path path
+}
+
+// shapes lays out c back to front. Accessories are drawn in a fixed order
+// whatever order the config lists them in.
+func shapes(c *Config) []shape {
+	f, ok := frames[c.Body]
+	if !ok {
+		f = frames["round"]
+	}
+	body, accent := hexColor(c.Colors.Body), hexColor(c.Colors.Accent)
+
+	s := []shape{
+		{hexColor(c.Colors.Background), rect(0, 0, box, box, 0)},
+		{body, bodyPath(c.Body)},
+	}
+	s = append(s, face(c.Expression, f)...)
+
+	worn := make(map[string]bool)
+	for _, a := range c.Accessories {
+		worn[a] = true
+	}
+	if worn["scarf"] {
+		s = append(s,
+			shape{accent, rect(50-f.halfWidth+4, f.face+20, 2*f.halfWidth-8, 8, 4)},
+			shape{accent, rect(50+f.halfWidth-20, f.face+24, 8, 12, 3)},
+		)
+	}
+	if worn["headphones"] {
+		s = append(s,
+			shape{accent, band(50, f.face, f.halfWidth+4, f.halfWidth, 4)},
+			shape{accent, ellipse(50-f.halfWidth-2, f.face, 6, 9)},
+			shape{accent, ellipse(50+f.halfWidth+2, f.face, 6, 9)},
+		)
+	}
+	if worn["glasses"] {
+		s = append(s,
+			shape{accent, ring(40, f.face, 8, 2)},
+			shape{accent, ring(60, f.face, 8, 2)},
+			shape{accent, rect(47, f.face-1, 6, 2, 1)},
+		)
+	}
+	if worn["hat"] {
+		// Shorter on tall bodies so it stays in the picture
+		h := min(20, f.top-2)
+		s = append(s,
+			shape{accent, rect(36, f.top-h, 28, h, 3)},
+			shape{accent, rect(28, f.top-4, 44, 6, 3)},
+		)
+	}
+	if worn["bow"] {
+		x, y := float32(50+f.halfWidth*0.6), f.top+4
+		s = append(s,
+			shape{accent, polygon(x, y, x-9, y-6, x-9, y+6)},
+			shape{accent, polygon(x, y, x+9, y-6, x+9, y+6)},
+			shape{accent, ellipse(x, y, 3, 3)},
+		)
+	}
+	return s
+}
+
+func bodyPath(body string) path {
+	switch body {
+	case "square":
+		return rect(18, 26, 64, 64, 12)
+	case "tall":
+		return rect(26, 14, 48, 80, 24)
+	case "bean":
+		return ellipse(50, 61, 36, 29)
+	default:
+		return ellipse(50, 58, 32, 32)
+	}
+}
+
+// face draws the eyes and mouth for expression around f.face.
+func face(expression string, f frame) []shape {
+	y := f.face
+	dot := func(x float32) shape { return shape{ink, ellipse(x, y, 4, 4)} }
+	shut := func(x float32) shape { return shape{ink, rect(x-5, y-1, 10, 2.5, 1.25)} }
+	mouth := shape{ink, smile(50, y+10, 8, 5)}
+
+	switch expression {
+	case "grin":
+		return []shape{dot(40), dot(60), {ink, smile(50, y+9, 11, 8)}}
+	case "calm":
+		return []shape{dot(40), dot(60), {ink, rect(44, y+11, 12, 2.5, 1.25)}}
+	case "surprised":
+		return []shape{
+			{ink, ellipse(40, y, 5, 5)},
+			{ink, ellipse(60, y, 5, 5)},
+			{ink, ellipse(50, y+13, 4, 5)},
+		}
+	case "sleepy":
+		return []shape{shut(40), shut(60), {ink, rect(46, y+11, 8, 2.5, 1.25)}}
+	case "wink":
+		return []shape{dot(40), shut(60), mouth}
+	default:
+		return []shape{dot(40), dot(60), mouth}
+	}
+}
+
+// hexColor reads a #rrggbb color, as Parse has checked it is.
+func hexColor(s string) color.RGBA {
+	if len(s) != 7 {
+		return ink
+	}
+	v, _ := strconv.ParseUint(s[1:], 16, 32)
+	return color.RGBA{uint8(v >> 16), uint8(v >> 8), uint8(v), 0xff}
+}
@@ -0,0 +1,104 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+func (s *service) ScheduleUserDeletion(ctx context.Context, userID int64, at time.Time) error {
+	query := `
+		UPDATE users
+		SET deletion_scheduled_at = $2
+		WHERE id = $1
+	`
+	_, err := s.db.Exec(ctx, query, userID, at)
+	return err
+}
+
+func (s *service) CancelUserDeletion(ctx context.Context, userID int64) error {
+	query := `
+		UPDATE users
+		SET deletion_scheduled_at = NULL
+		WHERE id = $1
+	`
+	_, err := s.db.Exec(ctx, query, userID)
+	return err
+}
+
+func (s *service) ListUsersDueForDeletion(ctx context.Context, before time.Time) ([]int64, error) {
+	query := `
+		SELECT id
+		FROM users
+		WHERE deletion_scheduled_at IS NOT NULL AND deletion_scheduled_at <= $1
+		ORDER BY deletion_scheduled_at
+		LIMIT 100
+	`
+	rows, err := s.db.Query(ctx, query, before)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// DeleteUser permanently removes a user and the vault items they wrote. They
+// leave their couple, which is dissolved if fewer than two members remain;
+// the others keep their own items, and an unlink the user asked for is
+// called off. Rows in tables with ON DELETE CASCADE (MFA, identities,
+// memberships) go with the user. It returns the couple they left as it is
+// afterwards, or nil if they were in none.
+func (s *service) DeleteUser(ctx context.Context, userID int64) (*Couple, error) {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, `DELETE FROM vault_items WHERE created_by = $1`, userID); err != nil {
+		return nil, err
+	}
+
+	leaveQuery := `
+		UPDATE couple_members
+		SET left_at = NOW()
+		WHERE user_id = $1 AND left_at IS NULL
+		RETURNING couple_id
+	`
+	var couple *Couple
+	var coupleID int64
+	err = tx.QueryRow(ctx, leaveQuery, userID).Scan(&coupleID)
+	if err != nil && err != pgx.ErrNoRows {
+		return nil, err
+	}
+	if err == nil {
+		if err := cancelUnlinkRequestedBy(ctx, tx, coupleID, userID); err != nil {
+			return nil, err
+		}
+		if err := leftCouple(ctx, tx, coupleID); err != nil {
+			return nil, err
+		}
+		if couple, err = getCouple(ctx, tx, coupleID); err != nil {
+			return nil, err
+		}
+	}
+
+	if _, err := tx.Exec(ctx, `DELETE FROM users WHERE id = $1`, userID); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+	return couple, nil
+}
@@ -0,0 +1,143 @@
+package database
+
+import (
+	"context"
+	"strings"
+	"time"
+)
+
+// AdminAction is one entry in the admin audit log.
+type AdminAction struct {
+	ID             int64                  `json:"id"`
+	AdminID        *int64                 `json:"admin_id"`
+	Action         string                 `json:"action"`
+	TargetUserID   *int64                 `json:"target_user_id,omitempty"`
+	TargetCoupleID *int64                 `json:"target_couple_id,omitempty"`
+	Details        map[string]interface{} `json:"details"`
+	CreatedAt      time.Time              `json:"created_at"`
+}
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// SearchUsers matches query against email substrings and exact user IDs.
+func (s *service) SearchUsers(ctx context.Context, query string, limit int) ([]User, error) {
+	q := `
+		SELECT ` + userColumns + `
+		FROM users
+		WHERE email ILIKE '%' || $1 || '%' OR id::text = $2
+		ORDER BY id
+		LIMIT $3
+	`
+	rows, err := s.db.Query(ctx, q, likeEscaper.Replace(query), query, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var users []User
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, *user)
+	}
+	return users, rows.Err()
+}
+
+// DisableUser marks the account disabled and deletes its personal access
+// tokens. Sessions live in Redis and are revoked separately. It reports
+// false if there is no such user.
+func (s *service) DisableUser(ctx context.Context, userID int64) (bool, error) {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback(ctx)
+
+	query := `
+		UPDATE users
+		SET disabled_at = COALESCE(disabled_at, NOW())
+		WHERE id = $1
+	`
+	tag, err := tx.Exec(ctx, query, userID)
+	if err != nil {
+		return false, err
+	}
+	if tag.RowsAffected() == 0 {
+		return false, nil
+	}
+
+	if _, err := tx.Exec(ctx, `DELETE FROM personal_access_tokens WHERE user_id = $1`, userID); err != nil {
+		return false, err
+	}
+
+	return true, tx.Commit(ctx)
+}
+
+func (s *service) EnableUser(ctx context.Context, userID int64) (bool, error) {
+	query := `
+		UPDATE users
+		SET disabled_at = NULL
+		WHERE id = $1
+	`
+	tag, err := s.db.Exec(ctx, query, userID)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() > 0, nil
+}
+
+// DissolveCouple unlinks both members of a couple at once. The couple row
+// and its vault items are kept, as when a member deletes their account. It
+// reports false if the couple does not exist or was already dissolved.
+func (s *service) DissolveCouple(ctx context.Context, coupleID int64) (bool, error) {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback(ctx)
+
+	dissolved, err := dissolveCouple(ctx, tx, coupleID)
+	if err != nil || !dissolved {
+		return false, err
+	}
+	return true, tx.Commit(ctx)
+}
+
+func (s *service) RecordAdminAction(ctx context.Context, action AdminAction) error {
+	if action.Details == nil {
+		action.Details = map[string]interface{}{}
+	}
+	query := `
+		INSERT INTO admin_audit_log (admin_id, action, target_user_id, target_couple_id, details, created_at)
+		VALUES ($1, $2, $3, $4, $5, NOW())
+	`
+	_, err := s.db.Exec(ctx, query, action.AdminID, action.Action, action.TargetUserID, action.TargetCoupleID, action.Details)
+	return err
+}
+
+// ListAdminActions returns the most recent entries first.
+func (s *service) ListAdminActions(ctx context.Context, limit int) ([]AdminAction, error) {
+	query := `
+		SELECT id, admin_id, action, target_user_id, target_couple_id, details, created_at
+		FROM admin_audit_log
+		ORDER BY id DESC
+		LIMIT $1
+	`
+	rows, err := s.db.Query(ctx, query, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var actions []AdminAction
+	for rows.Next() {
+		var a AdminAction
+		if err := rows.Scan(&a.ID, &a.AdminID, &a.Action, &a.TargetUserID, &a.TargetCoupleID, &a.Details, &a.CreatedAt); err != nil {
+			return nil, err
+		}
+		actions = append(actions, a)
+	}
+	return actions, rows.Err()
+}
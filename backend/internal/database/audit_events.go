@@ -0,0 +1,73 @@
+package database
+
+import (
+	"context"
+	"time"
+)
+
+// Audit event types.
+const (
+	AuditLogin              = "login"
+	AuditLoginFailed        = "login_failed"
+	AuditLogout             = "logout"
+	AuditLogoutAll          = "logout_all"
+	AuditPairingCodeCreated = "pairing_code_created"
+	AuditPairingRequested   = "pairing_requested"
+	AuditPairingRejected    = "pairing_rejected"
+	AuditCoupleLinked       = "couple_linked"
+	AuditVaultItemCreated   = "vault_item_created"
+	AuditUnlinkRequested    = "unlink_requested"
+	AuditUnlinkCancelled    = "unlink_cancelled"
+	AuditCoupleUnlinked     = "couple_unlinked"
+	AuditCoupleLeft         = "couple_left"
+)
+
+// AuditEvent is one entry in a user's security history.
+type AuditEvent struct {
+	ID        int64                  `json:"id"`
+	UserID    int64                  `json:"user_id"`
+	Type      string                 `json:"type"`
+	IP        string                 `json:"ip"`
+	UserAgent string                 `json:"user_agent"`
+	Metadata  map[string]interface{} `json:"metadata"`
+	CreatedAt time.Time              `json:"created_at"`
+}
+
+func (s *service) RecordAuditEvent(ctx context.Context, event AuditEvent) error {
+	if event.Metadata == nil {
+		event.Metadata = map[string]interface{}{}
+	}
+	query := `
+		INSERT INTO audit_events (user_id, event_type, ip, user_agent, metadata, created_at)
+		VALUES ($1, $2, $3, $4, $5, NOW())
+	`
+	_, err := s.db.Exec(ctx, query, event.UserID, event.Type, event.IP, event.UserAgent, event.Metadata)
+	return err
+}
+
+// ListAuditEvents returns the user's events newest first. Pass the ID of
+// the last event seen as before to page back; 0 starts from the newest.
+func (s *service) ListAuditEvents(ctx context.Context, userID, before int64, limit int) ([]AuditEvent, error) {
+	query := `
+		SELECT id, user_id, event_type, ip, user_agent, metadata, created_at
+		FROM audit_events
+		WHERE user_id = $1 AND ($2 = 0 OR id < $2)
+		ORDER BY id DESC
+		LIMIT $3
+	`
+	rows, err := s.db.Query(ctx, query, userID, before, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []AuditEvent
+	for rows.Next() {
+		var e AuditEvent
+		if err := rows.Scan(&e.ID, &e.UserID, &e.Type, &e.IP, &e.UserAgent, &e.Metadata, &e.CreatedAt); err != nil {
+			return nil, err
+		}
+		events = append(events, e)
+	}
+	return events, rows.Err()
+}
@@ -0,0 +1,97 @@
+package database
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// CoupleProfile is what a couple says about itself. Dates are YYYY-MM-DD.
+type CoupleProfile struct {
+	CoupleID          int64           `json:"couple_id"`
+	DisplayName       string          `json:"display_name"`
+	Anniversary       *string         `json:"anniversary"`
+	RelationshipStart *string         `json:"relationship_start"`
+	CoverImageURL     string          `json:"cover_image_url"`
+	Preferences       json.RawMessage `json:"preferences"`
+	// Version goes up with every change; an update must name the version
+	// it was based on.
+	Version   int64     `json:"version"`
+	UpdatedBy *int64    `json:"updated_by,omitempty"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// CoupleProfileUpdate holds the fields to change; nil leaves a field as it
+// is and an empty date clears it. Preferences is merged into the existing
+// ones key by key, and a key set to null is removed.
+type CoupleProfileUpdate struct {
+	DisplayName       *string
+	Anniversary       *string
+	RelationshipStart *string
+	CoverImageURL     *string
+	Preferences       json.RawMessage
+}
+
+// coupleProfileColumns must be kept in sync with scanCoupleProfile.
+const coupleProfileColumns = `couple_id, display_name,
+	to_char(anniversary, 'YYYY-MM-DD'), to_char(relationship_start, 'YYYY-MM-DD'),
+	cover_image_url, preferences, version, updated_by, updated_at`
+
+func scanCoupleProfile(row pgx.Row) (*CoupleProfile, error) {
+	profile := &CoupleProfile{}
+	err := row.Scan(
+		&profile.CoupleID,
+		&profile.DisplayName,
+		&profile.Anniversary,
+		&profile.RelationshipStart,
+		&profile.CoverImageURL,
+		&profile.Preferences,
+		&profile.Version,
+		&profile.UpdatedBy,
+		&profile.UpdatedAt,
+	)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return profile, nil
+}
+
+func (s *service) GetCoupleProfile(ctx context.Context, coupleID int64) (*CoupleProfile, error) {
+	query := `
+		SELECT ` + coupleProfileColumns + `
+		FROM couple_profiles
+		WHERE couple_id = $1
+	`
+	return scanCoupleProfile(s.db.QueryRow(ctx, query, coupleID))
+}
+
+// UpdateCoupleProfile applies update on behalf of userID if the profile is
+// still at version. It returns nil if the profile has moved on since, so
+// that one member's edit never overwrites another's they have not seen.
+func (s *service) UpdateCoupleProfile(ctx context.Context, coupleID, userID, version int64, update CoupleProfileUpdate) (*CoupleProfile, error) {
+	var preferences *string
+	if update.Preferences != nil {
+		p := string(update.Preferences)
+		preferences = &p
+	}
+
+	query := `
+		UPDATE couple_profiles
+		SET display_name = COALESCE($4, display_name),
+			anniversary = CASE WHEN $5::text IS NULL THEN anniversary ELSE NULLIF($5, '')::date END,
+			relationship_start = CASE WHEN $6::text IS NULL THEN relationship_start ELSE NULLIF($6, '')::date END,
+			cover_image_url = COALESCE($7, cover_image_url),
+			preferences = CASE WHEN $8::jsonb IS NULL THEN preferences ELSE jsonb_strip_nulls(preferences || $8::jsonb) END,
+			version = version + 1,
+			updated_by = $2,
+			updated_at = NOW()
+		WHERE couple_id = $1 AND version = $3
+		RETURNING ` + coupleProfileColumns
+	return scanCoupleProfile(s.db.QueryRow(ctx, query, coupleID, userID, version,
+		update.DisplayName, update.Anniversary, update.RelationshipStart, update.CoverImageURL, preferences))
+}
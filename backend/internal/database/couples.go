@@ -2,35 +2,123 @@ package database
 
 import (
 	"context"
+	"errors"
 	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// What happens to a couple's vault items when it is unlinked. Export deletes
+// them like delete, once jobs.CoupleUnlink has mailed every member a copy.
+const (
+	VaultArchive = "archive"
+	VaultDelete  = "delete"
+	VaultExport  = "export"
+)
+
+// Roles within a couple. The owner can invite more members.
+const (
+	MemberRoleOwner  = "owner"
+	MemberRoleMember = "member"
 )
 
+// MaxCoupleMembers caps how many people one couple (or pod) can hold.
+const MaxCoupleMembers = 8
+
+var (
+	// ErrCoupleFull is returned when adding a member would exceed
+	// MaxCoupleMembers.
+	ErrCoupleFull = errors.New("couple is full")
+	// ErrNotCoupleOwner is returned when someone other than an owner tries
+	// to bring a new member into their couple.
+	ErrNotCoupleOwner = errors.New("only a couple's owner can add members")
+	// ErrLeaveWouldDissolve is returned when a member of a couple of two
+	// tries to leave it; that is what an unlink is for.
+	ErrLeaveWouldDissolve = errors.New("leaving would dissolve the couple")
+)
+
+// Couple is two or more people sharing a room and a vault. The name stayed
+// from when there could only be two.
 type Couple struct {
 	ID        int64     `json:"id"`
-	User1ID   int64     `json:"user1_id"`
-	User2ID   int64     `json:"user2_id"`
 	CreatedAt time.Time `json:"created_at"`
+	// Members lists everyone who has been in the couple, in the order they
+	// joined; those who left have LeftAt set. Someone who left and was
+	// invited back is listed once for each time they joined.
+	Members []CoupleMember `json:"members"`
+	// DissolvedAt is set once the couple has been unlinked.
+	DissolvedAt *time.Time `json:"dissolved_at,omitempty"`
+	// The unlink fields are set while an unlink is pending, and kept once
+	// it has gone through.
+	UnlinkRequestedBy *int64     `json:"unlink_requested_by,omitempty"`
+	UnlinkScheduledAt *time.Time `json:"unlink_scheduled_at,omitempty"`
+	VaultDisposition  *string    `json:"vault_disposition,omitempty"`
+}
+
+type CoupleMember struct {
+	UserID   int64      `json:"user_id"`
+	Role     string     `json:"role"`
+	JoinedAt time.Time  `json:"joined_at"`
+	LeftAt   *time.Time `json:"left_at,omitempty"`
 }
 
-func (s *service) CreateCouple(ctx context.Context, user1ID, user2ID int64) (*Couple, error) {
+// ActiveMemberIDs returns the members who have not left.
+func (c *Couple) ActiveMemberIDs() []int64 {
+	var ids []int64
+	for _, m := range c.Members {
+		if m.LeftAt == nil {
+			ids = append(ids, m.UserID)
+		}
+	}
+	return ids
+}
+
+// RoleOf returns the user's role, or "" if they are not an active member.
+func (c *Couple) RoleOf(userID int64) string {
+	for _, m := range c.Members {
+		if m.UserID == userID && m.LeftAt == nil {
+			return m.Role
+		}
+	}
+	return ""
+}
+
+// CreateCouple links two users, ownerID first. If either is already in an
+// active couple it fails with a unique violation from couple_members and
+// nothing changes.
+func (s *service) CreateCouple(ctx context.Context, ownerID, memberID int64) (*Couple, error) {
 	tx, err := s.db.Begin(ctx)
 	if err != nil {
 		return nil, err
 	}
 	defer tx.Rollback(ctx)
 
-	// Create couple
-	query := `
-		INSERT INTO couples (user1_id, user2_id, created_at)
-		VALUES ($1, $2, NOW())
-		RETURNING id, created_at
+	couple, err := createCouple(ctx, tx, ownerID, memberID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+
+	return couple, nil
+}
+
+func createCouple(ctx context.Context, tx pgx.Tx, ownerID, memberID int64) (*Couple, error) {
+	var coupleID int64
+	if err := tx.QueryRow(ctx, `INSERT INTO couples (created_at) VALUES (NOW()) RETURNING id`).Scan(&coupleID); err != nil {
+		return nil, err
+	}
+
+	membersQuery := `
+		INSERT INTO couple_members (couple_id, user_id, role, joined_at)
+		VALUES ($1, $2, 'owner', NOW()), ($1, $3, 'member', NOW())
 	`
-	couple := &Couple{
-		User1ID: user1ID,
-		User2ID: user2ID,
+	if _, err := tx.Exec(ctx, membersQuery, coupleID, ownerID, memberID); err != nil {
+		return nil, err
 	}
-	err = tx.QueryRow(ctx, query, user1ID, user2ID).Scan(&couple.ID, &couple.CreatedAt)
-	if err != nil {
+	if _, err := tx.Exec(ctx, `INSERT INTO couple_profiles (couple_id) VALUES ($1)`, coupleID); err != nil {
 		return nil, err
 	}
 
@@ -40,14 +128,144 @@ func (s *service) CreateCouple(ctx context.Context, user1ID, user2ID int64) (*Co
 		SET couple_id = $1
 		WHERE id = $2 OR id = $3
 	`
-	_, err = tx.Exec(ctx, updateQuery, couple.ID, user1ID, user2ID)
-	if err != nil {
+	if _, err := tx.Exec(ctx, updateQuery, coupleID, ownerID, memberID); err != nil {
 		return nil, err
 	}
 
-	if err := tx.Commit(ctx); err != nil {
+	return getCouple(ctx, tx, coupleID)
+}
+
+// addCoupleMember brings userID into an existing couple, which they may
+// have left before. Like createCouple it fails with a unique violation if
+// they are already in one.
+func addCoupleMember(ctx context.Context, tx pgx.Tx, coupleID, userID int64) (*Couple, error) {
+	// Lock the couple so concurrent joins see each other's members
+	var members int
+	countQuery := `
+		SELECT (SELECT COUNT(*) FROM couple_members WHERE couple_id = c.id AND left_at IS NULL)
+		FROM couples c
+		WHERE c.id = $1
+		FOR UPDATE
+	`
+	if err := tx.QueryRow(ctx, countQuery, coupleID).Scan(&members); err != nil {
+		return nil, err
+	}
+	if members >= MaxCoupleMembers {
+		return nil, ErrCoupleFull
+	}
+
+	memberQuery := `
+		INSERT INTO couple_members (couple_id, user_id, role, joined_at)
+		VALUES ($1, $2, 'member', NOW())
+	`
+	if _, err := tx.Exec(ctx, memberQuery, coupleID, userID); err != nil {
+		return nil, err
+	}
+	if _, err := tx.Exec(ctx, `UPDATE users SET couple_id = $1 WHERE id = $2`, coupleID, userID); err != nil {
 		return nil, err
 	}
 
+	return getCouple(ctx, tx, coupleID)
+}
+
+// leftCouple settles a couple after a member left: it is dissolved if
+// fewer than two members remain, and otherwise the longest-standing member
+// takes over as owner if the owner was the one who left.
+func leftCouple(ctx context.Context, tx pgx.Tx, coupleID int64) error {
+	var remaining int
+	countQuery := `SELECT COUNT(*) FROM couple_members WHERE couple_id = $1 AND left_at IS NULL`
+	if err := tx.QueryRow(ctx, countQuery, coupleID).Scan(&remaining); err != nil {
+		return err
+	}
+	if remaining < 2 {
+		_, err := dissolveCouple(ctx, tx, coupleID)
+		return err
+	}
+
+	promoteQuery := `
+		UPDATE couple_members
+		SET role = 'owner'
+		WHERE id = (
+			SELECT id
+			FROM couple_members
+			WHERE couple_id = $1 AND left_at IS NULL
+			ORDER BY joined_at, user_id
+			LIMIT 1
+		)
+		AND NOT EXISTS (
+			SELECT 1 FROM couple_members
+			WHERE couple_id = $1 AND left_at IS NULL AND role = 'owner'
+		)
+	`
+	_, err := tx.Exec(ctx, promoteQuery, coupleID)
+	return err
+}
+
+// coupleColumns selects a couple from "couples c" along with its members;
+// keep it in sync with scanCouple.
+const coupleColumns = `c.id, c.created_at, c.dissolved_at,
+	c.unlink_requested_by, c.unlink_scheduled_at, c.vault_disposition,
+	COALESCE((
+		SELECT json_agg(json_build_object('user_id', m.user_id, 'role', m.role, 'joined_at', m.joined_at, 'left_at', m.left_at)
+			ORDER BY m.joined_at, m.user_id)
+		FROM couple_members m
+		WHERE m.couple_id = c.id
+	), '[]')`
+
+func scanCouple(row pgx.Row) (*Couple, error) {
+	couple := &Couple{}
+	err := row.Scan(
+		&couple.ID,
+		&couple.CreatedAt,
+		&couple.DissolvedAt,
+		&couple.UnlinkRequestedBy,
+		&couple.UnlinkScheduledAt,
+		&couple.VaultDisposition,
+		&couple.Members,
+	)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
 	return couple, nil
 }
+
+func getCouple(ctx context.Context, tx pgx.Tx, id int64) (*Couple, error) {
+	return scanCouple(tx.QueryRow(ctx, `SELECT `+coupleColumns+` FROM couples c WHERE c.id = $1`, id))
+}
+
+func (s *service) GetCoupleByID(ctx context.Context, id int64) (*Couple, error) {
+	query := `
+		SELECT ` + coupleColumns + `
+		FROM couples c
+		WHERE c.id = $1
+	`
+	return scanCouple(s.db.QueryRow(ctx, query, id))
+}
+
+// ListCoupleUsers returns the couple's active members.
+func (s *service) ListCoupleUsers(ctx context.Context, coupleID int64) ([]User, error) {
+	query := `
+		SELECT ` + userColumns + `
+		FROM users
+		WHERE couple_id = $1
+		ORDER BY id
+	`
+	rows, err := s.db.Query(ctx, query, coupleID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var users []User
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, *user)
+	}
+	return users, rows.Err()
+}
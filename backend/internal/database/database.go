@@ -20,9 +20,75 @@ type Service interface {
 	CreateUser(ctx context.Context, email, passwordHash string) (*User, error)
 	GetUserByEmail(ctx context.Context, email string) (*User, error)
 	GetUserByID(ctx context.Context, id int64) (*User, error)
-	CreateCouple(ctx context.Context, user1ID, user2ID int64) (*Couple, error)
+	UpdateUserPassword(ctx context.Context, id int64, passwordHash string) error
+	ResetUserPassword(ctx context.Context, id int64, passwordHash string) error
+	MarkEmailVerified(ctx context.Context, id int64) error
+	UpdateUserProfile(ctx context.Context, id int64, update UserProfileUpdate) (*User, error)
+	CreateCouple(ctx context.Context, ownerID, memberID int64) (*Couple, error)
+	CreatePairingInvite(ctx context.Context, userID int64, invite PairingInvite) (bool, error)
+	GetPairingInvite(ctx context.Context, userID int64) (*PairingInvite, error)
+	ClaimPairingCode(ctx context.Context, code string, claimantID int64) (int64, error)
+	ClaimPairingToken(ctx context.Context, token string, claimantID int64) (int64, error)
+	CreatePairingRequest(ctx context.Context, ownerID, requesterID int64, expiresAt time.Time) (*PairingRequest, error)
+	ListPairingRequests(ctx context.Context, userID int64) ([]PairingRequest, error)
+	ListPairingRequestsForExport(ctx context.Context, userID int64) ([]PairingRequest, error)
+	AcceptPairingRequest(ctx context.Context, requestID, ownerID int64) (*PairingRequest, *Couple, error)
+	RejectPairingRequest(ctx context.Context, requestID, ownerID int64) (*PairingRequest, error)
+	GetCoupleByID(ctx context.Context, id int64) (*Couple, error)
+	ListCoupleUsers(ctx context.Context, coupleID int64) ([]User, error)
+	GetCoupleProfile(ctx context.Context, coupleID int64) (*CoupleProfile, error)
+	UpdateCoupleProfile(ctx context.Context, coupleID, userID, version int64, update CoupleProfileUpdate) (*CoupleProfile, error)
 	CreateVaultItem(ctx context.Context, coupleID, userID int64, content string, unlockAt time.Time) (*VaultItem, error)
 	GetVaultItems(ctx context.Context, coupleID, userID int64) ([]VaultItem, error)
+	GetVaultItemsForExport(ctx context.Context, userID int64, coupleID *int64) ([]VaultItem, error)
+	CreateSession(ctx context.Context, sessionID string, userID int64, refreshHash string, device SessionDevice, ttl time.Duration) (*Session, error)
+	GetSession(ctx context.Context, sessionID string) (*Session, error)
+	ListUserSessions(ctx context.Context, userID int64) ([]Session, error)
+	RotateRefreshToken(ctx context.Context, userID int64, sessionID, oldHash, newHash string, device SessionDevice, ttl time.Duration) (bool, error)
+	RevokeSession(ctx context.Context, sessionID string) error
+	RevokeUserSessions(ctx context.Context, userID int64) error
+	CreatePasswordReset(ctx context.Context, tokenHash string, userID int64, ttl time.Duration) error
+	ConsumePasswordReset(ctx context.Context, tokenHash string) (int64, error)
+	CreateEmailVerification(ctx context.Context, tokenHash string, userID int64, ttl time.Duration) error
+	ConsumeEmailVerification(ctx context.Context, tokenHash string) (int64, error)
+	CreateWSTicket(ctx context.Context, ticketHash string, ticket WSTicket, ttl time.Duration) error
+	ConsumeWSTicket(ctx context.Context, ticketHash string) (*WSTicket, error)
+	CreatePersonalAccessToken(ctx context.Context, userID int64, name, tokenHash string, scopes []string, expiresAt time.Time) (*PersonalAccessToken, error)
+	ListPersonalAccessTokens(ctx context.Context, userID int64) ([]PersonalAccessToken, error)
+	GetPersonalAccessTokenByHash(ctx context.Context, tokenHash string) (*PersonalAccessToken, error)
+	DeletePersonalAccessToken(ctx context.Context, userID, tokenID int64) (bool, error)
+	TouchPersonalAccessToken(ctx context.Context, tokenID int64) error
+	SaveUserMFA(ctx context.Context, userID int64, secretEncrypted []byte, recoveryCodeHashes []string) error
+	GetUserMFA(ctx context.Context, userID int64) (*UserMFA, error)
+	EnableUserMFA(ctx context.Context, userID int64) error
+	DeleteUserMFA(ctx context.Context, userID int64) error
+	ConsumeRecoveryCode(ctx context.Context, userID int64, codeHash string) (bool, error)
+	CreateSigningKey(ctx context.Context, key *SigningKey, newest time.Time) (bool, error)
+	ListSigningKeys(ctx context.Context) ([]SigningKey, error)
+	GetUserByIdentity(ctx context.Context, provider, subject string) (*User, error)
+	CreateUserIdentity(ctx context.Context, userID int64, provider, subject, email string) error
+	CreateUserWithIdentity(ctx context.Context, email, provider, subject string, emailVerified bool) (*User, error)
+	ListUserIdentities(ctx context.Context, userID int64) ([]UserIdentity, error)
+	ScheduleUserDeletion(ctx context.Context, userID int64, at time.Time) error
+	CancelUserDeletion(ctx context.Context, userID int64) error
+	ListUsersDueForDeletion(ctx context.Context, before time.Time) ([]int64, error)
+	DeleteUser(ctx context.Context, userID int64) (*Couple, error)
+	SearchUsers(ctx context.Context, query string, limit int) ([]User, error)
+	DisableUser(ctx context.Context, userID int64) (bool, error)
+	EnableUser(ctx context.Context, userID int64) (bool, error)
+	DissolveCouple(ctx context.Context, coupleID int64) (bool, error)
+	RequestUnlink(ctx context.Context, coupleID, userID int64, disposition string, scheduledAt time.Time) (bool, error)
+	CancelUnlink(ctx context.Context, coupleID int64) (bool, error)
+	LeaveCouple(ctx context.Context, coupleID, userID int64, disposition string) (*Couple, error)
+	ListCouplesDueForUnlink(ctx context.Context, before time.Time) ([]int64, error)
+	CompleteUnlink(ctx context.Context, coupleID int64) (*Couple, error)
+	VaultExportSent(ctx context.Context, coupleID int64, scheduledAt time.Time, userID int64) (bool, error)
+	MarkVaultExportSent(ctx context.Context, coupleID int64, scheduledAt time.Time, userID int64) error
+	GetArchivedVaultItems(ctx context.Context, userID int64) ([]VaultItem, error)
+	RecordAdminAction(ctx context.Context, action AdminAction) error
+	ListAdminActions(ctx context.Context, limit int) ([]AdminAction, error)
+	RecordAuditEvent(ctx context.Context, event AuditEvent) error
+	ListAuditEvents(ctx context.Context, userID, before int64, limit int) ([]AuditEvent, error)
 }
 
 type service struct {
@@ -0,0 +1,17 @@
+package database
+
+import (
+	"errors"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// uniqueViolation is the Postgres SQLSTATE for unique_violation.
+const uniqueViolation = "23505"
+
+// IsUniqueViolation reports whether err came from an INSERT or UPDATE that
+// would have duplicated a unique key, e.g. registering an email twice.
+func IsUniqueViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == uniqueViolation
+}
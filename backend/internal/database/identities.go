@@ -0,0 +1,100 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+type UserIdentity struct {
+	ID        int64     `json:"id"`
+	UserID    int64     `json:"user_id"`
+	Provider  string    `json:"provider"`
+	Subject   string    `json:"subject"`
+	Email     string    `json:"email"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func (s *service) GetUserByIdentity(ctx context.Context, provider, subject string) (*User, error) {
+	query := `
+		SELECT user_id
+		FROM user_identities
+		WHERE provider = $1 AND subject = $2
+	`
+	var userID int64
+	err := s.db.QueryRow(ctx, query, provider, subject).Scan(&userID)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return s.GetUserByID(ctx, userID)
+}
+
+func (s *service) CreateUserIdentity(ctx context.Context, userID int64, provider, subject, email string) error {
+	query := `
+		INSERT INTO user_identities (user_id, provider, subject, email, created_at)
+		VALUES ($1, $2, $3, $4, NOW())
+	`
+	_, err := s.db.Exec(ctx, query, userID, provider, subject, email)
+	return err
+}
+
+// CreateUserWithIdentity registers a user who signed in through an identity
+// provider. They get no usable password until they set one via reset.
+func (s *service) CreateUserWithIdentity(ctx context.Context, email, provider, subject string, emailVerified bool) (*User, error) {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	query := `
+		INSERT INTO users (email, password_hash, created_at, email_verified_at)
+		VALUES ($1, '', NOW(), CASE WHEN $2::boolean THEN NOW() END)
+		RETURNING ` + userColumns
+	user, err := scanUser(tx.QueryRow(ctx, query, email, emailVerified))
+	if err != nil {
+		return nil, err
+	}
+
+	identityQuery := `
+		INSERT INTO user_identities (user_id, provider, subject, email, created_at)
+		VALUES ($1, $2, $3, $4, NOW())
+	`
+	if _, err := tx.Exec(ctx, identityQuery, user.ID, provider, subject, email); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+func (s *service) ListUserIdentities(ctx context.Context, userID int64) ([]UserIdentity, error) {
+	query := `
+		SELECT id, user_id, provider, subject, COALESCE(email, ''), created_at
+		FROM user_identities
+		WHERE user_id = $1
+		ORDER BY created_at
+	`
+	rows, err := s.db.Query(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	identities := []UserIdentity{}
+	for rows.Next() {
+		var identity UserIdentity
+		err := rows.Scan(&identity.ID, &identity.UserID, &identity.Provider, &identity.Subject, &identity.Email, &identity.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		identities = append(identities, identity)
+	}
+	return identities, rows.Err()
+}
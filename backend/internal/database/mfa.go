@@ -0,0 +1,83 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+type UserMFA struct {
+	UserID              int64
+	TOTPSecretEncrypted []byte
+	EnabledAt           *time.Time
+	CreatedAt           time.Time
+}
+
+// SaveUserMFA starts (or restarts) an enrollment. The factor stays disabled
+// until EnableUserMFA is called after the first successful code.
+func (s *service) SaveUserMFA(ctx context.Context, userID int64, secretEncrypted []byte, recoveryCodeHashes []string) error {
+	query := `
+		INSERT INTO user_mfa (user_id, totp_secret_encrypted, recovery_code_hashes, enabled_at, created_at)
+		VALUES ($1, $2, $3, NULL, NOW())
+		ON CONFLICT (user_id) DO UPDATE
+		SET totp_secret_encrypted = EXCLUDED.totp_secret_encrypted,
+			recovery_code_hashes = EXCLUDED.recovery_code_hashes,
+			enabled_at = NULL,
+			created_at = NOW()
+	`
+	_, err := s.db.Exec(ctx, query, userID, secretEncrypted, recoveryCodeHashes)
+	return err
+}
+
+func (s *service) GetUserMFA(ctx context.Context, userID int64) (*UserMFA, error) {
+	query := `
+		SELECT user_id, totp_secret_encrypted, enabled_at, created_at
+		FROM user_mfa
+		WHERE user_id = $1
+	`
+	mfa := &UserMFA{}
+	err := s.db.QueryRow(ctx, query, userID).Scan(
+		&mfa.UserID,
+		&mfa.TOTPSecretEncrypted,
+		&mfa.EnabledAt,
+		&mfa.CreatedAt,
+	)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return mfa, nil
+}
+
+func (s *service) EnableUserMFA(ctx context.Context, userID int64) error {
+	query := `
+		UPDATE user_mfa
+		SET enabled_at = NOW()
+		WHERE user_id = $1
+	`
+	_, err := s.db.Exec(ctx, query, userID)
+	return err
+}
+
+func (s *service) DeleteUserMFA(ctx context.Context, userID int64) error {
+	_, err := s.db.Exec(ctx, `DELETE FROM user_mfa WHERE user_id = $1`, userID)
+	return err
+}
+
+// ConsumeRecoveryCode removes the code hash if present and reports whether
+// it was, so a recovery code can only ever be used once.
+func (s *service) ConsumeRecoveryCode(ctx context.Context, userID int64, codeHash string) (bool, error) {
+	query := `
+		UPDATE user_mfa
+		SET recovery_code_hashes = array_remove(recovery_code_hashes, $2)
+		WHERE user_id = $1 AND enabled_at IS NOT NULL AND $2 = ANY(recovery_code_hashes)
+	`
+	tag, err := s.db.Exec(ctx, query, userID, codeHash)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() == 1, nil
+}
@@ -0,0 +1,88 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// One-time tokens (password resets, email verification) are stored in Redis
+// by hash only and redeemed with GETDEL so each can be used exactly once.
+
+func oneTimeTokenKey(purpose, tokenHash string) string {
+	return fmt.Sprintf("%s:%s", purpose, tokenHash)
+}
+
+func (s *service) createOneTimeToken(ctx context.Context, purpose, tokenHash string, userID int64, ttl time.Duration) error {
+	return s.redis.Set(ctx, oneTimeTokenKey(purpose, tokenHash), userID, ttl).Err()
+}
+
+// consumeOneTimeToken returns the user the token was issued for, or 0 if it
+// is unknown, expired or already used.
+func (s *service) consumeOneTimeToken(ctx context.Context, purpose, tokenHash string) (int64, error) {
+	val, err := s.redis.GetDel(ctx, oneTimeTokenKey(purpose, tokenHash)).Result()
+	if err != nil {
+		if err == redis.Nil {
+			return 0, nil
+		}
+		return 0, err
+	}
+	return strconv.ParseInt(val, 10, 64)
+}
+
+func passwordResetUserKey(userID int64) string {
+	return fmt.Sprintf("password_reset_user:%d", userID)
+}
+
+// CreatePasswordReset stores a reset token for userID and deletes the one
+// issued before it, so only the most recent reset email works.
+func (s *service) CreatePasswordReset(ctx context.Context, tokenHash string, userID int64, ttl time.Duration) error {
+	userKey := passwordResetUserKey(userID)
+	previous, err := s.redis.GetSet(ctx, userKey, tokenHash).Result()
+	if err != nil && err != redis.Nil {
+		return err
+	}
+
+	pipe := s.redis.TxPipeline()
+	if previous != "" {
+		pipe.Del(ctx, oneTimeTokenKey("password_reset", previous))
+	}
+	pipe.Expire(ctx, userKey, ttl)
+	pipe.Set(ctx, oneTimeTokenKey("password_reset", tokenHash), userID, ttl)
+	_, err = pipe.Exec(ctx)
+	return err
+}
+
+// ConsumePasswordReset redeems a reset token. Besides the checks of
+// consumeOneTimeToken, the token must still be the user's latest, in case
+// two requests raced to replace each other's.
+func (s *service) ConsumePasswordReset(ctx context.Context, tokenHash string) (int64, error) {
+	userID, err := s.consumeOneTimeToken(ctx, "password_reset", tokenHash)
+	if err != nil || userID == 0 {
+		return 0, err
+	}
+
+	userKey := passwordResetUserKey(userID)
+	latest, err := s.redis.Get(ctx, userKey).Result()
+	if err != nil && err != redis.Nil {
+		return 0, err
+	}
+	if latest != tokenHash {
+		return 0, nil
+	}
+	if err := s.redis.Del(ctx, userKey).Err(); err != nil {
+		return 0, err
+	}
+	return userID, nil
+}
+
+func (s *service) CreateEmailVerification(ctx context.Context, tokenHash string, userID int64, ttl time.Duration) error {
+	return s.createOneTimeToken(ctx, "email_verification", tokenHash, userID, ttl)
+}
+
+func (s *service) ConsumeEmailVerification(ctx context.Context, tokenHash string) (int64, error) {
+	return s.consumeOneTimeToken(ctx, "email_verification", tokenHash)
+}
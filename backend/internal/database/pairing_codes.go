@@ -0,0 +1,141 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// PairingInvite is what a user hands their partner: a short code to type
+// in, and a long token for links and QR codes. Either one redeems it.
+type PairingInvite struct {
+	Code      string    `json:"code"`
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// createPairingInviteScript replaces the owner's outstanding invite, if any,
+// so only the newest code and token work. It returns 0 without touching
+// anything if the new code or token is already some other invite's.
+var createPairingInviteScript = redis.NewScript(`
+if not redis.call('SET', KEYS[2], ARGV[1], 'PX', ARGV[4], 'NX') then
+	return 0
+end
+if not redis.call('SET', KEYS[3], ARGV[1], 'PX', ARGV[4], 'NX') then
+	redis.call('DEL', KEYS[2])
+	return 0
+end
+local old = redis.call('HMGET', KEYS[1], 'code_key', 'token_key')
+for _, key in ipairs(old) do
+	if key then
+		redis.call('DEL', key)
+	end
+end
+redis.call('DEL', KEYS[1])
+redis.call('HSET', KEYS[1], 'code', ARGV[2], 'token', ARGV[3], 'code_key', KEYS[2], 'token_key', KEYS[3])
+redis.call('PEXPIRE', KEYS[1], ARGV[4])
+return 1
+`)
+
+// claimPairingInviteScript deletes the invite and returns its owner in one
+// step, so two people redeeming the same invite cannot both get it. The
+// code and token go together. An owner redeeming their own invite gets the
+// owner back without using it up. KEYS[2] is the owner key of ARGV[2], the
+// owner the caller looked up; if the invite now belongs to someone else
+// it claims nothing.
+var claimPairingInviteScript = redis.NewScript(`
+local owner = redis.call('GET', KEYS[1])
+if owner ~= ARGV[2] then
+	return false
+end
+if owner ~= ARGV[1] then
+	local keys = redis.call('HMGET', KEYS[2], 'code_key', 'token_key')
+	for _, key in ipairs(keys) do
+		if key then
+			redis.call('DEL', key)
+		end
+	end
+	redis.call('DEL', KEYS[1], KEYS[2])
+end
+return owner
+`)
+
+func pairingCodeKey(code string) string {
+	return fmt.Sprintf("pairing:code:%s", code)
+}
+
+func pairingTokenKey(token string) string {
+	return fmt.Sprintf("pairing:token:%s", token)
+}
+
+func pairingOwnerKey(userID int64) string {
+	return fmt.Sprintf("pairing:owner:%d", userID)
+}
+
+// CreatePairingInvite stores invite for userID, revoking any invite they
+// generated before. It reports false, storing nothing, if invite's code or
+// token is already in use.
+func (s *service) CreatePairingInvite(ctx context.Context, userID int64, invite PairingInvite) (bool, error) {
+	keys := []string{pairingOwnerKey(userID), pairingCodeKey(invite.Code), pairingTokenKey(invite.Token)}
+	ttl := time.Until(invite.ExpiresAt).Milliseconds()
+	created, err := createPairingInviteScript.Run(ctx, s.redis, keys, userID, invite.Code, invite.Token, ttl).Int()
+	if err != nil {
+		return false, err
+	}
+	return created == 1, nil
+}
+
+// GetPairingInvite returns the user's outstanding invite, or nil if they
+// have none.
+func (s *service) GetPairingInvite(ctx context.Context, userID int64) (*PairingInvite, error) {
+	key := pairingOwnerKey(userID)
+	fields, err := s.redis.HMGet(ctx, key, "code", "token").Result()
+	if err != nil {
+		return nil, err
+	}
+	code, _ := fields[0].(string)
+	token, _ := fields[1].(string)
+	if code == "" || token == "" {
+		return nil, nil
+	}
+	ttl, err := s.redis.PTTL(ctx, key).Result()
+	if err != nil {
+		return nil, err
+	}
+	return &PairingInvite{Code: code, Token: token, ExpiresAt: time.Now().Add(ttl)}, nil
+}
+
+// ClaimPairingCode redeems code on behalf of claimantID and returns the user
+// who generated it, or 0 if it is unknown, expired or already claimed.
+func (s *service) ClaimPairingCode(ctx context.Context, code string, claimantID int64) (int64, error) {
+	return s.claimPairingInvite(ctx, pairingCodeKey(code), claimantID)
+}
+
+// ClaimPairingToken is ClaimPairingCode for the invite's token.
+func (s *service) ClaimPairingToken(ctx context.Context, token string, claimantID int64) (int64, error) {
+	return s.claimPairingInvite(ctx, pairingTokenKey(token), claimantID)
+}
+
+func (s *service) claimPairingInvite(ctx context.Context, key string, claimantID int64) (int64, error) {
+	// The script has to be told the owner's key up front, so look the
+	// owner up first; the script checks it is still the same.
+	owner, err := s.redis.Get(ctx, key).Int64()
+	if err != nil {
+		if err == redis.Nil {
+			return 0, nil
+		}
+		return 0, err
+	}
+
+	keys := []string{key, pairingOwnerKey(owner)}
+	err = claimPairingInviteScript.Run(ctx, s.redis, keys, claimantID, owner).Err()
+	if err != nil {
+		if err == redis.Nil {
+			return 0, nil
+		}
+		return 0, err
+	}
+	return owner, nil
+}
@@ -0,0 +1,185 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+const (
+	PairingPending  = "pending"
+	PairingAccepted = "accepted"
+	PairingRejected = "rejected"
+)
+
+// PairingRequest is someone asking to link with the owner of a pairing
+// code they redeemed.
+type PairingRequest struct {
+	ID             int64      `json:"id"`
+	OwnerID        int64      `json:"owner_id"`
+	OwnerEmail     string     `json:"owner_email"`
+	RequesterID    int64      `json:"requester_id"`
+	RequesterEmail string     `json:"requester_email"`
+	Status         string     `json:"status"`
+	CreatedAt      time.Time  `json:"created_at"`
+	ExpiresAt      time.Time  `json:"expires_at"`
+	RespondedAt    *time.Time `json:"responded_at,omitempty"`
+}
+
+const pairingRequestColumns = `p.id, p.owner_id, o.email, p.requester_id, r.email, p.status, p.created_at, p.expires_at, p.responded_at`
+
+// pairingRequestFrom joins in the emails so each side can tell who the
+// other is.
+const pairingRequestFrom = `
+	pairing_requests p
+	JOIN users o ON o.id = p.owner_id
+	JOIN users r ON r.id = p.requester_id
+`
+
+func scanPairingRequest(row pgx.Row) (*PairingRequest, error) {
+	p := &PairingRequest{}
+	err := row.Scan(&p.ID, &p.OwnerID, &p.OwnerEmail, &p.RequesterID, &p.RequesterEmail, &p.Status, &p.CreatedAt, &p.ExpiresAt, &p.RespondedAt)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return p, nil
+}
+
+func (s *service) CreatePairingRequest(ctx context.Context, ownerID, requesterID int64, expiresAt time.Time) (*PairingRequest, error) {
+	query := `
+		WITH p AS (
+			INSERT INTO pairing_requests (owner_id, requester_id, created_at, expires_at)
+			VALUES ($1, $2, NOW(), $3)
+			RETURNING *
+		)
+		SELECT ` + pairingRequestColumns + `
+		FROM p
+		JOIN users o ON o.id = p.owner_id
+		JOIN users r ON r.id = p.requester_id
+	`
+	return scanPairingRequest(s.db.QueryRow(ctx, query, ownerID, requesterID, expiresAt))
+}
+
+// ListPairingRequests returns the unexpired pending requests the user sent
+// or received, newest first.
+func (s *service) ListPairingRequests(ctx context.Context, userID int64) ([]PairingRequest, error) {
+	query := `
+		SELECT ` + pairingRequestColumns + `
+		FROM ` + pairingRequestFrom + `
+		WHERE (p.owner_id = $1 OR p.requester_id = $1)
+			AND p.status = 'pending' AND p.expires_at > NOW()
+		ORDER BY p.id DESC
+	`
+	return s.queryPairingRequests(ctx, query, userID)
+}
+
+// ListPairingRequestsForExport returns every request the user sent or
+// received, whatever became of it, oldest first.
+func (s *service) ListPairingRequestsForExport(ctx context.Context, userID int64) ([]PairingRequest, error) {
+	query := `
+		SELECT ` + pairingRequestColumns + `
+		FROM ` + pairingRequestFrom + `
+		WHERE p.owner_id = $1 OR p.requester_id = $1
+		ORDER BY p.id
+	`
+	return s.queryPairingRequests(ctx, query, userID)
+}
+
+func (s *service) queryPairingRequests(ctx context.Context, query string, args ...interface{}) ([]PairingRequest, error) {
+	rows, err := s.db.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var requests []PairingRequest
+	for rows.Next() {
+		p, err := scanPairingRequest(rows)
+		if err != nil {
+			return nil, err
+		}
+		requests = append(requests, *p)
+	}
+	return requests, rows.Err()
+}
+
+// AcceptPairingRequest links the requester with ownerID if the request is
+// theirs, pending and unexpired; otherwise it returns nil. If ownerID is
+// already in a couple the requester joins it, failing with ErrCoupleFull
+// or ErrNotCoupleOwner where that is not allowed. Like CreateCouple it
+// fails with a unique violation if the requester has been paired in the
+// meantime. The request stays pending on any failure.
+func (s *service) AcceptPairingRequest(ctx context.Context, requestID, ownerID int64) (*PairingRequest, *Couple, error) {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	request, err := respondToPairingRequest(ctx, tx, requestID, ownerID, PairingAccepted)
+	if err != nil || request == nil {
+		return nil, nil, err
+	}
+	// An owner already in a couple brings the requester into it
+	var coupleID int64
+	var role string
+	membershipQuery := `
+		SELECT couple_id, role
+		FROM couple_members
+		WHERE user_id = $1 AND left_at IS NULL
+	`
+	var couple *Couple
+	err = tx.QueryRow(ctx, membershipQuery, ownerID).Scan(&coupleID, &role)
+	switch {
+	case err == pgx.ErrNoRows:
+		couple, err = createCouple(ctx, tx, request.OwnerID, request.RequesterID)
+	case err != nil:
+	case role != MemberRoleOwner:
+		err = ErrNotCoupleOwner
+	default:
+		couple, err = addCoupleMember(ctx, tx, coupleID, request.RequesterID)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, nil, err
+	}
+	return request, couple, nil
+}
+
+// RejectPairingRequest returns nil if ownerID has no such pending request.
+func (s *service) RejectPairingRequest(ctx context.Context, requestID, ownerID int64) (*PairingRequest, error) {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	request, err := respondToPairingRequest(ctx, tx, requestID, ownerID, PairingRejected)
+	if err != nil || request == nil {
+		return nil, err
+	}
+	return request, tx.Commit(ctx)
+}
+
+func respondToPairingRequest(ctx context.Context, tx pgx.Tx, requestID, ownerID int64, status string) (*PairingRequest, error) {
+	query := `
+		WITH p AS (
+			UPDATE pairing_requests
+			SET status = $3, responded_at = NOW()
+			WHERE id = $1 AND owner_id = $2 AND status = 'pending' AND expires_at > NOW()
+			RETURNING *
+		)
+		SELECT ` + pairingRequestColumns + `
+		FROM p
+		JOIN users o ON o.id = p.owner_id
+		JOIN users r ON r.id = p.requester_id
+	`
+	return scanPairingRequest(tx.QueryRow(ctx, query, requestID, ownerID, status))
+}
@@ -0,0 +1,104 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+type PersonalAccessToken struct {
+	ID         int64      `json:"id"`
+	UserID     int64      `json:"user_id"`
+	Name       string     `json:"name"`
+	Scopes     []string   `json:"scopes"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+const personalAccessTokenColumns = `id, user_id, name, scopes, expires_at, last_used_at, created_at`
+
+func scanPersonalAccessToken(row pgx.Row) (*PersonalAccessToken, error) {
+	t := &PersonalAccessToken{}
+	err := row.Scan(&t.ID, &t.UserID, &t.Name, &t.Scopes, &t.ExpiresAt, &t.LastUsedAt, &t.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+func (s *service) CreatePersonalAccessToken(ctx context.Context, userID int64, name, tokenHash string, scopes []string, expiresAt time.Time) (*PersonalAccessToken, error) {
+	query := `
+		INSERT INTO personal_access_tokens (user_id, name, token_hash, scopes, expires_at, created_at)
+		VALUES ($1, $2, $3, $4, $5, NOW())
+		RETURNING ` + personalAccessTokenColumns
+	return scanPersonalAccessToken(s.db.QueryRow(ctx, query, userID, name, tokenHash, scopes, expiresAt))
+}
+
+func (s *service) ListPersonalAccessTokens(ctx context.Context, userID int64) ([]PersonalAccessToken, error) {
+	query := `
+		SELECT ` + personalAccessTokenColumns + `
+		FROM personal_access_tokens
+		WHERE user_id = $1
+		ORDER BY created_at DESC
+	`
+	rows, err := s.db.Query(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tokens := []PersonalAccessToken{}
+	for rows.Next() {
+		t, err := scanPersonalAccessToken(rows)
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, *t)
+	}
+	return tokens, rows.Err()
+}
+
+// GetPersonalAccessTokenByHash returns the token even if it has expired;
+// callers decide what to do with expired tokens.
+func (s *service) GetPersonalAccessTokenByHash(ctx context.Context, tokenHash string) (*PersonalAccessToken, error) {
+	query := `
+		SELECT ` + personalAccessTokenColumns + `
+		FROM personal_access_tokens
+		WHERE token_hash = $1
+	`
+	t, err := scanPersonalAccessToken(s.db.QueryRow(ctx, query, tokenHash))
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return t, nil
+}
+
+// DeletePersonalAccessToken reports false if the user has no such token.
+func (s *service) DeletePersonalAccessToken(ctx context.Context, userID, tokenID int64) (bool, error) {
+	query := `
+		DELETE FROM personal_access_tokens
+		WHERE id = $1 AND user_id = $2
+	`
+	tag, err := s.db.Exec(ctx, query, tokenID, userID)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() > 0, nil
+}
+
+// TouchPersonalAccessToken records use of the token. Writes are throttled
+// to one a minute so busy scripts don't turn every request into an UPDATE.
+func (s *service) TouchPersonalAccessToken(ctx context.Context, tokenID int64) error {
+	query := `
+		UPDATE personal_access_tokens
+		SET last_used_at = NOW()
+		WHERE id = $1 AND (last_used_at IS NULL OR last_used_at < NOW() - INTERVAL '1 minute')
+	`
+	_, err := s.db.Exec(ctx, query, tokenID)
+	return err
+}
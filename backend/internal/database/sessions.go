@@ -0,0 +1,208 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+type Session struct {
+	ID         string    `json:"id"`
+	UserID     int64     `json:"user_id"`
+	DeviceName string    `json:"device_name"`
+	UserAgent  string    `json:"user_agent"`
+	IP         string    `json:"ip"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastSeenAt time.Time `json:"last_seen_at"`
+}
+
+// SessionDevice describes the client a session was created or last
+// refreshed from.
+type SessionDevice struct {
+	Name      string
+	UserAgent string
+	IP        string
+}
+
+// rotateRefreshScript swaps the stored refresh hash only if the presented one
+// is still current, so two concurrent refreshes cannot both succeed. The
+// same call records where the refresh came from, and keeps the user's
+// session index (KEYS[2]) alive at least as long as the session.
+var rotateRefreshScript = redis.NewScript(`
+if redis.call('HGET', KEYS[1], 'refresh_hash') == ARGV[1] then
+	redis.call('HSET', KEYS[1], 'refresh_hash', ARGV[2], 'last_seen_at', ARGV[4], 'device_name', ARGV[5], 'user_agent', ARGV[6], 'ip', ARGV[7])
+	redis.call('PEXPIRE', KEYS[1], ARGV[3])
+	redis.call('SADD', KEYS[2], ARGV[8])
+	if redis.call('PTTL', KEYS[2]) < tonumber(ARGV[3]) then
+		redis.call('PEXPIRE', KEYS[2], ARGV[3])
+	end
+	return 1
+end
+return 0
+`)
+
+func sessionKey(sessionID string) string {
+	return fmt.Sprintf("session:%s", sessionID)
+}
+
+func userSessionsKey(userID int64) string {
+	return fmt.Sprintf("user_sessions:%d", userID)
+}
+
+func (s *service) CreateSession(ctx context.Context, sessionID string, userID int64, refreshHash string, device SessionDevice, ttl time.Duration) (*Session, error) {
+	now := time.Now()
+	session := &Session{
+		ID:         sessionID,
+		UserID:     userID,
+		DeviceName: device.Name,
+		UserAgent:  device.UserAgent,
+		IP:         device.IP,
+		CreatedAt:  now,
+		LastSeenAt: now,
+	}
+
+	pipe := s.redis.TxPipeline()
+	pipe.HSet(ctx, sessionKey(session.ID), map[string]interface{}{
+		"user_id":      userID,
+		"refresh_hash": refreshHash,
+		"device_name":  device.Name,
+		"user_agent":   device.UserAgent,
+		"ip":           device.IP,
+		"created_at":   now.Unix(),
+		"last_seen_at": now.Unix(),
+	})
+	pipe.Expire(ctx, sessionKey(session.ID), ttl)
+	pipe.SAdd(ctx, userSessionsKey(userID), session.ID)
+	pipe.Expire(ctx, userSessionsKey(userID), ttl)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, err
+	}
+
+	return session, nil
+}
+
+func (s *service) GetSession(ctx context.Context, sessionID string) (*Session, error) {
+	vals, err := s.redis.HGetAll(ctx, sessionKey(sessionID)).Result()
+	if err != nil {
+		return nil, err
+	}
+	if len(vals) == 0 {
+		return nil, nil
+	}
+
+	return parseSession(sessionID, vals)
+}
+
+func parseSession(sessionID string, vals map[string]string) (*Session, error) {
+	userID, err := strconv.ParseInt(vals["user_id"], 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	createdAt, _ := strconv.ParseInt(vals["created_at"], 10, 64)
+	lastSeenAt, _ := strconv.ParseInt(vals["last_seen_at"], 10, 64)
+	if lastSeenAt == 0 {
+		lastSeenAt = createdAt
+	}
+
+	return &Session{
+		ID:         sessionID,
+		UserID:     userID,
+		DeviceName: vals["device_name"],
+		UserAgent:  vals["user_agent"],
+		IP:         vals["ip"],
+		CreatedAt:  time.Unix(createdAt, 0),
+		LastSeenAt: time.Unix(lastSeenAt, 0),
+	}, nil
+}
+
+// ListUserSessions returns the user's live sessions, most recently used
+// first. Ids of sessions that have expired are pruned from the index.
+func (s *service) ListUserSessions(ctx context.Context, userID int64) ([]Session, error) {
+	sessionIDs, err := s.redis.SMembers(ctx, userSessionsKey(userID)).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	pipe := s.redis.Pipeline()
+	cmds := make([]*redis.MapStringStringCmd, len(sessionIDs))
+	for i, id := range sessionIDs {
+		cmds[i] = pipe.HGetAll(ctx, sessionKey(id))
+	}
+	if len(sessionIDs) > 0 {
+		if _, err := pipe.Exec(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	sessions := []Session{}
+	var stale []interface{}
+	for i, cmd := range cmds {
+		vals := cmd.Val()
+		if len(vals) == 0 {
+			stale = append(stale, sessionIDs[i])
+			continue
+		}
+		session, err := parseSession(sessionIDs[i], vals)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, *session)
+	}
+	if len(stale) > 0 {
+		if err := s.redis.SRem(ctx, userSessionsKey(userID), stale...).Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].LastSeenAt.After(sessions[j].LastSeenAt)
+	})
+	return sessions, nil
+}
+
+// RotateRefreshToken replaces the session's refresh hash. It reports false
+// when oldHash is not the current one, which means the token was reused.
+func (s *service) RotateRefreshToken(ctx context.Context, userID int64, sessionID, oldHash, newHash string, device SessionDevice, ttl time.Duration) (bool, error) {
+	keys := []string{sessionKey(sessionID), userSessionsKey(userID)}
+	res, err := rotateRefreshScript.Run(ctx, s.redis, keys,
+		oldHash, newHash, ttl.Milliseconds(), time.Now().Unix(), device.Name, device.UserAgent, device.IP, sessionID).Int()
+	if err != nil {
+		return false, err
+	}
+	return res == 1, nil
+}
+
+func (s *service) RevokeSession(ctx context.Context, sessionID string) error {
+	session, err := s.GetSession(ctx, sessionID)
+	if err != nil {
+		return err
+	}
+	if session == nil {
+		return nil
+	}
+
+	pipe := s.redis.TxPipeline()
+	pipe.Del(ctx, sessionKey(sessionID))
+	pipe.SRem(ctx, userSessionsKey(session.UserID), sessionID)
+	_, err = pipe.Exec(ctx)
+	return err
+}
+
+func (s *service) RevokeUserSessions(ctx context.Context, userID int64) error {
+	sessionIDs, err := s.redis.SMembers(ctx, userSessionsKey(userID)).Result()
+	if err != nil {
+		return err
+	}
+
+	pipe := s.redis.TxPipeline()
+	for _, id := range sessionIDs {
+		pipe.Del(ctx, sessionKey(id))
+	}
+	pipe.Del(ctx, userSessionsKey(userID))
+	_, err = pipe.Exec(ctx)
+	return err
+}
@@ -0,0 +1,88 @@
+package database
+
+import (
+	"context"
+	"time"
+)
+
+type SigningKey struct {
+	ID                  string
+	Algorithm           string
+	PrivateKeyEncrypted []byte
+	PublicKey           []byte
+	ActivatesAt         time.Time
+	ExpiresAt           time.Time
+	CreatedAt           time.Time
+}
+
+// signingKeysLock is the advisory lock held while a signing key is created,
+// so that API instances rotating at the same moment take turns.
+const signingKeysLock = 0x6a756e746f6b6579 // "juntokey"
+
+// CreateSigningKey inserts key unless some unexpired key activates after
+// newest, the activation of the newest key the caller knew about (zero if
+// it knew of none): another instance got there first. It reports whether
+// key was inserted.
+func (s *service) CreateSigningKey(ctx context.Context, key *SigningKey, newest time.Time) (bool, error) {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, `SELECT pg_advisory_xact_lock($1)`, int64(signingKeysLock)); err != nil {
+		return false, err
+	}
+
+	var taken bool
+	err = tx.QueryRow(ctx, `
+		SELECT EXISTS (SELECT 1 FROM signing_keys WHERE expires_at > NOW() AND activates_at > $1)
+	`, newest).Scan(&taken)
+	if err != nil {
+		return false, err
+	}
+	if taken {
+		return false, nil
+	}
+
+	query := `
+		INSERT INTO signing_keys (kid, algorithm, private_key_encrypted, public_key, activates_at, expires_at, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, NOW())
+		RETURNING created_at
+	`
+	err = tx.QueryRow(ctx, query,
+		key.ID, key.Algorithm, key.PrivateKeyEncrypted, key.PublicKey, key.ActivatesAt, key.ExpiresAt,
+	).Scan(&key.CreatedAt)
+	if err != nil {
+		return false, err
+	}
+	return true, tx.Commit(ctx)
+}
+
+// ListSigningKeys returns every key that has not expired yet, newest first.
+func (s *service) ListSigningKeys(ctx context.Context) ([]SigningKey, error) {
+	query := `
+		SELECT kid, algorithm, private_key_encrypted, public_key, activates_at, expires_at, created_at
+		FROM signing_keys
+		WHERE expires_at > NOW()
+		ORDER BY activates_at DESC
+	`
+	rows, err := s.db.Query(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var keys []SigningKey
+	for rows.Next() {
+		var key SigningKey
+		err := rows.Scan(
+			&key.ID, &key.Algorithm, &key.PrivateKeyEncrypted, &key.PublicKey, &key.ActivatesAt, &key.ExpiresAt, &key.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
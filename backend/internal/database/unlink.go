@@ -0,0 +1,221 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// RequestUnlink schedules the couple to be dissolved at scheduledAt. It
+// reports false if the couple is already dissolved or has an unlink pending.
+func (s *service) RequestUnlink(ctx context.Context, coupleID, userID int64, disposition string, scheduledAt time.Time) (bool, error) {
+	query := `
+		UPDATE couples
+		SET unlink_requested_by = $2, unlink_scheduled_at = $3, vault_disposition = $4
+		WHERE id = $1 AND dissolved_at IS NULL AND unlink_scheduled_at IS NULL
+	`
+	tag, err := s.db.Exec(ctx, query, coupleID, userID, scheduledAt, disposition)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() > 0, nil
+}
+
+// CancelUnlink reports false if there was no pending unlink to cancel.
+func (s *service) CancelUnlink(ctx context.Context, coupleID int64) (bool, error) {
+	query := `
+		UPDATE couples
+		SET unlink_requested_by = NULL, unlink_scheduled_at = NULL, vault_disposition = NULL
+		WHERE id = $1 AND dissolved_at IS NULL AND unlink_scheduled_at IS NOT NULL
+	`
+	tag, err := s.db.Exec(ctx, query, coupleID)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() > 0, nil
+}
+
+// vaultExportsTTL is how long the members already mailed a couple's vault
+// are remembered; long past the point the unlink goes through.
+const vaultExportsTTL = 7 * 24 * time.Hour
+
+// vaultExportsKey names the Redis set of members already mailed the vault
+// for one unlink. It is keyed by when the unlink is due, so a couple that
+// calls an unlink off and requests another starts afresh.
+func vaultExportsKey(coupleID int64, scheduledAt time.Time) string {
+	return fmt.Sprintf("vault_export_sent:%d:%d", coupleID, scheduledAt.Unix())
+}
+
+// VaultExportSent reports whether userID has been mailed the vault for the
+// unlink of coupleID due at scheduledAt.
+func (s *service) VaultExportSent(ctx context.Context, coupleID int64, scheduledAt time.Time, userID int64) (bool, error) {
+	return s.redis.SIsMember(ctx, vaultExportsKey(coupleID, scheduledAt), userID).Result()
+}
+
+// MarkVaultExportSent records that userID has been mailed the vault, so a
+// retry of the unlink does not mail them again.
+func (s *service) MarkVaultExportSent(ctx context.Context, coupleID int64, scheduledAt time.Time, userID int64) error {
+	key := vaultExportsKey(coupleID, scheduledAt)
+	pipe := s.redis.TxPipeline()
+	pipe.SAdd(ctx, key, userID)
+	pipe.Expire(ctx, key, vaultExportsTTL)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+func (s *service) ListCouplesDueForUnlink(ctx context.Context, before time.Time) ([]int64, error) {
+	query := `
+		SELECT id
+		FROM couples
+		WHERE unlink_scheduled_at IS NOT NULL AND unlink_scheduled_at <= $1 AND dissolved_at IS NULL
+		ORDER BY unlink_scheduled_at
+		LIMIT 100
+	`
+	rows, err := s.db.Query(ctx, query, before)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// CompleteUnlink dissolves a couple whose unlink is due, applying its vault
+// disposition, and returns it with the members it had. It returns nil if
+// the unlink was cancelled or already done.
+func (s *service) CompleteUnlink(ctx context.Context, coupleID int64) (*Couple, error) {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	query := `
+		SELECT ` + coupleColumns + `
+		FROM couples c
+		WHERE c.id = $1 AND c.unlink_scheduled_at <= NOW() AND c.dissolved_at IS NULL
+		FOR UPDATE
+	`
+	couple, err := scanCouple(tx.QueryRow(ctx, query, coupleID))
+	if err != nil || couple == nil {
+		return nil, err
+	}
+
+	if couple.VaultDisposition == nil || *couple.VaultDisposition != VaultArchive {
+		if _, err := tx.Exec(ctx, `DELETE FROM vault_items WHERE couple_id = $1`, coupleID); err != nil {
+			return nil, err
+		}
+	}
+	if _, err := dissolveCouple(ctx, tx, coupleID); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	couple.DissolvedAt = &now
+	return couple, nil
+}
+
+// LeaveCouple takes userID out of coupleID straight away, leaving the rest
+// of it together. With the delete disposition the items they wrote there
+// go with them; with archive they stay for the others. It returns the
+// couple as it is afterwards, nil if userID was not an active member, or
+// ErrLeaveWouldDissolve if fewer than two members would remain.
+func (s *service) LeaveCouple(ctx context.Context, coupleID, userID int64, disposition string) (*Couple, error) {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	// Lock the couple so concurrent leaves see each other
+	query := `
+		SELECT ` + coupleColumns + `
+		FROM couples c
+		WHERE c.id = $1 AND c.dissolved_at IS NULL
+		FOR UPDATE
+	`
+	couple, err := scanCouple(tx.QueryRow(ctx, query, coupleID))
+	if err != nil || couple == nil || couple.RoleOf(userID) == "" {
+		return nil, err
+	}
+	if len(couple.ActiveMemberIDs()) <= 2 {
+		return nil, ErrLeaveWouldDissolve
+	}
+
+	if _, err := tx.Exec(ctx, `UPDATE couple_members SET left_at = NOW() WHERE couple_id = $1 AND user_id = $2 AND left_at IS NULL`, coupleID, userID); err != nil {
+		return nil, err
+	}
+	if _, err := tx.Exec(ctx, `UPDATE users SET couple_id = NULL WHERE id = $1`, userID); err != nil {
+		return nil, err
+	}
+	if disposition == VaultDelete {
+		if _, err := tx.Exec(ctx, `DELETE FROM vault_items WHERE couple_id = $1 AND created_by = $2`, coupleID, userID); err != nil {
+			return nil, err
+		}
+	}
+	if err := cancelUnlinkRequestedBy(ctx, tx, coupleID, userID); err != nil {
+		return nil, err
+	}
+	if err := leftCouple(ctx, tx, coupleID); err != nil {
+		return nil, err
+	}
+
+	couple, err = getCouple(ctx, tx, coupleID)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+	return couple, nil
+}
+
+// cancelUnlinkRequestedBy calls off a pending unlink of coupleID if userID
+// asked for it, as they are leaving and it goes with them.
+func cancelUnlinkRequestedBy(ctx context.Context, tx pgx.Tx, coupleID, userID int64) error {
+	query := `
+		UPDATE couples
+		SET unlink_requested_by = NULL, unlink_scheduled_at = NULL, vault_disposition = NULL
+		WHERE id = $1 AND unlink_requested_by = $2 AND dissolved_at IS NULL
+	`
+	_, err := tx.Exec(ctx, query, coupleID, userID)
+	return err
+}
+
+// dissolveCouple marks the couple dissolved and unlinks its members. It
+// reports false if the couple does not exist or was already dissolved.
+func dissolveCouple(ctx context.Context, tx pgx.Tx, coupleID int64) (bool, error) {
+	query := `
+		UPDATE couples
+		SET dissolved_at = NOW()
+		WHERE id = $1 AND dissolved_at IS NULL
+	`
+	tag, err := tx.Exec(ctx, query, coupleID)
+	if err != nil {
+		return false, err
+	}
+	if tag.RowsAffected() == 0 {
+		return false, nil
+	}
+
+	if _, err := tx.Exec(ctx, `UPDATE couple_members SET left_at = NOW() WHERE couple_id = $1 AND left_at IS NULL`, coupleID); err != nil {
+		return false, err
+	}
+	if _, err := tx.Exec(ctx, `UPDATE users SET couple_id = NULL WHERE couple_id = $1`, coupleID); err != nil {
+		return false, err
+	}
+	return true, nil
+}
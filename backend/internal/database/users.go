@@ -2,50 +2,66 @@ package database
 
 import (
 	"context"
+	"encoding/json"
 	"time"
 
 	"github.com/jackc/pgx/v5"
 )
 
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin"
+)
+
 type User struct {
-	ID           int64     `json:"id"`
-	Email        string    `json:"email"`
-	PasswordHash string    `json:"-"`
-	AvatarConfig string    `json:"avatar_config"` // Stored as JSONB in DB, string here for simplicity or json.RawMessage
-	CreatedAt    time.Time `json:"created_at"`
-	CoupleID     *int64    `json:"couple_id,omitempty"`
+	ID           int64  `json:"id"`
+	Email        string `json:"email"`
+	PasswordHash string `json:"-"`
+	DisplayName  string `json:"display_name"`
+	Pronouns     string `json:"pronouns"`
+	Timezone     string `json:"timezone"`
+	// AvatarConfig is an avatar.Config, or nil if the user never set one.
+	AvatarConfig    json.RawMessage `json:"avatar_config"`
+	CreatedAt       time.Time       `json:"created_at"`
+	CoupleID        *int64          `json:"couple_id,omitempty"`
+	EmailVerifiedAt *time.Time      `json:"email_verified_at,omitempty"`
+	// DeletionScheduledAt is set while the account is in its deletion
+	// grace period.
+	DeletionScheduledAt *time.Time `json:"deletion_scheduled_at,omitempty"`
+	Role                string     `json:"role"`
+	// DisabledAt is set while an admin has the account disabled.
+	DisabledAt *time.Time `json:"disabled_at,omitempty"`
 }
 
 func (s *service) CreateUser(ctx context.Context, email, passwordHash string) (*User, error) {
 	query := `
 		INSERT INTO users (email, password_hash, created_at)
 		VALUES ($1, $2, NOW())
-		RETURNING id, email, created_at
-	`
-	user := &User{
-		Email:        email,
-		PasswordHash: passwordHash,
-	}
-	err := s.db.QueryRow(ctx, query, email, passwordHash).Scan(&user.ID, &user.Email, &user.CreatedAt)
-	if err != nil {
-		return nil, err
-	}
-	return user, nil
+		RETURNING ` + userColumns
+	return scanUser(s.db.QueryRow(ctx, query, email, passwordHash))
 }
 
-func (s *service) GetUserByEmail(ctx context.Context, email string) (*User, error) {
-	query := `
-		SELECT id, email, password_hash, created_at, couple_id
-		FROM users
-		WHERE email = $1
-	`
+// userColumns is selected by every query that loads a full User; keep it in
+// sync with scanUser.
+const userColumns = `id, email, password_hash, display_name, pronouns, timezone, avatar_config,
+	created_at, couple_id, email_verified_at, deletion_scheduled_at, role, disabled_at`
+
+func scanUser(row pgx.Row) (*User, error) {
 	user := &User{}
-	err := s.db.QueryRow(ctx, query, email).Scan(
+	err := row.Scan(
 		&user.ID,
 		&user.Email,
 		&user.PasswordHash,
+		&user.DisplayName,
+		&user.Pronouns,
+		&user.Timezone,
+		&user.AvatarConfig,
 		&user.CreatedAt,
 		&user.CoupleID,
+		&user.EmailVerifiedAt,
+		&user.DeletionScheduledAt,
+		&user.Role,
+		&user.DisabledAt,
 	)
 	if err != nil {
 		if err == pgx.ErrNoRows {
@@ -56,25 +72,81 @@ func (s *service) GetUserByEmail(ctx context.Context, email string) (*User, erro
 	return user, nil
 }
 
+func (s *service) GetUserByEmail(ctx context.Context, email string) (*User, error) {
+	query := `
+		SELECT ` + userColumns + `
+		FROM users
+		WHERE lower(email) = lower($1)
+	`
+	return scanUser(s.db.QueryRow(ctx, query, email))
+}
+
 func (s *service) GetUserByID(ctx context.Context, id int64) (*User, error) {
 	query := `
-		SELECT id, email, password_hash, created_at, couple_id
+		SELECT ` + userColumns + `
 		FROM users
 		WHERE id = $1
 	`
-	user := &User{}
-	err := s.db.QueryRow(ctx, query, id).Scan(
-		&user.ID,
-		&user.Email,
-		&user.PasswordHash,
-		&user.CreatedAt,
-		&user.CoupleID,
-	)
+	return scanUser(s.db.QueryRow(ctx, query, id))
+}
+
+func (s *service) UpdateUserPassword(ctx context.Context, id int64, passwordHash string) error {
+	query := `
+		UPDATE users
+		SET password_hash = $1
+		WHERE id = $2
+	`
+	_, err := s.db.Exec(ctx, query, passwordHash, id)
+	return err
+}
+
+// ResetUserPassword sets a password chosen through a reset link and deletes
+// the user's personal access tokens, as whoever needed the reset may not
+// have been the only one holding them.
+func (s *service) ResetUserPassword(ctx context.Context, id int64, passwordHash string) error {
+	tx, err := s.db.Begin(ctx)
 	if err != nil {
-		if err == pgx.ErrNoRows {
-			return nil, nil
-		}
-		return nil, err
+		return err
 	}
-	return user, nil
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, `UPDATE users SET password_hash = $1 WHERE id = $2`, passwordHash, id); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(ctx, `DELETE FROM personal_access_tokens WHERE user_id = $1`, id); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+func (s *service) MarkEmailVerified(ctx context.Context, id int64) error {
+	query := `
+		UPDATE users
+		SET email_verified_at = COALESCE(email_verified_at, NOW())
+		WHERE id = $1
+	`
+	_, err := s.db.Exec(ctx, query, id)
+	return err
+}
+
+// UserProfileUpdate holds the profile fields to change; nil leaves a field
+// as it is. AvatarConfig must already be validated.
+type UserProfileUpdate struct {
+	DisplayName  *string
+	Pronouns     *string
+	Timezone     *string
+	AvatarConfig json.RawMessage
+}
+
+// UpdateUserProfile returns the updated user, or nil if there is none.
+func (s *service) UpdateUserProfile(ctx context.Context, id int64, update UserProfileUpdate) (*User, error) {
+	query := `
+		UPDATE users
+		SET display_name = COALESCE($2, display_name),
+			pronouns = COALESCE($3, pronouns),
+			timezone = COALESCE($4, timezone),
+			avatar_config = COALESCE($5, avatar_config)
+		WHERE id = $1
+		RETURNING ` + userColumns
+	return scanUser(s.db.QueryRow(ctx, query, id, update.DisplayName, update.Pronouns, update.Timezone, update.AvatarConfig))
 }
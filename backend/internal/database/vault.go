@@ -31,14 +31,17 @@ func (s *service) CreateVaultItem(ctx context.Context, coupleID, userID int64, c
 	return &item, nil
 }
 
+// GetVaultItems returns the couple's items from since userID joined it;
+// whatever was shared before that stays with the members who were there.
 func (s *service) GetVaultItems(ctx context.Context, coupleID, userID int64) ([]VaultItem, error) {
 	query := `
-		SELECT id, couple_id, created_by, content_text, unlock_at, created_at
-		FROM vault_items
-		WHERE couple_id = $1
-		ORDER BY created_at DESC
+		SELECT v.id, v.couple_id, v.created_by, v.content_text, v.unlock_at, v.created_at
+		FROM vault_items v
+		JOIN couple_members m ON m.couple_id = v.couple_id AND m.user_id = $2 AND m.left_at IS NULL
+		WHERE v.couple_id = $1 AND v.created_at >= m.joined_at
+		ORDER BY v.created_at DESC
 	`
-	rows, err := s.db.Query(ctx, query, coupleID)
+	rows, err := s.db.Query(ctx, query, coupleID, userID)
 	if err != nil {
 		return nil, err
 	}
@@ -70,3 +73,91 @@ func (s *service) GetVaultItems(ctx context.Context, coupleID, userID int64) ([]
 	}
 	return items, nil
 }
+
+// GetVaultItemsForExport returns everything the user wrote, in any couple,
+// plus what their current couple shares with them. Partner items that are
+// still locked stay masked, and items from before the user joined are left
+// out, as in GetVaultItems.
+func (s *service) GetVaultItemsForExport(ctx context.Context, userID int64, coupleID *int64) ([]VaultItem, error) {
+	query := `
+		SELECT v.id, v.couple_id, v.created_by, v.content_text, v.unlock_at, v.created_at
+		FROM vault_items v
+		LEFT JOIN couple_members m ON m.couple_id = v.couple_id AND m.user_id = $1 AND m.left_at IS NULL
+		WHERE v.created_by = $1 OR (v.couple_id = $2 AND v.created_at >= m.joined_at)
+		ORDER BY v.created_at
+	`
+	rows, err := s.db.Query(ctx, query, userID, coupleID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := []VaultItem{}
+	now := time.Now()
+	for rows.Next() {
+		var item VaultItem
+		err := rows.Scan(
+			&item.ID, &item.CoupleID, &item.CreatedBy, &item.ContentText, &item.UnlockAt, &item.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		if item.UnlockAt.After(now) {
+			item.Locked = true
+			if item.CreatedBy != userID {
+				item.ContentText = ""
+			}
+		}
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
+
+// GetArchivedVaultItems returns what the user kept from their past stints
+// in couples: the items shared while they were a member of a couple that
+// was unlinked with the archive disposition while they were still in it,
+// and the items they wrote in a pod before leaving it. Locked items stay
+// masked for everyone but their author.
+func (s *service) GetArchivedVaultItems(ctx context.Context, userID int64) ([]VaultItem, error) {
+	query := `
+		SELECT v.id, v.couple_id, v.created_by, v.content_text, v.unlock_at, v.created_at
+		FROM vault_items v
+		JOIN couples c ON c.id = v.couple_id
+		WHERE EXISTS (
+			SELECT 1
+			FROM couple_members m
+			WHERE m.couple_id = c.id AND m.user_id = $1 AND m.left_at IS NOT NULL
+				AND v.created_at >= m.joined_at
+				AND (
+					(c.vault_disposition = 'archive' AND m.left_at >= c.dissolved_at)
+					OR (v.created_by = $1 AND v.created_at <= m.left_at)
+				)
+		)
+		ORDER BY v.created_at DESC
+	`
+	rows, err := s.db.Query(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := []VaultItem{}
+	now := time.Now()
+	for rows.Next() {
+		var item VaultItem
+		err := rows.Scan(
+			&item.ID, &item.CoupleID, &item.CreatedBy, &item.ContentText, &item.UnlockAt, &item.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		if item.UnlockAt.After(now) {
+			item.Locked = true
+			if item.CreatedBy != userID {
+				item.ContentText = ""
+			}
+		}
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
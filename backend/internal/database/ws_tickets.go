@@ -0,0 +1,55 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// WSTicket is what a WebSocket ticket stands for: the session that minted
+// it and when the access token used to mint it expires. Like one-time
+// tokens, tickets are stored by hash and redeemed with GETDEL.
+type WSTicket struct {
+	UserID        int64
+	SessionID     string
+	AuthExpiresAt time.Time
+}
+
+func wsTicketKey(ticketHash string) string {
+	return fmt.Sprintf("ws_ticket:%s", ticketHash)
+}
+
+func (s *service) CreateWSTicket(ctx context.Context, ticketHash string, ticket WSTicket, ttl time.Duration) error {
+	val := fmt.Sprintf("%d:%s:%d", ticket.UserID, ticket.SessionID, ticket.AuthExpiresAt.Unix())
+	return s.redis.Set(ctx, wsTicketKey(ticketHash), val, ttl).Err()
+}
+
+// ConsumeWSTicket returns nil if the ticket is unknown, expired or already
+// used.
+func (s *service) ConsumeWSTicket(ctx context.Context, ticketHash string) (*WSTicket, error) {
+	val, err := s.redis.GetDel(ctx, wsTicketKey(ticketHash)).Result()
+	if err != nil {
+		if err == redis.Nil {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	parts := strings.Split(val, ":")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("malformed ws ticket")
+	}
+	userID, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	exp, err := strconv.ParseInt(parts[2], 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	return &WSTicket{UserID: userID, SessionID: parts[1], AuthExpiresAt: time.Unix(exp, 0)}, nil
+}
@@ -0,0 +1,206 @@
+package handlers
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/bit2swaz/junto/internal/database"
+	"github.com/bit2swaz/junto/internal/mailer"
+	"github.com/bit2swaz/junto/internal/middleware"
+	"github.com/bit2swaz/junto/internal/problem"
+	"github.com/bit2swaz/junto/internal/validate"
+)
+
+// AccountDeletionGrace is how long a deletion request can still be undone.
+const AccountDeletionGrace = 14 * 24 * time.Hour
+
+// maxExportedEvents caps the security history included in an export.
+const maxExportedEvents = 10000
+
+type AccountHandler struct {
+	DB     database.Service
+	Mailer mailer.Mailer
+}
+
+// DeleteAccount schedules the hard delete; jobs.AccountDeletion carries it
+// out once the grace period is over.
+func (h *AccountHandler) DeleteAccount(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(middleware.UserIDKey).(int64)
+	user, err := h.DB.GetUserByID(r.Context(), userID)
+	if err != nil || user == nil {
+		problem.Write(w, problem.CodeNotFound, "User not found")
+		return
+	}
+
+	scheduledAt := time.Now().Add(AccountDeletionGrace)
+	if user.DeletionScheduledAt != nil {
+		scheduledAt = *user.DeletionScheduledAt
+	} else if err := h.DB.ScheduleUserDeletion(r.Context(), userID, scheduledAt); err != nil {
+		problem.Internal(w)
+		return
+	}
+
+	err = h.Mailer.Send(r.Context(), mailer.Message{
+		To:      user.Email,
+		Subject: "Your Junto account will be deleted",
+		Body: fmt.Sprintf("Your Junto account and everything you wrote will be permanently deleted on %s.\n\nIf you change your mind, log in before then and cancel the deletion.",
+			scheduledAt.UTC().Format("January 2, 2006")),
+	})
+	if err != nil {
+		log.Printf("failed to send deletion email: %v", err)
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message":               "Account scheduled for deletion",
+		"deletion_scheduled_at": scheduledAt,
+	})
+}
+
+func (h *AccountHandler) CancelDeletion(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(middleware.UserIDKey).(int64)
+	if err := h.DB.CancelUserDeletion(r.Context(), userID); err != nil {
+		problem.Internal(w)
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "Account deletion cancelled",
+	})
+}
+
+// ExportData streams a ZIP archive with one JSON file per kind of data
+// tied to the user. Secrets are left out: the password hash, the TOTP secret
+// and recovery codes, and the hashes of refresh and access tokens, so
+// sessions and access tokens appear as metadata only.
+func (h *AccountHandler) ExportData(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(middleware.UserIDKey).(int64)
+	ctx := r.Context()
+
+	user, err := h.DB.GetUserByID(ctx, userID)
+	if err != nil || user == nil {
+		problem.Write(w, problem.CodeNotFound, "User not found")
+		return
+	}
+
+	var couple *database.Couple
+	var coupleProfile *database.CoupleProfile
+	if user.CoupleID != nil {
+		couple, err = h.DB.GetCoupleByID(ctx, *user.CoupleID)
+		if err != nil {
+			problem.Internal(w)
+			return
+		}
+		coupleProfile, err = h.DB.GetCoupleProfile(ctx, *user.CoupleID)
+		if err != nil {
+			problem.Internal(w)
+			return
+		}
+	}
+	pairingRequests, err := h.DB.ListPairingRequestsForExport(ctx, userID)
+	if err != nil {
+		problem.Internal(w)
+		return
+	}
+	items, err := h.DB.GetVaultItemsForExport(ctx, userID, user.CoupleID)
+	if err != nil {
+		problem.Internal(w)
+		return
+	}
+	identities, err := h.DB.ListUserIdentities(ctx, userID)
+	if err != nil {
+		problem.Internal(w)
+		return
+	}
+	mfa, err := h.DB.GetUserMFA(ctx, userID)
+	if err != nil {
+		problem.Internal(w)
+		return
+	}
+	events, err := h.DB.ListAuditEvents(ctx, userID, 0, maxExportedEvents)
+	if err != nil {
+		problem.Internal(w)
+		return
+	}
+	sessions, err := h.DB.ListUserSessions(ctx, userID)
+	if err != nil {
+		problem.Internal(w)
+		return
+	}
+	accessTokens, err := h.DB.ListPersonalAccessTokens(ctx, userID)
+	if err != nil {
+		problem.Internal(w)
+		return
+	}
+	security := map[string]interface{}{"mfa_enabled": mfa != nil && mfa.EnabledAt != nil, "events": events}
+	if mfa != nil && mfa.EnabledAt != nil {
+		security["mfa_enabled_at"] = mfa.EnabledAt
+	}
+
+	files := []struct {
+		name string
+		data interface{}
+	}{
+		{"user.json", user},
+		{"couple.json", couple},
+		{"couple_profile.json", coupleProfile},
+		{"pairing_requests.json", pairingRequests},
+		{"vault_items.json", items},
+		{"identities.json", identities},
+		{"sessions.json", sessions},
+		{"access_tokens.json", accessTokens},
+		{"security.json", security},
+	}
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="junto-export-%d.zip"`, userID))
+
+	zw := zip.NewWriter(w)
+	for _, f := range files {
+		fw, err := zw.Create(f.name)
+		if err != nil {
+			log.Printf("export for user %d failed: %v", userID, err)
+			return
+		}
+		enc := json.NewEncoder(fw)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(f.data); err != nil {
+			log.Printf("export for user %d failed: %v", userID, err)
+			return
+		}
+	}
+	if err := zw.Close(); err != nil {
+		log.Printf("export for user %d failed: %v", userID, err)
+	}
+}
+
+// SecurityEvents lists the user's security history, newest first. Pass the
+// last ID seen as ?before= for the next page.
+func (h *AccountHandler) SecurityEvents(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(middleware.UserIDKey).(int64)
+
+	var before int64
+	if v := r.URL.Query().Get("before"); v != "" {
+		var err error
+		before, err = strconv.ParseInt(v, 10, 64)
+		if err != nil || before < 0 {
+			problem.Invalid(w, validate.Errors{{Field: "before", Message: "must be an event ID"}})
+			return
+		}
+	}
+
+	events, err := h.DB.ListAuditEvents(r.Context(), userID, before, listLimit(r))
+	if err != nil {
+		problem.Internal(w)
+		return
+	}
+	if events == nil {
+		events = []database.AuditEvent{}
+	}
+	json.NewEncoder(w).Encode(events)
+}
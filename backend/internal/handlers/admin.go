@@ -0,0 +1,258 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/bit2swaz/junto/internal/database"
+	"github.com/bit2swaz/junto/internal/middleware"
+	"github.com/bit2swaz/junto/internal/problem"
+	"github.com/bit2swaz/junto/internal/validate"
+	"github.com/bit2swaz/junto/internal/websocket"
+)
+
+// Actions recorded in the admin audit log.
+const (
+	AdminActionSearchUsers  = "search_users"
+	AdminActionViewCouple   = "view_couple"
+	AdminActionUnlinkCouple = "unlink_couple"
+	AdminActionDisableUser  = "disable_user"
+	AdminActionEnableUser   = "enable_user"
+	AdminActionViewHub      = "view_hub"
+	AdminActionViewAuditLog = "view_audit_log"
+)
+
+const maxAdminReasonLength = 500
+
+// AdminHandler serves the operator API. Every request is written to the
+// admin audit log before it is acted on, so a failed write stops the action.
+type AdminHandler struct {
+	DB  database.Service
+	Hub *websocket.Hub
+}
+
+type AdminReasonRequest struct {
+	Reason string `json:"reason"`
+}
+
+func (req AdminReasonRequest) Validate() error {
+	var v validate.Validator
+	v.Required("reason", req.Reason)
+	v.MaxLength("reason", req.Reason, maxAdminReasonLength)
+	return v.Err()
+}
+
+type AdminCoupleResponse struct {
+	Couple  *database.Couple `json:"couple"`
+	Members []database.User  `json:"members"`
+}
+
+func (h *AdminHandler) SearchUsers(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query().Get("q")
+	if !h.audit(w, r, database.AdminAction{
+		Action:  AdminActionSearchUsers,
+		Details: map[string]interface{}{"query": query},
+	}) {
+		return
+	}
+
+	users, err := h.DB.SearchUsers(r.Context(), query, listLimit(r))
+	if err != nil {
+		problem.Internal(w)
+		return
+	}
+	if users == nil {
+		users = []database.User{}
+	}
+	json.NewEncoder(w).Encode(users)
+}
+
+func (h *AdminHandler) GetCouple(w http.ResponseWriter, r *http.Request) {
+	coupleID, ok := pathID(w, r, "Couple not found")
+	if !ok {
+		return
+	}
+	if !h.audit(w, r, database.AdminAction{Action: AdminActionViewCouple, TargetCoupleID: &coupleID}) {
+		return
+	}
+
+	couple, err := h.DB.GetCoupleByID(r.Context(), coupleID)
+	if err != nil {
+		problem.Internal(w)
+		return
+	}
+	if couple == nil {
+		problem.Write(w, problem.CodeNotFound, "Couple not found")
+		return
+	}
+
+	resp := AdminCoupleResponse{Couple: couple, Members: []database.User{}}
+	seen := make(map[int64]bool)
+	for _, m := range couple.Members {
+		// Someone who rejoined has a membership for each time
+		if seen[m.UserID] {
+			continue
+		}
+		seen[m.UserID] = true
+		user, err := h.DB.GetUserByID(r.Context(), m.UserID)
+		if err != nil {
+			problem.Internal(w)
+			return
+		}
+		if user != nil {
+			resp.Members = append(resp.Members, *user)
+		}
+	}
+	json.NewEncoder(w).Encode(resp)
+}
+
+// UnlinkCouple dissolves a couple on behalf of its members.
+func (h *AdminHandler) UnlinkCouple(w http.ResponseWriter, r *http.Request) {
+	coupleID, ok := pathID(w, r, "Couple not found")
+	if !ok {
+		return
+	}
+	var req AdminReasonRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	if !h.audit(w, r, database.AdminAction{
+		Action:         AdminActionUnlinkCouple,
+		TargetCoupleID: &coupleID,
+		Details:        map[string]interface{}{"reason": req.Reason},
+	}) {
+		return
+	}
+
+	// Load the members first; dissolving removes them
+	couple, err := h.DB.GetCoupleByID(r.Context(), coupleID)
+	if err != nil {
+		problem.Internal(w)
+		return
+	}
+	dissolved := false
+	if couple != nil {
+		dissolved, err = h.DB.DissolveCouple(r.Context(), coupleID)
+		if err != nil {
+			problem.Internal(w)
+			return
+		}
+	}
+	if !dissolved {
+		problem.Write(w, problem.CodeNotFound, "No active couple with this ID")
+		return
+	}
+	h.Hub.DissolveRoom(coupleID)
+	for _, member := range couple.ActiveMemberIDs() {
+		h.Hub.SendToUser(member, map[string]interface{}{"type": websocket.MessageUnlinked, "couple_id": coupleID})
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// DisableUser locks an account out: it can no longer log in, and its
+// sessions, socket and personal access tokens are revoked.
+func (h *AdminHandler) DisableUser(w http.ResponseWriter, r *http.Request) {
+	adminID := r.Context().Value(middleware.UserIDKey).(int64)
+	userID, ok := pathID(w, r, "User not found")
+	if !ok {
+		return
+	}
+	var req AdminReasonRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	if userID == adminID {
+		problem.Write(w, problem.CodeForbidden, "Admins cannot disable their own account")
+		return
+	}
+	if !h.audit(w, r, database.AdminAction{
+		Action:       AdminActionDisableUser,
+		TargetUserID: &userID,
+		Details:      map[string]interface{}{"reason": req.Reason},
+	}) {
+		return
+	}
+
+	found, err := h.DB.DisableUser(r.Context(), userID)
+	if err != nil {
+		problem.Internal(w)
+		return
+	}
+	if !found {
+		problem.Write(w, problem.CodeNotFound, "User not found")
+		return
+	}
+	if err := h.DB.RevokeUserSessions(r.Context(), userID); err != nil {
+		problem.Internal(w)
+		return
+	}
+	h.Hub.DisconnectUser(userID, "account disabled")
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *AdminHandler) EnableUser(w http.ResponseWriter, r *http.Request) {
+	userID, ok := pathID(w, r, "User not found")
+	if !ok {
+		return
+	}
+	var req AdminReasonRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	if !h.audit(w, r, database.AdminAction{
+		Action:       AdminActionEnableUser,
+		TargetUserID: &userID,
+		Details:      map[string]interface{}{"reason": req.Reason},
+	}) {
+		return
+	}
+
+	found, err := h.DB.EnableUser(r.Context(), userID)
+	if err != nil {
+		problem.Internal(w)
+		return
+	}
+	if !found {
+		problem.Write(w, problem.CodeNotFound, "User not found")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *AdminHandler) HubState(w http.ResponseWriter, r *http.Request) {
+	if !h.audit(w, r, database.AdminAction{Action: AdminActionViewHub}) {
+		return
+	}
+	json.NewEncoder(w).Encode(h.Hub.State())
+}
+
+func (h *AdminHandler) AuditLog(w http.ResponseWriter, r *http.Request) {
+	if !h.audit(w, r, database.AdminAction{Action: AdminActionViewAuditLog}) {
+		return
+	}
+
+	actions, err := h.DB.ListAdminActions(r.Context(), listLimit(r))
+	if err != nil {
+		problem.Internal(w)
+		return
+	}
+	if actions == nil {
+		actions = []database.AdminAction{}
+	}
+	json.NewEncoder(w).Encode(actions)
+}
+
+// audit records action against the calling admin. It writes a 500 and
+// returns false if the record could not be written.
+func (h *AdminHandler) audit(w http.ResponseWriter, r *http.Request, action database.AdminAction) bool {
+	adminID := r.Context().Value(middleware.UserIDKey).(int64)
+	action.AdminID = &adminID
+	if err := h.DB.RecordAdminAction(r.Context(), action); err != nil {
+		problem.Internal(w)
+		return false
+	}
+	return true
+}
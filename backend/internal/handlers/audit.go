@@ -0,0 +1,35 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/bit2swaz/junto/internal/database"
+)
+
+// Login methods recorded with login and login_failed events.
+const (
+	loginMethodPassword     = "password"
+	loginMethodTOTP         = "totp"
+	loginMethodRecoveryCode = "recovery_code"
+)
+
+// recordEvent appends an event to the user's security history, tagged with
+// where the request came from. Failing to record is logged rather than
+// failing the request the event describes.
+func recordEvent(r *http.Request, db database.Service, userID int64, eventType string, metadata map[string]interface{}) {
+	ua := r.UserAgent()
+	if len(ua) > maxUserAgentLength {
+		ua = ua[:maxUserAgentLength]
+	}
+	event := database.AuditEvent{
+		UserID:    userID,
+		Type:      eventType,
+		IP:        clientIP(r),
+		UserAgent: ua,
+		Metadata:  metadata,
+	}
+	if err := db.RecordAuditEvent(r.Context(), event); err != nil {
+		log.Printf("failed to record %s event for user %d: %v", eventType, userID, err)
+	}
+}
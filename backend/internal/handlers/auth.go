@@ -2,18 +2,33 @@ package handlers
 
 import (
 	"encoding/json"
+	"log"
 	"net/http"
-	"os"
+	"strings"
 	"time"
 
+	"github.com/bit2swaz/junto/internal/auth"
 	"github.com/bit2swaz/junto/internal/database"
+	"github.com/bit2swaz/junto/internal/mailer"
 	"github.com/bit2swaz/junto/internal/middleware"
-	"github.com/golang-jwt/jwt/v5"
-	"golang.org/x/crypto/bcrypt"
+	"github.com/bit2swaz/junto/internal/oidc"
+	"github.com/bit2swaz/junto/internal/problem"
+	"github.com/bit2swaz/junto/internal/validate"
+	"github.com/bit2swaz/junto/internal/websocket"
+	"github.com/google/uuid"
 )
 
 type AuthHandler struct {
-	DB database.Service
+	DB        database.Service
+	Mailer    mailer.Mailer
+	Keys      *auth.KeyManager
+	Providers map[string]*oidc.Provider
+	// Hub is told when a password reset signs the user out.
+	Hub *websocket.Hub
+	// Hasher and PasswordPolicy fall back to auth.DefaultPasswordHasher
+	// and auth.DefaultPasswordPolicy when nil.
+	Hasher         auth.PasswordHasher
+	PasswordPolicy *auth.PasswordPolicy
 }
 
 type RegisterRequest struct {
@@ -21,34 +36,59 @@ type RegisterRequest struct {
 	Password string `json:"password"`
 }
 
+func (req RegisterRequest) Validate() error {
+	var v validate.Validator
+	checkEmail(&v, "email", req.Email)
+	checkPassword(&v, "password", req.Password)
+	return v.Err()
+}
+
 type LoginRequest struct {
 	Email    string `json:"email"`
 	Password string `json:"password"`
 }
 
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
 type AuthResponse struct {
-	Token string `json:"token"`
+	Token        string    `json:"token"`
+	RefreshToken string    `json:"refresh_token"`
+	ExpiresAt    time.Time `json:"expires_at"`
 }
 
 func (h *AuthHandler) Register(w http.ResponseWriter, r *http.Request) {
 	var req RegisterRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+	if !decodeJSON(w, r, &req) {
 		return
 	}
 
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+	email, _ := normalizeEmail(req.Email)
+
+	if !h.checkNewPassword(w, req.Password) {
+		return
+	}
+	hashedPassword, err := h.hasher().Hash(req.Password)
 	if err != nil {
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		problem.Internal(w)
 		return
 	}
 
-	user, err := h.DB.CreateUser(r.Context(), req.Email, string(hashedPassword))
+	user, err := h.DB.CreateUser(r.Context(), email, hashedPassword)
+	if database.IsUniqueViolation(err) {
+		problem.Write(w, problem.CodeEmailTaken, "An account with this email already exists")
+		return
+	}
 	if err != nil {
-		http.Error(w, "Failed to create user", http.StatusInternalServerError)
+		problem.Internal(w)
 		return
 	}
 
+	if err := h.sendVerificationEmail(r.Context(), user); err != nil {
+		log.Printf("failed to send verification email: %v", err)
+	}
+
 	w.WriteHeader(http.StatusCreated)
 	json.NewEncoder(w).Encode(map[string]interface{}{
 		"message": "User created",
@@ -58,49 +98,237 @@ func (h *AuthHandler) Register(w http.ResponseWriter, r *http.Request) {
 
 func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
 	var req LoginRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+	if !decodeJSON(w, r, &req) {
 		return
 	}
 
-	user, err := h.DB.GetUserByEmail(r.Context(), req.Email)
+	// Unknown and malformed emails are counted too, so lockouts don't reveal
+	// which accounts exist.
+	email, err := normalizeEmail(req.Email)
 	if err != nil {
-		http.Error(w, "Invalid credentials", http.StatusUnauthorized)
+		email = strings.ToLower(strings.TrimSpace(req.Email))
+	}
+	limits := []limitedKey{
+		{loginAccountPolicy, email},
+		{loginIPPolicy, clientIP(r)},
+	}
+
+	wait, err := checkLimits(r.Context(), h.DB.GetRedis(), limits...)
+	if err != nil {
+		problem.Internal(w)
+		return
+	}
+	if wait > 0 {
+		tooManyAttempts(w, wait)
+		return
+	}
+
+	user, err := h.DB.GetUserByEmail(r.Context(), email)
+	if err != nil {
+		problem.Internal(w)
 		return
 	}
 	if user == nil {
-		http.Error(w, "Invalid credentials", http.StatusUnauthorized)
+		h.loginFailed(w, r, limits)
+		return
+	}
+	match, rehash, err := h.hasher().Verify(req.Password, user.PasswordHash)
+	if err != nil {
+		problem.Internal(w)
+		return
+	}
+	if !match {
+		recordEvent(r, h.DB, user.ID, database.AuditLoginFailed, map[string]interface{}{"method": loginMethodPassword})
+		h.loginFailed(w, r, limits)
 		return
 	}
+	if rehash {
+		h.upgradePasswordHash(r.Context(), user.ID, req.Password)
+	}
 
-	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(req.Password)); err != nil {
-		http.Error(w, "Invalid credentials", http.StatusUnauthorized)
+	if err := resetLimit(r.Context(), h.DB.GetRedis(), limits[0]); err != nil {
+		problem.Internal(w)
 		return
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"user_id": user.ID,
-		"exp":     time.Now().Add(time.Hour * 24).Unix(),
-	})
+	h.completeLogin(w, r, user, loginMethodPassword)
+}
+
+// completeLogin runs once the first factor, named by method, has been
+// verified. Accounts with MFA get a short-lived mfa token instead of a
+// session.
+func (h *AuthHandler) completeLogin(w http.ResponseWriter, r *http.Request, user *database.User, method string) {
+	if user.DisabledAt != nil {
+		recordEvent(r, h.DB, user.ID, database.AuditLoginFailed, map[string]interface{}{"method": method, "reason": "account_disabled"})
+		problem.Write(w, problem.CodeAccountDisabled, "")
+		return
+	}
+
+	mfa, err := h.DB.GetUserMFA(r.Context(), user.ID)
+	if err != nil {
+		problem.Internal(w)
+		return
+	}
+	if mfa != nil && mfa.EnabledAt != nil {
+		mfaToken, expiresAt, err := h.Keys.NewMFAToken(user.ID)
+		if err != nil {
+			problem.Internal(w)
+			return
+		}
+		json.NewEncoder(w).Encode(MFAChallengeResponse{
+			MFARequired: true,
+			MFAToken:    mfaToken,
+			ExpiresAt:   expiresAt,
+		})
+		return
+	}
+
+	resp, err := h.startSession(r, user.ID)
+	if err != nil {
+		problem.Internal(w)
+		return
+	}
+	recordEvent(r, h.DB, user.ID, database.AuditLogin, map[string]interface{}{"method": method})
+
+	json.NewEncoder(w).Encode(resp)
+}
+
+// loginFailed records a failed credential check and answers 401, or 429 if
+// this failure tripped a lockout.
+func (h *AuthHandler) loginFailed(w http.ResponseWriter, r *http.Request, limits []limitedKey) {
+	wait, err := failLimits(r.Context(), h.DB.GetRedis(), limits...)
+	if err != nil {
+		problem.Internal(w)
+		return
+	}
+	if wait > 0 {
+		tooManyAttempts(w, wait)
+		return
+	}
+	problem.Write(w, problem.CodeInvalidCredentials, "")
+}
+
+// Refresh exchanges a refresh token for a new access/refresh pair. Each
+// refresh token is single-use; presenting an already rotated one is treated
+// as theft and revokes the whole session.
+func (h *AuthHandler) Refresh(w http.ResponseWriter, r *http.Request) {
+	var req RefreshRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+
+	sessionID, oldHash, err := auth.ParseRefreshToken(req.RefreshToken)
+	if err != nil {
+		problem.Write(w, problem.CodeInvalidToken, "Invalid refresh token")
+		return
+	}
+
+	session, err := h.DB.GetSession(r.Context(), sessionID)
+	if err != nil {
+		problem.Internal(w)
+		return
+	}
+	if session == nil {
+		problem.Write(w, problem.CodeInvalidToken, "Invalid refresh token")
+		return
+	}
+
+	refreshToken, newHash, err := auth.NewRefreshToken(sessionID)
+	if err != nil {
+		problem.Internal(w)
+		return
+	}
+
+	rotated, err := h.DB.RotateRefreshToken(r.Context(), session.UserID, sessionID, oldHash, newHash, sessionDevice(r), auth.RefreshTokenTTL)
+	if err != nil {
+		problem.Internal(w)
+		return
+	}
+	if !rotated {
+		// A reused token may be stolen, so the whole session goes
+		if err := h.DB.RevokeSession(r.Context(), sessionID); err != nil {
+			problem.Internal(w)
+			return
+		}
+		problem.Write(w, problem.CodeRefreshTokenReused, "")
+		return
+	}
 
-	tokenString, err := token.SignedString([]byte(os.Getenv("JWT_SECRET")))
+	accessToken, expiresAt, err := h.Keys.NewAccessToken(session.UserID, sessionID)
 	if err != nil {
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		problem.Internal(w)
 		return
 	}
 
-	json.NewEncoder(w).Encode(AuthResponse{Token: tokenString})
+	json.NewEncoder(w).Encode(AuthResponse{
+		Token:        accessToken,
+		RefreshToken: refreshToken,
+		ExpiresAt:    expiresAt,
+	})
+}
+
+func (h *AuthHandler) Logout(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(middleware.UserIDKey).(int64)
+	sessionID := r.Context().Value(middleware.SessionIDKey).(string)
+	if err := h.DB.RevokeSession(r.Context(), sessionID); err != nil {
+		problem.Internal(w)
+		return
+	}
+	recordEvent(r, h.DB, userID, database.AuditLogout, nil)
+
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "Logged out",
+	})
+}
+
+func (h *AuthHandler) LogoutAll(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(middleware.UserIDKey).(int64)
+	if err := h.DB.RevokeUserSessions(r.Context(), userID); err != nil {
+		problem.Internal(w)
+		return
+	}
+	recordEvent(r, h.DB, userID, database.AuditLogoutAll, nil)
+
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "Logged out of all sessions",
+	})
+}
+
+// startSession creates a new session family for the user and returns its
+// first access/refresh token pair.
+func (h *AuthHandler) startSession(r *http.Request, userID int64) (*AuthResponse, error) {
+	ctx := r.Context()
+	sessionID := uuid.NewString()
+	refreshToken, refreshHash, err := auth.NewRefreshToken(sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := h.DB.CreateSession(ctx, sessionID, userID, refreshHash, sessionDevice(r), auth.RefreshTokenTTL); err != nil {
+		return nil, err
+	}
+
+	accessToken, expiresAt, err := h.Keys.NewAccessToken(userID, sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &AuthResponse{
+		Token:        accessToken,
+		RefreshToken: refreshToken,
+		ExpiresAt:    expiresAt,
+	}, nil
 }
 
 func (h *AuthHandler) Me(w http.ResponseWriter, r *http.Request) {
 	userID := r.Context().Value(middleware.UserIDKey).(int64)
 	user, err := h.DB.GetUserByID(r.Context(), userID)
 	if err != nil {
-		http.Error(w, "User not found", http.StatusNotFound)
+		problem.Write(w, problem.CodeNotFound, "User not found")
 		return
 	}
 	if user == nil {
-		http.Error(w, "User not found", http.StatusNotFound)
+		problem.Write(w, problem.CodeNotFound, "User not found")
 		return
 	}
 
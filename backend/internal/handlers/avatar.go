@@ -0,0 +1,145 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/bit2swaz/junto/internal/avatar"
+	"github.com/bit2swaz/junto/internal/database"
+	"github.com/bit2swaz/junto/internal/middleware"
+	"github.com/bit2swaz/junto/internal/problem"
+	"github.com/bit2swaz/junto/internal/validate"
+)
+
+// AvatarSVG and AvatarPNG draw a user's avatar ?size= pixels square from
+// their avatar_config, or their default avatar if they never set one.
+// Only the user and the rest of their couple can see it.
+func (h *ProfileHandler) AvatarSVG(w http.ResponseWriter, r *http.Request) {
+	h.serveAvatar(w, r, "svg")
+}
+
+func (h *ProfileHandler) AvatarPNG(w http.ResponseWriter, r *http.Request) {
+	h.serveAvatar(w, r, "png")
+}
+
+func (h *ProfileHandler) serveAvatar(w http.ResponseWriter, r *http.Request, format string) {
+	id, ok := pathID(w, r, "User not found")
+	if !ok {
+		return
+	}
+	size, ok := avatarSize(w, r)
+	if !ok {
+		return
+	}
+	user, ok := h.visibleUser(w, r, id)
+	if !ok {
+		return
+	}
+
+	config := avatar.Default(user.ID)
+	if user.AvatarConfig != nil {
+		parsed, err := avatar.Parse(user.AvatarConfig)
+		if err != nil {
+			log.Printf("stored avatar_config of user %d is invalid: %v", user.ID, err)
+		} else {
+			config = parsed
+		}
+	}
+
+	// The avatar changes whenever the config does, so browsers keep it but
+	// check back each time
+	etag, err := avatarETag(config, format, size)
+	if err != nil {
+		problem.Internal(w)
+		return
+	}
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", "private, no-cache")
+	if etagMatches(r.Header.Get("If-None-Match"), etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	if format == "svg" {
+		w.Header().Set("Content-Type", "image/svg+xml")
+		w.Write(avatar.SVG(config, size))
+		return
+	}
+	png, err := avatar.PNG(config, size)
+	if err != nil {
+		problem.Internal(w)
+		return
+	}
+	w.Header().Set("Content-Type", "image/png")
+	w.Write(png)
+}
+
+// avatarSize reads ?size=, which defaults to avatar.DefaultSize.
+func avatarSize(w http.ResponseWriter, r *http.Request) (int, bool) {
+	param := r.URL.Query().Get("size")
+	if param == "" {
+		return avatar.DefaultSize, true
+	}
+	size, err := strconv.Atoi(param)
+	if err != nil || size < avatar.MinSize || size > avatar.MaxSize {
+		problem.Invalid(w, validate.Errors{{Field: "size", Message: fmt.Sprintf("must be between %d and %d", avatar.MinSize, avatar.MaxSize)}})
+		return 0, false
+	}
+	return size, true
+}
+
+// visibleUser loads user id if the caller is them or in the same couple.
+// Anyone else gets the same 404 as for a user who doesn't exist.
+func (h *ProfileHandler) visibleUser(w http.ResponseWriter, r *http.Request, id int64) (*database.User, bool) {
+	userID := r.Context().Value(middleware.UserIDKey).(int64)
+
+	user, err := h.DB.GetUserByID(r.Context(), id)
+	if err != nil {
+		problem.Internal(w)
+		return nil, false
+	}
+	if user != nil && id != userID {
+		viewer, err := h.DB.GetUserByID(r.Context(), userID)
+		if err != nil {
+			problem.Internal(w)
+			return nil, false
+		}
+		if viewer == nil || viewer.CoupleID == nil || user.CoupleID == nil || *viewer.CoupleID != *user.CoupleID {
+			user = nil
+		}
+	}
+	if user == nil {
+		problem.Write(w, problem.CodeNotFound, "User not found")
+		return nil, false
+	}
+	return user, true
+}
+
+// avatarETag identifies a rendering of config; it is the same for the
+// same config, format and size until avatar.RenderVersion changes.
+func avatarETag(config *avatar.Config, format string, size int) (string, error) {
+	data, err := json.Marshal(config)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(fmt.Appendf(nil, "%d|%s|%d|%s", avatar.RenderVersion, format, size, data))
+	return strconv.Quote(hex.EncodeToString(sum[:16])), nil
+}
+
+// etagMatches reports whether an If-None-Match header lists etag. Weak and
+// strong tags compare equal, as RFC 9110 asks for If-None-Match.
+func etagMatches(header, etag string) bool {
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+		if tag == etag || tag == "*" {
+			return true
+		}
+	}
+	return false
+}
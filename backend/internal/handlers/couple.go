@@ -3,81 +3,178 @@ package handlers
 import (
 	"encoding/json"
 	"fmt"
-	"math/rand"
 	"net/http"
 	"strconv"
 	"time"
 
 	"github.com/bit2swaz/junto/internal/database"
 	"github.com/bit2swaz/junto/internal/middleware"
+	"github.com/bit2swaz/junto/internal/problem"
+	"github.com/bit2swaz/junto/internal/validate"
+	"github.com/bit2swaz/junto/internal/websocket"
 )
 
 type CoupleHandler struct {
-	DB database.Service
+	DB  database.Service
+	Hub *websocket.Hub
 }
 
+// LinkPartnerRequest redeems an invite by its code or, from an invite
+// link, its token.
 type LinkPartnerRequest struct {
-	Code string `json:"code"`
+	Code  string `json:"code"`
+	Token string `json:"token"`
+}
+
+func (req LinkPartnerRequest) Validate() error {
+	var v validate.Validator
+	if req.Token == "" {
+		v.Required("code", req.Code)
+	}
+	return v.Err()
 }
 
 func (h *CoupleHandler) GeneratePairingCode(w http.ResponseWriter, r *http.Request) {
 	userID := r.Context().Value(middleware.UserIDKey).(int64)
+	if !h.checkCanInvite(w, r, userID) {
+		return
+	}
 
-	// Generate 6-digit code
-	rng := rand.New(rand.NewSource(time.Now().UnixNano()))
-	code := fmt.Sprintf("%06d", rng.Intn(1000000))
-
-	// Store in Redis with 10 minute expiration
-	key := fmt.Sprintf("pairing:%s", code)
-	err := h.DB.GetRedis().Set(r.Context(), key, userID, 10*time.Minute).Err()
+	// Generating a new invite revokes the previous one
+	invite, err := newPairingInvite(r.Context(), h.DB, userID)
 	if err != nil {
-		http.Error(w, "Failed to generate code", http.StatusInternalServerError)
+		problem.Internal(w)
 		return
 	}
+	recordEvent(r, h.DB, userID, database.AuditPairingCodeCreated, nil)
 
-	json.NewEncoder(w).Encode(map[string]string{
-		"code": code,
-	})
+	json.NewEncoder(w).Encode(pairingInviteResponse(invite))
 }
 
 func (h *CoupleHandler) LinkPartner(w http.ResponseWriter, r *http.Request) {
 	currentUserID := r.Context().Value(middleware.UserIDKey).(int64)
 
 	var req LinkPartnerRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+	if !decodeJSON(w, r, &req) {
 		return
 	}
 
-	// Retrieve partner ID from Redis
-	key := fmt.Sprintf("pairing:%s", req.Code)
-	val, err := h.DB.GetRedis().Get(r.Context(), key).Result()
+	limits := []limitedKey{
+		{linkUserPolicy, strconv.FormatInt(currentUserID, 10)},
+		{linkIPPolicy, clientIP(r)},
+	}
+	wait, err := checkLimits(r.Context(), h.DB.GetRedis(), limits...)
 	if err != nil {
-		http.Error(w, "Invalid or expired code", http.StatusBadRequest)
+		problem.Internal(w)
+		return
+	}
+	if wait > 0 {
+		tooManyAttempts(w, wait)
 		return
 	}
 
-	partnerID, err := strconv.ParseInt(val, 10, 64)
+	if !h.checkUnpaired(w, r, currentUserID, "You are already in a couple") {
+		return
+	}
+
+	// Claiming uses the code up, so of two concurrent redeemers only one
+	// gets a partner ID back
+	claim := h.DB.ClaimPairingCode
+	secret := req.Code
+	if req.Token != "" {
+		claim, secret = h.DB.ClaimPairingToken, req.Token
+	}
+	partnerID, err := claim(r.Context(), secret, currentUserID)
 	if err != nil {
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		problem.Internal(w)
+		return
+	}
+	if partnerID == 0 {
+		wait, err := failLimits(r.Context(), h.DB.GetRedis(), limits...)
+		if err != nil {
+			problem.Internal(w)
+			return
+		}
+		if wait > 0 {
+			tooManyAttempts(w, wait)
+			return
+		}
+		problem.Write(w, problem.CodeInvalidOrExpired, "Invalid or expired code")
 		return
 	}
 
 	if partnerID == currentUserID {
-		http.Error(w, "Cannot link with yourself", http.StatusBadRequest)
+		problem.Write(w, problem.CodeSelfLink, "")
+		return
+	}
+	if !h.checkCanInvite(w, r, partnerID) {
 		return
 	}
 
-	// Create couple
-	couple, err := h.DB.CreateCouple(r.Context(), partnerID, currentUserID)
+	// The owner still has to accept; see AcceptPairingRequest
+	request, err := h.DB.CreatePairingRequest(r.Context(), partnerID, currentUserID, time.Now().Add(PairingRequestTTL))
 	if err != nil {
-		http.Error(w, "Failed to create couple", http.StatusInternalServerError)
+		problem.Internal(w)
 		return
 	}
 
-	// Delete code from Redis
-	h.DB.GetRedis().Del(r.Context(), key)
+	resetLimit(r.Context(), h.DB.GetRedis(), limits[0])
+	recordEvent(r, h.DB, currentUserID, database.AuditPairingRequested, map[string]interface{}{"request_id": request.ID, "owner_id": partnerID})
+	h.Hub.SendToUser(partnerID, map[string]interface{}{
+		"type":    websocket.MessagePairingRequested,
+		"request": request,
+	})
+
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(request)
+}
+
+// checkUnpaired answers 409 with detail if the user is already in a couple.
+func (h *CoupleHandler) checkUnpaired(w http.ResponseWriter, r *http.Request, userID int64, detail string) bool {
+	user, err := h.DB.GetUserByID(r.Context(), userID)
+	if err != nil {
+		problem.Internal(w)
+		return false
+	}
+	if user == nil {
+		problem.Write(w, problem.CodeNotFound, "User not found")
+		return false
+	}
+	if user.CoupleID != nil {
+		problem.Write(w, problem.CodeAlreadyPaired, detail)
+		return false
+	}
+	return true
+}
 
-	w.WriteHeader(http.StatusCreated)
-	json.NewEncoder(w).Encode(couple)
+// checkCanInvite answers 409 unless the user is unpaired, or owns a couple
+// with room for another member.
+func (h *CoupleHandler) checkCanInvite(w http.ResponseWriter, r *http.Request, userID int64) bool {
+	user, err := h.DB.GetUserByID(r.Context(), userID)
+	if err != nil {
+		problem.Internal(w)
+		return false
+	}
+	if user == nil {
+		problem.Write(w, problem.CodeNotFound, "User not found")
+		return false
+	}
+	if user.CoupleID == nil {
+		return true
+	}
+
+	couple, err := h.DB.GetCoupleByID(r.Context(), *user.CoupleID)
+	if err != nil || couple == nil {
+		problem.Internal(w)
+		return false
+	}
+	if couple.RoleOf(userID) != database.MemberRoleOwner {
+		problem.Write(w, problem.CodeAlreadyPaired, "Only the couple's owner can invite new members")
+		return false
+	}
+	if len(couple.ActiveMemberIDs()) >= database.MaxCoupleMembers {
+		problem.Write(w, problem.CodeConflict, fmt.Sprintf("The couple already has %d members", database.MaxCoupleMembers))
+		return false
+	}
+	return true
 }
@@ -0,0 +1,156 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/bit2swaz/junto/internal/database"
+	"github.com/bit2swaz/junto/internal/middleware"
+	"github.com/bit2swaz/junto/internal/problem"
+	"github.com/bit2swaz/junto/internal/validate"
+	"github.com/bit2swaz/junto/internal/websocket"
+)
+
+// Bounds on the couple profile.
+const (
+	maxCoupleDisplayNameLength = 100
+	maxCoverImageURLLength     = 2048
+	maxCouplePreferencesBytes  = 16 << 10
+)
+
+const dateLayout = "2006-01-02"
+
+// CoupleProfileRequest changes only the fields it includes. An empty date
+// clears it; see database.CoupleProfileUpdate for how preferences merge.
+type CoupleProfileRequest struct {
+	DisplayName       *string         `json:"display_name"`
+	Anniversary       *string         `json:"anniversary"`
+	RelationshipStart *string         `json:"relationship_start"`
+	CoverImageURL     *string         `json:"cover_image_url"`
+	Preferences       json.RawMessage `json:"preferences"`
+}
+
+func (req CoupleProfileRequest) Validate() error {
+	var v validate.Validator
+	if req.DisplayName != nil {
+		v.MaxLength("display_name", *req.DisplayName, maxCoupleDisplayNameLength)
+	}
+	if req.Anniversary != nil && *req.Anniversary != "" {
+		_, err := time.Parse(dateLayout, *req.Anniversary)
+		v.Check(err == nil, "anniversary", "must be a date as YYYY-MM-DD")
+	}
+	if req.RelationshipStart != nil && *req.RelationshipStart != "" {
+		start, err := time.Parse(dateLayout, *req.RelationshipStart)
+		v.Check(err == nil, "relationship_start", "must be a date as YYYY-MM-DD")
+		v.Check(err != nil || !start.After(time.Now()), "relationship_start", "must not be in the future")
+	}
+	if req.CoverImageURL != nil && *req.CoverImageURL != "" {
+		u, err := url.Parse(*req.CoverImageURL)
+		v.Check(err == nil && (u.Scheme == "https" || u.Scheme == "http") && u.Host != "", "cover_image_url", "must be an http or https URL")
+		v.MaxLength("cover_image_url", *req.CoverImageURL, maxCoverImageURLLength)
+	}
+	if req.Preferences != nil {
+		v.Check(bytes.HasPrefix(bytes.TrimSpace(req.Preferences), []byte("{")), "preferences", "must be an object")
+		v.Check(len(req.Preferences) <= maxCouplePreferencesBytes, "preferences", "is too large")
+	}
+	return v.Err()
+}
+
+func (req CoupleProfileRequest) update() database.CoupleProfileUpdate {
+	return database.CoupleProfileUpdate{
+		DisplayName:       req.DisplayName,
+		Anniversary:       req.Anniversary,
+		RelationshipStart: req.RelationshipStart,
+		CoverImageURL:     req.CoverImageURL,
+		Preferences:       req.Preferences,
+	}
+}
+
+// profileETag names a profile version; clients send it back in If-Match.
+func profileETag(version int64) string {
+	return strconv.Quote(strconv.FormatInt(version, 10))
+}
+
+// ifMatchVersion reads the version from an If-Match header that holds a
+// single strong ETag from profileETag.
+func ifMatchVersion(header string) (int64, bool) {
+	unquoted, err := strconv.Unquote(header)
+	if err != nil {
+		return 0, false
+	}
+	version, err := strconv.ParseInt(unquoted, 10, 64)
+	return version, err == nil
+}
+
+func (h *CoupleHandler) GetCoupleProfile(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(middleware.UserIDKey).(int64)
+	user, ok := h.coupledUser(w, r, userID)
+	if !ok {
+		return
+	}
+
+	profile, err := h.DB.GetCoupleProfile(r.Context(), *user.CoupleID)
+	if err != nil || profile == nil {
+		problem.Internal(w)
+		return
+	}
+	w.Header().Set("ETag", profileETag(profile.Version))
+	json.NewEncoder(w).Encode(profile)
+}
+
+// UpdateCoupleProfile requires the ETag of the profile the change was based
+// on in If-Match. If another member changed it in the meantime the update
+// is refused with 412 and the current ETag, and the client should fetch
+// the profile again and reapply its change. Everyone else in the couple
+// gets the new profile over the hub.
+func (h *CoupleHandler) UpdateCoupleProfile(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(middleware.UserIDKey).(int64)
+
+	var req CoupleProfileRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	user, ok := h.coupledUser(w, r, userID)
+	if !ok {
+		return
+	}
+
+	ifMatch := r.Header.Get("If-Match")
+	if ifMatch == "" {
+		problem.Write(w, problem.CodePreconditionRequired, "Send the profile's ETag in If-Match")
+		return
+	}
+	version, ok := ifMatchVersion(ifMatch)
+	if !ok {
+		problem.Write(w, problem.CodePreconditionFailed, "If-Match is not a profile ETag")
+		return
+	}
+
+	profile, err := h.DB.UpdateCoupleProfile(r.Context(), *user.CoupleID, userID, version, req.update())
+	if err != nil {
+		problem.Internal(w)
+		return
+	}
+	if profile == nil {
+		current, err := h.DB.GetCoupleProfile(r.Context(), *user.CoupleID)
+		if err != nil || current == nil {
+			problem.Internal(w)
+			return
+		}
+		w.Header().Set("ETag", profileETag(current.Version))
+		problem.Write(w, problem.CodePreconditionFailed, "The profile was changed by someone else; fetch it and try again")
+		return
+	}
+
+	h.Hub.BroadcastToCouple(profile.CoupleID, map[string]interface{}{
+		"type":    websocket.MessageCoupleProfileUpdated,
+		"profile": profile,
+	}, userID)
+
+	w.Header().Set("ETag", profileETag(profile.Version))
+	json.NewEncoder(w).Encode(profile)
+}
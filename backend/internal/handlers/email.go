@@ -0,0 +1,37 @@
+package handlers
+
+import (
+	"errors"
+	"net/mail"
+	"strings"
+
+	"github.com/bit2swaz/junto/internal/validate"
+)
+
+var errInvalidEmail = errors.New("invalid email address")
+
+// normalizeEmail checks that email is a bare address (no display name) and
+// returns its canonical, lower-cased form.
+func normalizeEmail(email string) (string, error) {
+	email = strings.TrimSpace(email)
+	if email == "" || len(email) > 254 {
+		return "", errInvalidEmail
+	}
+
+	addr, err := mail.ParseAddress(email)
+	if err != nil || addr.Address != email {
+		return "", errInvalidEmail
+	}
+
+	local, domain, ok := strings.Cut(addr.Address, "@")
+	if !ok || local == "" || !strings.Contains(domain, ".") {
+		return "", errInvalidEmail
+	}
+
+	return strings.ToLower(addr.Address), nil
+}
+
+func checkEmail(v *validate.Validator, field, email string) {
+	_, err := normalizeEmail(email)
+	v.Check(err == nil, field, "must be a valid email address")
+}
@@ -0,0 +1,95 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/bit2swaz/junto/internal/auth"
+	"github.com/bit2swaz/junto/internal/database"
+	"github.com/bit2swaz/junto/internal/mailer"
+	"github.com/bit2swaz/junto/internal/middleware"
+	"github.com/bit2swaz/junto/internal/problem"
+	"github.com/bit2swaz/junto/internal/validate"
+)
+
+const emailVerificationTTL = 24 * time.Hour
+
+type VerifyEmailRequest struct {
+	Token string `json:"token"`
+}
+
+func (req VerifyEmailRequest) Validate() error {
+	var v validate.Validator
+	v.Required("token", req.Token)
+	return v.Err()
+}
+
+func (h *AuthHandler) sendVerificationEmail(ctx context.Context, user *database.User) error {
+	token, err := auth.RandomToken(32)
+	if err != nil {
+		return err
+	}
+	if err := h.DB.CreateEmailVerification(ctx, auth.HashToken(token), user.ID, emailVerificationTTL); err != nil {
+		return err
+	}
+
+	link := fmt.Sprintf("%s/verify-email?token=%s", appURL(), url.QueryEscape(token))
+	return h.Mailer.Send(ctx, mailer.Message{
+		To:      user.Email,
+		Subject: "Confirm your Junto email",
+		Body:    fmt.Sprintf("Welcome to Junto!\n\nConfirm your email address to start pairing with your partner:\n%s\n\nThis link is valid for 24 hours.", link),
+	})
+}
+
+func (h *AuthHandler) ResendVerification(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(middleware.UserIDKey).(int64)
+	user, err := h.DB.GetUserByID(r.Context(), userID)
+	if err != nil || user == nil {
+		problem.Write(w, problem.CodeNotFound, "User not found")
+		return
+	}
+	if user.EmailVerifiedAt != nil {
+		problem.Write(w, problem.CodeEmailAlreadyVerified, "")
+		return
+	}
+
+	if err := h.sendVerificationEmail(r.Context(), user); err != nil {
+		problem.Internal(w)
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "Verification email sent",
+	})
+}
+
+func (h *AuthHandler) VerifyEmail(w http.ResponseWriter, r *http.Request) {
+	var req VerifyEmailRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+
+	userID, err := h.DB.ConsumeEmailVerification(r.Context(), auth.HashToken(req.Token))
+	if err != nil {
+		problem.Internal(w)
+		return
+	}
+	if userID == 0 {
+		problem.Write(w, problem.CodeInvalidOrExpired, "Invalid or expired token")
+		return
+	}
+
+	if err := h.DB.MarkEmailVerified(r.Context(), userID); err != nil {
+		problem.Internal(w)
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "Email verified",
+	})
+}
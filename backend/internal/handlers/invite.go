@@ -0,0 +1,150 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/bit2swaz/junto/internal/auth"
+	"github.com/bit2swaz/junto/internal/database"
+	"github.com/bit2swaz/junto/internal/middleware"
+	"github.com/bit2swaz/junto/internal/problem"
+	qrcode "github.com/skip2/go-qrcode"
+)
+
+// PairingInviteTTL is how long a pairing code and its invite link work.
+const PairingInviteTTL = 10 * time.Minute
+
+// qrPNGSize is the edge length of rendered QR PNGs in pixels.
+const qrPNGSize = 320
+
+// PairingInviteResponse is an invite along with the link that redeems it.
+type PairingInviteResponse struct {
+	database.PairingInvite
+	URL string `json:"invite_url"`
+}
+
+// pairingInviteAttempts bounds how many codes newPairingInvite tries before
+// giving up; each only collides with an outstanding invite.
+const pairingInviteAttempts = 5
+
+// newPairingInvite stores a fresh invite for userID, revoking the one before
+// it. Codes are short enough to collide with another user's outstanding
+// one, so it keeps generating until it finds a free one.
+func newPairingInvite(ctx context.Context, db database.Service, userID int64) (database.PairingInvite, error) {
+	for range pairingInviteAttempts {
+		code, err := auth.NewPairingCode()
+		if err != nil {
+			return database.PairingInvite{}, err
+		}
+		token, err := auth.NewPairingToken()
+		if err != nil {
+			return database.PairingInvite{}, err
+		}
+		invite := database.PairingInvite{Code: code, Token: token, ExpiresAt: time.Now().Add(PairingInviteTTL)}
+		created, err := db.CreatePairingInvite(ctx, userID, invite)
+		if err != nil {
+			return database.PairingInvite{}, err
+		}
+		if created {
+			return invite, nil
+		}
+	}
+	return database.PairingInvite{}, errors.New("no free pairing code")
+}
+
+func pairingInviteResponse(invite database.PairingInvite) PairingInviteResponse {
+	return PairingInviteResponse{PairingInvite: invite, URL: inviteURL(invite.Token)}
+}
+
+// inviteURL points at the frontend page that redeems token.
+func inviteURL(token string) string {
+	return fmt.Sprintf("%s/pair?token=%s", appURL(), url.QueryEscape(token))
+}
+
+// GetPairingInvite returns the user's outstanding invite.
+func (h *CoupleHandler) GetPairingInvite(w http.ResponseWriter, r *http.Request) {
+	invite, ok := h.currentInvite(w, r)
+	if !ok {
+		return
+	}
+	json.NewEncoder(w).Encode(pairingInviteResponse(*invite))
+}
+
+// PairingInviteQRPNG and PairingInviteQRSVG render the user's invite link
+// as a QR code for their partner to scan.
+func (h *CoupleHandler) PairingInviteQRPNG(w http.ResponseWriter, r *http.Request) {
+	q, ok := h.inviteQR(w, r)
+	if !ok {
+		return
+	}
+	png, err := q.PNG(qrPNGSize)
+	if err != nil {
+		problem.Internal(w)
+		return
+	}
+	w.Header().Set("Content-Type", "image/png")
+	w.Write(png)
+}
+
+func (h *CoupleHandler) PairingInviteQRSVG(w http.ResponseWriter, r *http.Request) {
+	q, ok := h.inviteQR(w, r)
+	if !ok {
+		return
+	}
+	w.Header().Set("Content-Type", "image/svg+xml")
+	w.Write(qrSVG(q.Bitmap()))
+}
+
+func (h *CoupleHandler) inviteQR(w http.ResponseWriter, r *http.Request) (*qrcode.QRCode, bool) {
+	invite, ok := h.currentInvite(w, r)
+	if !ok {
+		return nil, false
+	}
+	q, err := qrcode.New(inviteURL(invite.Token), qrcode.Medium)
+	if err != nil {
+		problem.Internal(w)
+		return nil, false
+	}
+	// The image carries a live invite
+	w.Header().Set("Cache-Control", "no-store")
+	return q, true
+}
+
+func (h *CoupleHandler) currentInvite(w http.ResponseWriter, r *http.Request) (*database.PairingInvite, bool) {
+	userID := r.Context().Value(middleware.UserIDKey).(int64)
+
+	invite, err := h.DB.GetPairingInvite(r.Context(), userID)
+	if err != nil {
+		problem.Internal(w)
+		return nil, false
+	}
+	if invite == nil {
+		problem.Write(w, problem.CodeNotFound, "No outstanding invite")
+		return nil, false
+	}
+	return invite, true
+}
+
+// qrSVG draws each dark module as a unit square; the bitmap already
+// includes the quiet zone.
+func qrSVG(bitmap [][]bool) []byte {
+	var b bytes.Buffer
+	n := len(bitmap)
+	fmt.Fprintf(&b, `<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 %d %d" shape-rendering="crispEdges">`, n, n)
+	fmt.Fprintf(&b, `<rect width="%d" height="%d" fill="#fff"/><path fill="#000" d="`, n, n)
+	for y, row := range bitmap {
+		for x, dark := range row {
+			if dark {
+				fmt.Fprintf(&b, "M%d %dh1v1h-1z", x, y)
+			}
+		}
+	}
+	b.WriteString(`"/></svg>`)
+	return b.Bytes()
+}
@@ -0,0 +1,20 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/bit2swaz/junto/internal/auth"
+)
+
+type JWKSHandler struct {
+	Keys *auth.KeyManager
+}
+
+// ServeJWKS publishes the public signing keys so other services can verify
+// Junto tokens without sharing a secret.
+func (h *JWKSHandler) ServeJWKS(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	json.NewEncoder(w).Encode(h.Keys.JWKS())
+}
@@ -0,0 +1,99 @@
+package handlers
+
+import (
+	"context"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/bit2swaz/junto/internal/problem"
+	"github.com/bit2swaz/junto/internal/ratelimit"
+	"github.com/redis/go-redis/v9"
+)
+
+var (
+	loginAccountPolicy = ratelimit.Policy{
+		Name:        "login_account",
+		MaxAttempts: 5,
+		Window:      time.Hour,
+		BaseDelay:   30 * time.Second,
+		MaxDelay:    time.Hour,
+	}
+	loginIPPolicy = ratelimit.Policy{
+		Name:        "login_ip",
+		MaxAttempts: 20,
+		Window:      time.Hour,
+		BaseDelay:   time.Minute,
+		MaxDelay:    time.Hour,
+	}
+	// Pairing codes are only six digits, so guessing is cut off much sooner.
+	linkUserPolicy = ratelimit.Policy{
+		Name:        "link_user",
+		MaxAttempts: 3,
+		Window:      time.Hour,
+		BaseDelay:   time.Minute,
+		MaxDelay:    24 * time.Hour,
+	}
+	linkIPPolicy = ratelimit.Policy{
+		Name:        "link_ip",
+		MaxAttempts: 10,
+		Window:      time.Hour,
+		BaseDelay:   5 * time.Minute,
+		MaxDelay:    24 * time.Hour,
+	}
+)
+
+type limitedKey struct {
+	policy ratelimit.Policy
+	key    string
+}
+
+// checkLimits reports the longest remaining lockout among keys.
+func checkLimits(ctx context.Context, rdb *redis.Client, keys ...limitedKey) (time.Duration, error) {
+	var longest time.Duration
+	for _, k := range keys {
+		wait, err := ratelimit.New(rdb, k.policy).Check(ctx, k.key)
+		if err != nil {
+			return 0, err
+		}
+		if wait > longest {
+			longest = wait
+		}
+	}
+	return longest, nil
+}
+
+func failLimits(ctx context.Context, rdb *redis.Client, keys ...limitedKey) (time.Duration, error) {
+	var longest time.Duration
+	for _, k := range keys {
+		wait, err := ratelimit.New(rdb, k.policy).Fail(ctx, k.key)
+		if err != nil {
+			return 0, err
+		}
+		if wait > longest {
+			longest = wait
+		}
+	}
+	return longest, nil
+}
+
+func resetLimit(ctx context.Context, rdb *redis.Client, k limitedKey) error {
+	return ratelimit.New(rdb, k.policy).Reset(ctx, k.key)
+}
+
+func tooManyAttempts(w http.ResponseWriter, wait time.Duration) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+	problem.Write(w, problem.CodeTooManyRequests, "Try again later")
+}
+
+// clientIP uses the TCP peer address. Forwarded headers are ignored because
+// they are client-controlled unless a trusted proxy rewrites them.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,321 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/bit2swaz/junto/internal/auth"
+	"github.com/bit2swaz/junto/internal/database"
+	"github.com/bit2swaz/junto/internal/middleware"
+	"github.com/bit2swaz/junto/internal/problem"
+	"github.com/bit2swaz/junto/internal/validate"
+)
+
+const (
+	totpIssuer        = "Junto"
+	recoveryCodeCount = 10
+	// maxMFAAttempts bounds how many codes can be tried with one mfa token.
+	maxMFAAttempts = 5
+)
+
+type TOTPEnrollmentResponse struct {
+	Secret        string   `json:"secret"`
+	OTPAuthURI    string   `json:"otpauth_uri"`
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+type TOTPCodeRequest struct {
+	Code string `json:"code"`
+}
+
+func (req TOTPCodeRequest) Validate() error {
+	var v validate.Validator
+	v.Required("code", req.Code)
+	return v.Err()
+}
+
+type MFALoginRequest struct {
+	MFAToken     string `json:"mfa_token"`
+	Code         string `json:"code,omitempty"`
+	RecoveryCode string `json:"recovery_code,omitempty"`
+}
+
+func (req MFALoginRequest) Validate() error {
+	var v validate.Validator
+	v.Required("mfa_token", req.MFAToken)
+	v.Check(req.Code != "" || req.RecoveryCode != "", "code", "is required")
+	return v.Err()
+}
+
+type MFAChallengeResponse struct {
+	MFARequired bool      `json:"mfa_required"`
+	MFAToken    string    `json:"mfa_token"`
+	ExpiresAt   time.Time `json:"expires_at"`
+}
+
+// EnrollTOTP generates a new secret and recovery codes. The factor is not
+// enforced until the user proves their app works via ConfirmTOTP.
+func (h *AuthHandler) EnrollTOTP(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(middleware.UserIDKey).(int64)
+
+	user, err := h.DB.GetUserByID(r.Context(), userID)
+	if err != nil || user == nil {
+		problem.Write(w, problem.CodeNotFound, "User not found")
+		return
+	}
+
+	existing, err := h.DB.GetUserMFA(r.Context(), userID)
+	if err != nil {
+		problem.Internal(w)
+		return
+	}
+	if existing != nil && existing.EnabledAt != nil {
+		problem.Write(w, problem.CodeMFAAlreadyEnabled, "")
+		return
+	}
+
+	secret, err := auth.GenerateTOTPSecret()
+	if err != nil {
+		problem.Internal(w)
+		return
+	}
+	encrypted, err := auth.EncryptSecret(secret)
+	if err != nil {
+		problem.Internal(w)
+		return
+	}
+	codes, err := auth.GenerateRecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		problem.Internal(w)
+		return
+	}
+	hashes := make([]string, len(codes))
+	for i, code := range codes {
+		hashes[i] = auth.HashRecoveryCode(code)
+	}
+
+	if err := h.DB.SaveUserMFA(r.Context(), userID, encrypted, hashes); err != nil {
+		problem.Internal(w)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(TOTPEnrollmentResponse{
+		Secret:        auth.EncodeTOTPSecret(secret),
+		OTPAuthURI:    auth.TOTPURI(secret, user.Email, totpIssuer),
+		RecoveryCodes: codes,
+	})
+}
+
+func (h *AuthHandler) ConfirmTOTP(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(middleware.UserIDKey).(int64)
+
+	var req TOTPCodeRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+
+	mfa, err := h.DB.GetUserMFA(r.Context(), userID)
+	if err != nil {
+		problem.Internal(w)
+		return
+	}
+	if mfa == nil {
+		problem.Write(w, problem.CodeMFANotEnrolled, "")
+		return
+	}
+	if mfa.EnabledAt != nil {
+		problem.Write(w, problem.CodeMFAAlreadyEnabled, "")
+		return
+	}
+
+	ok, err := h.checkTOTP(r.Context(), userID, mfa.TOTPSecretEncrypted, req.Code)
+	if err != nil {
+		problem.Internal(w)
+		return
+	}
+	if !ok {
+		problem.Write(w, problem.CodeInvalidCode, "")
+		return
+	}
+
+	if err := h.DB.EnableUserMFA(r.Context(), userID); err != nil {
+		problem.Internal(w)
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "Two-factor authentication enabled",
+	})
+}
+
+func (h *AuthHandler) DisableTOTP(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(middleware.UserIDKey).(int64)
+
+	var req TOTPCodeRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+
+	mfa, err := h.DB.GetUserMFA(r.Context(), userID)
+	if err != nil {
+		problem.Internal(w)
+		return
+	}
+	if mfa == nil {
+		problem.Write(w, problem.CodeMFANotEnabled, "")
+		return
+	}
+
+	ok, err := h.checkTOTP(r.Context(), userID, mfa.TOTPSecretEncrypted, req.Code)
+	if err != nil {
+		problem.Internal(w)
+		return
+	}
+	if !ok {
+		problem.Write(w, problem.CodeInvalidCode, "")
+		return
+	}
+
+	if err := h.DB.DeleteUserMFA(r.Context(), userID); err != nil {
+		problem.Internal(w)
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "Two-factor authentication disabled",
+	})
+}
+
+// LoginTOTP completes a login started by Login for an account with MFA.
+func (h *AuthHandler) LoginTOTP(w http.ResponseWriter, r *http.Request) {
+	h.completeMFALogin(w, r, loginMethodTOTP, func(ctx context.Context, userID int64, req MFALoginRequest) (bool, error) {
+		mfa, err := h.DB.GetUserMFA(ctx, userID)
+		if err != nil || mfa == nil || mfa.EnabledAt == nil {
+			return false, err
+		}
+		return h.checkTOTP(ctx, userID, mfa.TOTPSecretEncrypted, req.Code)
+	})
+}
+
+func (h *AuthHandler) LoginRecoveryCode(w http.ResponseWriter, r *http.Request) {
+	h.completeMFALogin(w, r, loginMethodRecoveryCode, func(ctx context.Context, userID int64, req MFALoginRequest) (bool, error) {
+		return h.DB.ConsumeRecoveryCode(ctx, userID, auth.HashRecoveryCode(req.RecoveryCode))
+	})
+}
+
+func (h *AuthHandler) completeMFALogin(w http.ResponseWriter, r *http.Request, method string, verify func(context.Context, int64, MFALoginRequest) (bool, error)) {
+	var req MFALoginRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+
+	claims, err := h.Keys.ParseMFAToken(req.MFAToken)
+	if err != nil {
+		problem.Write(w, problem.CodeInvalidToken, "Invalid or expired MFA token")
+		return
+	}
+
+	user, err := h.DB.GetUserByID(r.Context(), claims.UserID)
+	if err != nil || user == nil {
+		problem.Write(w, problem.CodeInvalidToken, "Invalid or expired MFA token")
+		return
+	}
+	if user.DisabledAt != nil {
+		problem.Write(w, problem.CodeAccountDisabled, "")
+		return
+	}
+	limits := []limitedKey{
+		{loginAccountPolicy, user.Email},
+		{loginIPPolicy, clientIP(r)},
+	}
+	wait, err := checkLimits(r.Context(), h.DB.GetRedis(), limits...)
+	if err != nil {
+		problem.Internal(w)
+		return
+	}
+	if wait > 0 {
+		tooManyAttempts(w, wait)
+		return
+	}
+
+	attemptsKey := fmt.Sprintf("mfa_attempts:%s", claims.ID)
+	attempts, err := h.DB.GetRedis().Incr(r.Context(), attemptsKey).Result()
+	if err != nil {
+		problem.Internal(w)
+		return
+	}
+	h.DB.GetRedis().Expire(r.Context(), attemptsKey, auth.MFATokenTTL)
+	if attempts > maxMFAAttempts {
+		problem.Write(w, problem.CodeTooManyRequests, "Log in again")
+		return
+	}
+
+	// The mfa token is spent once it has produced a session. It is claimed
+	// before the code is checked, so that of concurrent requests only one
+	// uses up its code (a recovery code is single-use), and given back if
+	// the code turns out to be wrong.
+	spentKey := fmt.Sprintf("mfa_spent:%s", claims.ID)
+	claimed, err := h.DB.GetRedis().SetNX(r.Context(), spentKey, 1, auth.MFATokenTTL).Result()
+	if err != nil {
+		problem.Internal(w)
+		return
+	}
+	if !claimed {
+		problem.Write(w, problem.CodeInvalidToken, "Invalid or expired MFA token")
+		return
+	}
+
+	ok, err := verify(r.Context(), claims.UserID, req)
+	if err != nil || !ok {
+		h.DB.GetRedis().Del(r.Context(), spentKey)
+	}
+	if err != nil {
+		problem.Internal(w)
+		return
+	}
+	if !ok {
+		recordEvent(r, h.DB, claims.UserID, database.AuditLoginFailed, map[string]interface{}{"method": method})
+		h.loginFailed(w, r, limits)
+		return
+	}
+
+	if err := resetLimit(r.Context(), h.DB.GetRedis(), limits[0]); err != nil {
+		problem.Internal(w)
+		return
+	}
+	h.DB.GetRedis().Set(r.Context(), attemptsKey, maxMFAAttempts+1, auth.MFATokenTTL)
+
+	resp, err := h.startSession(r, claims.UserID)
+	if err != nil {
+		problem.Internal(w)
+		return
+	}
+	recordEvent(r, h.DB, claims.UserID, database.AuditLogin, map[string]interface{}{"method": method})
+
+	json.NewEncoder(w).Encode(resp)
+}
+
+// checkTOTP validates a code and records its time step so the same code
+// cannot be replayed within its validity window.
+func (h *AuthHandler) checkTOTP(ctx context.Context, userID int64, secretEncrypted []byte, code string) (bool, error) {
+	secret, err := auth.DecryptSecret(secretEncrypted)
+	if err != nil {
+		return false, err
+	}
+
+	step, ok := auth.ValidateTOTP(secret, code, time.Now())
+	if !ok {
+		return false, nil
+	}
+
+	key := fmt.Sprintf("totp_used:%d:%d", userID, step)
+	fresh, err := h.DB.GetRedis().SetNX(ctx, key, 1, 3*time.Minute).Result()
+	if err != nil {
+		return false, err
+	}
+	return fresh, nil
+}
@@ -0,0 +1,187 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/bit2swaz/junto/internal/database"
+	"github.com/bit2swaz/junto/internal/oidc"
+	"github.com/bit2swaz/junto/internal/problem"
+	"github.com/bit2swaz/junto/internal/validate"
+	"github.com/go-chi/chi/v5"
+	"github.com/redis/go-redis/v9"
+)
+
+const oidcStateTTL = 10 * time.Minute
+
+type OIDCCallbackRequest struct {
+	Code  string `json:"code"`
+	State string `json:"state"`
+}
+
+func (req OIDCCallbackRequest) Validate() error {
+	var v validate.Validator
+	v.Required("code", req.Code)
+	v.Required("state", req.State)
+	return v.Err()
+}
+
+type OIDCStartResponse struct {
+	AuthorizationURL string `json:"authorization_url"`
+}
+
+// oidcState is what we remember between redirecting to the provider and
+// the user coming back, keyed by the state parameter.
+type oidcState struct {
+	Provider     string `json:"provider"`
+	Nonce        string `json:"nonce"`
+	CodeVerifier string `json:"code_verifier"`
+}
+
+func (h *AuthHandler) provider(w http.ResponseWriter, r *http.Request) (*oidc.Provider, bool) {
+	p, ok := h.Providers[chi.URLParam(r, "provider")]
+	if !ok {
+		problem.Write(w, problem.CodeNotFound, "Unknown identity provider")
+		return nil, false
+	}
+	return p, true
+}
+
+// StartOIDC begins an authorization code + PKCE login. The frontend sends
+// the user to the returned URL; the provider redirects back to the frontend,
+// which then posts code and state to OIDCCallback.
+func (h *AuthHandler) StartOIDC(w http.ResponseWriter, r *http.Request) {
+	p, ok := h.provider(w, r)
+	if !ok {
+		return
+	}
+
+	state, err := oidc.RandomString(32)
+	if err != nil {
+		problem.Internal(w)
+		return
+	}
+	nonce, err := oidc.RandomString(32)
+	if err != nil {
+		problem.Internal(w)
+		return
+	}
+	verifier, challenge, err := oidc.NewPKCE()
+	if err != nil {
+		problem.Internal(w)
+		return
+	}
+
+	authURL, err := p.AuthCodeURL(r.Context(), state, nonce, challenge)
+	if err != nil {
+		log.Printf("oidc %s: %v", p.Name(), err)
+		problem.Write(w, problem.CodeUpstreamUnavailable, "")
+		return
+	}
+
+	data, _ := json.Marshal(oidcState{Provider: p.Name(), Nonce: nonce, CodeVerifier: verifier})
+	if err := h.DB.GetRedis().Set(r.Context(), fmt.Sprintf("oidc_state:%s", state), data, oidcStateTTL).Err(); err != nil {
+		problem.Internal(w)
+		return
+	}
+
+	json.NewEncoder(w).Encode(OIDCStartResponse{AuthorizationURL: authURL})
+}
+
+func (h *AuthHandler) OIDCCallback(w http.ResponseWriter, r *http.Request) {
+	p, ok := h.provider(w, r)
+	if !ok {
+		return
+	}
+
+	var req OIDCCallbackRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+
+	// State is single-use: a replayed callback finds nothing
+	raw, err := h.DB.GetRedis().GetDel(r.Context(), fmt.Sprintf("oidc_state:%s", req.State)).Bytes()
+	if err != nil {
+		if err == redis.Nil {
+			problem.Write(w, problem.CodeInvalidOrExpired, "Invalid or expired state")
+			return
+		}
+		problem.Internal(w)
+		return
+	}
+	var state oidcState
+	if err := json.Unmarshal(raw, &state); err != nil || state.Provider != p.Name() {
+		problem.Write(w, problem.CodeInvalidOrExpired, "Invalid or expired state")
+		return
+	}
+
+	tokens, err := p.Exchange(r.Context(), req.Code, state.CodeVerifier)
+	if err != nil {
+		log.Printf("oidc %s: code exchange failed: %v", p.Name(), err)
+		problem.Write(w, problem.CodeIdentityLoginFailed, "")
+		return
+	}
+	claims, err := p.VerifyIDToken(r.Context(), tokens.IDToken, state.Nonce)
+	if err != nil {
+		problem.Write(w, problem.CodeIdentityLoginFailed, "")
+		return
+	}
+
+	user, err := h.DB.GetUserByIdentity(r.Context(), p.Name(), claims.Subject)
+	if err != nil {
+		problem.Internal(w)
+		return
+	}
+
+	if user == nil {
+		email, err := normalizeEmail(claims.Email)
+		if err != nil {
+			problem.Write(w, problem.CodeIdentityLoginFailed, "Identity provider did not share a valid email address")
+			return
+		}
+
+		existing, err := h.DB.GetUserByEmail(r.Context(), email)
+		if err != nil {
+			problem.Internal(w)
+			return
+		}
+
+		switch {
+		case existing == nil:
+			user, err = h.DB.CreateUserWithIdentity(r.Context(), email, p.Name(), claims.Subject, claims.EmailVerified)
+			if database.IsUniqueViolation(err) {
+				problem.Write(w, problem.CodeAccountExists, "An account with this email already exists; sign in with your password")
+				return
+			}
+			if err != nil {
+				problem.Internal(w)
+				return
+			}
+		case claims.EmailVerified && existing.EmailVerifiedAt != nil:
+			// Only link when both sides have proven ownership of the
+			// address, otherwise a pre-registered account could capture
+			// the victim's social login.
+			err := h.DB.CreateUserIdentity(r.Context(), existing.ID, p.Name(), claims.Subject, email)
+			if database.IsUniqueViolation(err) {
+				problem.Write(w, problem.CodeConflict, "This identity is already linked")
+				return
+			}
+			if err != nil {
+				problem.Internal(w)
+				return
+			}
+			user = existing
+		case claims.EmailVerified:
+			problem.Write(w, problem.CodeAccountExists, "An account with this email already exists; sign in with your password, or verify its email address to sign in with this provider")
+			return
+		default:
+			problem.Write(w, problem.CodeAccountExists, "An account with this email already exists and the provider has not verified this address; sign in with your password")
+			return
+		}
+	}
+
+	h.completeLogin(w, r, user, "oidc:"+p.Name())
+}
@@ -0,0 +1,131 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/bit2swaz/junto/internal/database"
+	"github.com/bit2swaz/junto/internal/middleware"
+	"github.com/bit2swaz/junto/internal/problem"
+	"github.com/bit2swaz/junto/internal/websocket"
+)
+
+// PairingRequestTTL is how long a code's owner has to answer a request
+// before it lapses and the requester has to ask for a new code.
+const PairingRequestTTL = 24 * time.Hour
+
+// ListPairingRequests returns the pending requests the user sent or has
+// to answer.
+func (h *CoupleHandler) ListPairingRequests(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(middleware.UserIDKey).(int64)
+
+	requests, err := h.DB.ListPairingRequests(r.Context(), userID)
+	if err != nil {
+		problem.Internal(w)
+		return
+	}
+	if requests == nil {
+		requests = []database.PairingRequest{}
+	}
+	json.NewEncoder(w).Encode(requests)
+}
+
+// AcceptPairingRequest links the code's owner with the requester, or brings
+// the requester into the owner's couple.
+func (h *CoupleHandler) AcceptPairingRequest(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(middleware.UserIDKey).(int64)
+	requestID, ok := pathID(w, r, "Pairing request not found")
+	if !ok {
+		return
+	}
+
+	// The membership constraint settles races with other links
+	request, couple, err := h.DB.AcceptPairingRequest(r.Context(), requestID, userID)
+	switch {
+	case database.IsUniqueViolation(err):
+		problem.Write(w, problem.CodeAlreadyPaired, "The requester is already in a couple")
+		return
+	case errors.Is(err, database.ErrCoupleFull):
+		problem.Write(w, problem.CodeConflict, "Your couple is full")
+		return
+	case errors.Is(err, database.ErrNotCoupleOwner):
+		problem.Write(w, problem.CodeForbidden, "Only your couple's owner can add members")
+		return
+	}
+	if err != nil {
+		problem.Internal(w)
+		return
+	}
+	if request == nil {
+		problem.Write(w, problem.CodeNotFound, "Pairing request not found")
+		return
+	}
+
+	// Both members get the event; the request details are the owner's
+	recordEvent(r, h.DB, userID, database.AuditCoupleLinked, map[string]interface{}{"couple_id": couple.ID, "partner_id": request.RequesterID, "initiated_by": request.RequesterID})
+	recordEvent(r, h.DB, request.RequesterID, database.AuditCoupleLinked, map[string]interface{}{"couple_id": couple.ID, "partner_id": userID, "initiated_by": request.RequesterID})
+	h.Hub.SendToUser(request.RequesterID, map[string]interface{}{
+		"type":    websocket.MessagePairingAccepted,
+		"request": request,
+		"couple":  couple,
+	})
+	h.notifyLinked(r, couple, request)
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(couple)
+}
+
+func (h *CoupleHandler) RejectPairingRequest(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(middleware.UserIDKey).(int64)
+	requestID, ok := pathID(w, r, "Pairing request not found")
+	if !ok {
+		return
+	}
+
+	request, err := h.DB.RejectPairingRequest(r.Context(), requestID, userID)
+	if err != nil {
+		problem.Internal(w)
+		return
+	}
+	if request == nil {
+		problem.Write(w, problem.CodeNotFound, "Pairing request not found")
+		return
+	}
+
+	recordEvent(r, h.DB, userID, database.AuditPairingRejected, map[string]interface{}{"request_id": request.ID, "requester_id": request.RequesterID})
+	h.Hub.SendToUser(request.RequesterID, map[string]interface{}{
+		"type":    websocket.MessagePairingRejected,
+		"request": request,
+	})
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// notifyLinked tells the hub about the couple's new member so they join its
+// room without reconnecting, and everyone learns who they are linked with.
+func (h *CoupleHandler) notifyLinked(r *http.Request, couple *database.Couple, request *database.PairingRequest) {
+	members, err := h.DB.ListCoupleUsers(r.Context(), couple.ID)
+	if err != nil {
+		log.Printf("failed to load couple %d members for hub: %v", couple.ID, err)
+		return
+	}
+	var joined, inviter *database.User
+	for i := range members {
+		switch members[i].ID {
+		case request.RequesterID:
+			joined = &members[i]
+		case request.OwnerID:
+			inviter = &members[i]
+		}
+	}
+	if joined == nil || inviter == nil {
+		log.Printf("couple %d lost a member before the hub heard of it", couple.ID)
+		return
+	}
+	// A new couple puts the inviter's socket in the room too
+	h.Hub.JoinRoom(couple.ID, inviter.ID)
+	h.Hub.MemberJoined(couple.ID, joined, inviter, members)
+}
@@ -0,0 +1,146 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/bit2swaz/junto/internal/auth"
+	"github.com/bit2swaz/junto/internal/mailer"
+	"github.com/bit2swaz/junto/internal/problem"
+	"github.com/bit2swaz/junto/internal/validate"
+)
+
+const passwordResetTTL = time.Hour
+
+type PasswordResetRequest struct {
+	Email string `json:"email"`
+}
+
+func (req PasswordResetRequest) Validate() error {
+	var v validate.Validator
+	checkEmail(&v, "email", req.Email)
+	return v.Err()
+}
+
+type PasswordResetConfirmRequest struct {
+	Token    string `json:"token"`
+	Password string `json:"password"`
+}
+
+func (req PasswordResetConfirmRequest) Validate() error {
+	var v validate.Validator
+	v.Required("token", req.Token)
+	checkPassword(&v, "password", req.Password)
+	return v.Err()
+}
+
+// appURL is the base URL of the frontend, used for links sent by email.
+func appURL() string {
+	if u := os.Getenv("APP_URL"); u != "" {
+		return u
+	}
+	return "http://localhost:3000"
+}
+
+// RequestPasswordReset always answers 202 so the endpoint cannot be used to
+// find out which emails have accounts. Failures are logged rather than
+// reported for the same reason, and the email is sent in the background so
+// the response takes as long whether or not there is one.
+func (h *AuthHandler) RequestPasswordReset(w http.ResponseWriter, r *http.Request) {
+	var req PasswordResetRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+
+	if err := h.startPasswordReset(r, req.Email); err != nil {
+		log.Printf("failed to start password reset: %v", err)
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "If the account exists, a reset email has been sent",
+	})
+}
+
+// startPasswordReset issues a reset token for the account with email, if
+// there is one, replacing any it was issued before, and mails it.
+func (h *AuthHandler) startPasswordReset(r *http.Request, email string) error {
+	email, _ = normalizeEmail(email)
+	user, err := h.DB.GetUserByEmail(r.Context(), email)
+	if err != nil || user == nil {
+		return err
+	}
+
+	token, err := auth.RandomToken(32)
+	if err != nil {
+		return err
+	}
+	if err := h.DB.CreatePasswordReset(r.Context(), auth.HashToken(token), user.ID, passwordResetTTL); err != nil {
+		return err
+	}
+
+	link := fmt.Sprintf("%s/reset-password?token=%s", appURL(), url.QueryEscape(token))
+	msg := mailer.Message{
+		To:      user.Email,
+		Subject: "Reset your Junto password",
+		Body:    fmt.Sprintf("Someone asked to reset your Junto password.\n\nOpen this link within an hour to choose a new one:\n%s\n\nIf it wasn't you, you can ignore this email.", link),
+	}
+	ctx := context.WithoutCancel(r.Context())
+	go func() {
+		if err := h.Mailer.Send(ctx, msg); err != nil {
+			log.Printf("failed to send password reset email: %v", err)
+		}
+	}()
+	return nil
+}
+
+// ConfirmPasswordReset sets the new password and signs the user out
+// everywhere: sessions are revoked, their socket is closed and their
+// personal access tokens are deleted.
+func (h *AuthHandler) ConfirmPasswordReset(w http.ResponseWriter, r *http.Request) {
+	var req PasswordResetConfirmRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	// Check before redeeming so a rejected password doesn't burn the link
+	if !h.checkNewPassword(w, req.Password) {
+		return
+	}
+
+	userID, err := h.DB.ConsumePasswordReset(r.Context(), auth.HashToken(req.Token))
+	if err != nil {
+		problem.Internal(w)
+		return
+	}
+	if userID == 0 {
+		problem.Write(w, problem.CodeInvalidOrExpired, "Invalid or expired token")
+		return
+	}
+
+	hashedPassword, err := h.hasher().Hash(req.Password)
+	if err != nil {
+		problem.Internal(w)
+		return
+	}
+
+	if err := h.DB.ResetUserPassword(r.Context(), userID, hashedPassword); err != nil {
+		problem.Internal(w)
+		return
+	}
+
+	if err := h.DB.RevokeUserSessions(r.Context(), userID); err != nil {
+		problem.Internal(w)
+		return
+	}
+	h.Hub.DisconnectUser(userID, "password reset")
+
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "Password updated",
+	})
+}
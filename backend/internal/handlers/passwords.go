@@ -0,0 +1,47 @@
+package handlers
+
+import (
+	"context"
+	"log"
+	"net/http"
+
+	"github.com/bit2swaz/junto/internal/auth"
+	"github.com/bit2swaz/junto/internal/problem"
+	"github.com/bit2swaz/junto/internal/validate"
+)
+
+func (h *AuthHandler) hasher() auth.PasswordHasher {
+	if h.Hasher != nil {
+		return h.Hasher
+	}
+	return auth.DefaultPasswordHasher
+}
+
+func (h *AuthHandler) passwordPolicy() *auth.PasswordPolicy {
+	if h.PasswordPolicy != nil {
+		return h.PasswordPolicy
+	}
+	return auth.DefaultPasswordPolicy
+}
+
+// checkNewPassword applies the password policy to a password a user is
+// about to set, answering with a validation problem if it is rejected.
+func (h *AuthHandler) checkNewPassword(w http.ResponseWriter, password string) bool {
+	if err := h.passwordPolicy().Check(password); err != nil {
+		problem.Invalid(w, validate.Errors{{Field: "password", Message: err.Error()}})
+		return false
+	}
+	return true
+}
+
+// upgradePasswordHash re-hashes a just-verified password with the current
+// hasher. Failure only means the upgrade is retried at the next login.
+func (h *AuthHandler) upgradePasswordHash(ctx context.Context, userID int64, password string) {
+	hashed, err := h.hasher().Hash(password)
+	if err == nil {
+		err = h.DB.UpdateUserPassword(ctx, userID, hashed)
+	}
+	if err != nil {
+		log.Printf("failed to upgrade password hash for user %d: %v", userID, err)
+	}
+}
@@ -0,0 +1,138 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+	// Timezones are checked against the embedded database so validation
+	// doesn't depend on what the host has installed.
+	_ "time/tzdata"
+
+	"github.com/bit2swaz/junto/internal/avatar"
+	"github.com/bit2swaz/junto/internal/database"
+	"github.com/bit2swaz/junto/internal/middleware"
+	"github.com/bit2swaz/junto/internal/problem"
+	"github.com/bit2swaz/junto/internal/validate"
+	"github.com/bit2swaz/junto/internal/websocket"
+)
+
+// Bounds on the user profile.
+const (
+	maxDisplayNameLength = 50
+	maxPronounsLength    = 40
+)
+
+type ProfileHandler struct {
+	DB  database.Service
+	Hub *websocket.Hub
+}
+
+// Profile is the part of a user they edit themselves.
+type Profile struct {
+	DisplayName  string          `json:"display_name"`
+	Pronouns     string          `json:"pronouns"`
+	Timezone     string          `json:"timezone"`
+	AvatarConfig json.RawMessage `json:"avatar_config"`
+}
+
+func profileOf(u *database.User) Profile {
+	return Profile{DisplayName: u.DisplayName, Pronouns: u.Pronouns, Timezone: u.Timezone, AvatarConfig: u.AvatarConfig}
+}
+
+// ProfileRequest changes only the fields it includes. avatar_config is
+// replaced as a whole and must follow a schema version avatar.Parse knows.
+type ProfileRequest struct {
+	DisplayName  *string         `json:"display_name"`
+	Pronouns     *string         `json:"pronouns"`
+	Timezone     *string         `json:"timezone"`
+	AvatarConfig json.RawMessage `json:"avatar_config"`
+
+	// avatar is AvatarConfig as parsed by Validate.
+	avatar *avatar.Config
+}
+
+func (req *ProfileRequest) Validate() error {
+	var v validate.Validator
+	if req.DisplayName != nil {
+		v.MaxLength("display_name", *req.DisplayName, maxDisplayNameLength)
+	}
+	if req.Pronouns != nil {
+		v.MaxLength("pronouns", *req.Pronouns, maxPronounsLength)
+	}
+	if req.Timezone != nil {
+		// LoadLocation takes "" and "Local" to mean UTC and the server's zone
+		_, err := time.LoadLocation(*req.Timezone)
+		v.Check(err == nil && *req.Timezone != "" && *req.Timezone != "Local", "timezone", "must be an IANA time zone such as Europe/Paris")
+	}
+	if req.AvatarConfig != nil {
+		config, err := avatar.Parse(req.AvatarConfig)
+		var errs validate.Errors
+		if errors.As(err, &errs) {
+			for _, fe := range errs {
+				v.Check(false, fe.Field, fe.Message)
+			}
+		}
+		req.avatar = config
+	}
+	return v.Err()
+}
+
+func (h *ProfileHandler) GetProfile(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(middleware.UserIDKey).(int64)
+	user, err := h.DB.GetUserByID(r.Context(), userID)
+	if err != nil {
+		problem.Internal(w)
+		return
+	}
+	if user == nil {
+		problem.Write(w, problem.CodeNotFound, "User not found")
+		return
+	}
+	json.NewEncoder(w).Encode(profileOf(user))
+}
+
+// UpdateProfile saves the changes and, if the avatar changed, tells the
+// rest of the couple so they can redraw it.
+func (h *ProfileHandler) UpdateProfile(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(middleware.UserIDKey).(int64)
+
+	var req ProfileRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+
+	update := database.UserProfileUpdate{
+		DisplayName: req.DisplayName,
+		Pronouns:    req.Pronouns,
+		Timezone:    req.Timezone,
+	}
+	if req.avatar != nil {
+		// Store the config as the current version, however it was sent
+		config, err := json.Marshal(req.avatar)
+		if err != nil {
+			problem.Internal(w)
+			return
+		}
+		update.AvatarConfig = config
+	}
+
+	user, err := h.DB.UpdateUserProfile(r.Context(), userID, update)
+	if err != nil {
+		problem.Internal(w)
+		return
+	}
+	if user == nil {
+		problem.Write(w, problem.CodeNotFound, "User not found")
+		return
+	}
+
+	if req.avatar != nil && user.CoupleID != nil {
+		h.Hub.BroadcastToCouple(*user.CoupleID, map[string]interface{}{
+			"type":    websocket.MessageAvatarUpdated,
+			"partner": websocket.NewPartnerProfile(user),
+		}, userID)
+	}
+
+	json.NewEncoder(w).Encode(profileOf(user))
+}
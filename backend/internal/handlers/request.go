@@ -0,0 +1,111 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/bit2swaz/junto/internal/problem"
+	"github.com/bit2swaz/junto/internal/validate"
+	"github.com/go-chi/chi/v5"
+)
+
+// maxBodyBytes caps every JSON request body. The largest legitimate body is
+// a vault item at maxVaultContentLength characters.
+const maxBodyBytes = 64 << 10
+
+// maxPasswordLength bounds the work a single request can ask the password
+// hasher to do. The minimum is up to the configured auth.PasswordPolicy.
+const maxPasswordLength = 256
+
+// Bounds for ?limit= on list endpoints.
+const (
+	defaultListLimit = 50
+	maxListLimit     = 200
+)
+
+type validator interface {
+	Validate() error
+}
+
+// decodeJSON reads exactly one JSON object into dst, rejecting unknown
+// fields and oversized bodies, then runs dst's Validate method if it has
+// one. On failure it writes the problem response and returns false.
+func decodeJSON(w http.ResponseWriter, r *http.Request, dst interface{}) bool {
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBodyBytes))
+	dec.DisallowUnknownFields()
+
+	if err := dec.Decode(dst); err != nil {
+		writeDecodeError(w, err)
+		return false
+	}
+	if err := dec.Decode(&struct{}{}); err != io.EOF {
+		if err == nil {
+			err = errors.New("body must contain a single JSON object")
+		}
+		writeDecodeError(w, err)
+		return false
+	}
+
+	if v, ok := dst.(validator); ok {
+		if err := v.Validate(); err != nil {
+			var errs validate.Errors
+			if errors.As(err, &errs) {
+				problem.Invalid(w, errs)
+			} else {
+				problem.Write(w, problem.CodeValidation, err.Error())
+			}
+			return false
+		}
+	}
+	return true
+}
+
+func writeDecodeError(w http.ResponseWriter, err error) {
+	var tooLarge *http.MaxBytesError
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+
+	switch {
+	case errors.As(err, &tooLarge):
+		problem.Write(w, problem.CodeBodyTooLarge, "")
+	case errors.As(err, &syntaxErr), errors.Is(err, io.ErrUnexpectedEOF):
+		problem.Write(w, problem.CodeInvalidBody, "Request body is not valid JSON")
+	case errors.As(err, &typeErr) && typeErr.Field != "":
+		problem.Write(w, problem.CodeInvalidBody, "Field "+typeErr.Field+" has the wrong type")
+	case errors.Is(err, io.EOF):
+		problem.Write(w, problem.CodeInvalidBody, "Request body is empty")
+	default:
+		// Unknown fields and other decoder errors already read well,
+		// e.g. `json: unknown field "x"`.
+		problem.Write(w, problem.CodeInvalidBody, err.Error())
+	}
+}
+
+func checkPassword(v *validate.Validator, field, password string) {
+	v.Required(field, password)
+	v.MaxLength(field, password, maxPasswordLength)
+}
+
+// pathID parses the {id} URL parameter, answering 404 with notFound if it
+// is not an ID.
+func pathID(w http.ResponseWriter, r *http.Request, notFound string) (int64, bool) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		problem.Write(w, problem.CodeNotFound, notFound)
+		return 0, false
+	}
+	return id, true
+}
+
+// listLimit reads ?limit=, falling back to the default when it is missing
+// or out of range.
+func listLimit(r *http.Request) int {
+	limit, err := strconv.Atoi(r.URL.Query().Get("limit"))
+	if err != nil || limit <= 0 {
+		return defaultListLimit
+	}
+	return min(limit, maxListLimit)
+}
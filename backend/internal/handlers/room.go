@@ -0,0 +1,59 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/bit2swaz/junto/internal/auth"
+	"github.com/bit2swaz/junto/internal/database"
+	"github.com/bit2swaz/junto/internal/middleware"
+	"github.com/bit2swaz/junto/internal/problem"
+	"github.com/bit2swaz/junto/internal/validate"
+	"github.com/bit2swaz/junto/internal/websocket"
+)
+
+// RoomHandler lets clients without a socket, such as scripts holding a
+// personal access token, take part in the couple's room.
+type RoomHandler struct {
+	DB  database.Service
+	Hub *websocket.Hub
+}
+
+type TouchRequest struct {
+	Type string `json:"type"`
+}
+
+func (req TouchRequest) Validate() error {
+	var v validate.Validator
+	v.Check(req.Type == "TOUCH_START" || req.Type == "TOUCH_END", "type", "must be TOUCH_START or TOUCH_END")
+	return v.Err()
+}
+
+// Touch relays a touch event to the partner as if it came over the socket.
+func (h *RoomHandler) Touch(w http.ResponseWriter, r *http.Request) {
+	if !middleware.RequireScope(w, r, auth.ScopeRoomTouch) {
+		return
+	}
+	userID := r.Context().Value(middleware.UserIDKey).(int64)
+
+	var req TouchRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+
+	user, err := h.DB.GetUserByID(r.Context(), userID)
+	if err != nil {
+		problem.Internal(w)
+		return
+	}
+	if user == nil {
+		problem.Write(w, problem.CodeNotFound, "User not found")
+		return
+	}
+	if user.CoupleID == nil {
+		problem.Write(w, problem.CodeNotInCouple, "")
+		return
+	}
+
+	h.Hub.BroadcastToCouple(*user.CoupleID, map[string]interface{}{"type": req.Type, "from": userID}, userID)
+	w.WriteHeader(http.StatusAccepted)
+}
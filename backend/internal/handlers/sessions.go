@@ -0,0 +1,121 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/bit2swaz/junto/internal/database"
+	"github.com/bit2swaz/junto/internal/middleware"
+	"github.com/bit2swaz/junto/internal/problem"
+	"github.com/bit2swaz/junto/internal/websocket"
+	"github.com/go-chi/chi/v5"
+)
+
+const maxUserAgentLength = 512
+
+type SessionHandler struct {
+	DB  database.Service
+	Hub *websocket.Hub
+}
+
+type SessionResponse struct {
+	database.Session
+	Current bool `json:"current"`
+}
+
+func (h *SessionHandler) ListSessions(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(middleware.UserIDKey).(int64)
+	currentID := r.Context().Value(middleware.SessionIDKey).(string)
+
+	sessions, err := h.DB.ListUserSessions(r.Context(), userID)
+	if err != nil {
+		problem.Internal(w)
+		return
+	}
+
+	resp := make([]SessionResponse, len(sessions))
+	for i, s := range sessions {
+		resp[i] = SessionResponse{Session: s, Current: s.ID == currentID}
+	}
+	json.NewEncoder(w).Encode(resp)
+}
+
+// RevokeSession signs one of the user's devices out, including any socket
+// it has open.
+func (h *SessionHandler) RevokeSession(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(middleware.UserIDKey).(int64)
+	sessionID := chi.URLParam(r, "id")
+
+	session, err := h.DB.GetSession(r.Context(), sessionID)
+	if err != nil {
+		problem.Internal(w)
+		return
+	}
+	if session == nil || session.UserID != userID {
+		problem.Write(w, problem.CodeNotFound, "Session not found")
+		return
+	}
+
+	if err := h.DB.RevokeSession(r.Context(), sessionID); err != nil {
+		problem.Internal(w)
+		return
+	}
+	h.Hub.DisconnectSession(sessionID)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func sessionDevice(r *http.Request) database.SessionDevice {
+	ua := r.UserAgent()
+	if len(ua) > maxUserAgentLength {
+		ua = ua[:maxUserAgentLength]
+	}
+	return database.SessionDevice{
+		Name:      deviceName(ua),
+		UserAgent: ua,
+		IP:        clientIP(r),
+	}
+}
+
+// deviceName turns a user agent into something like "Firefox on macOS".
+// It only needs to be good enough for a person to recognise their devices.
+func deviceName(ua string) string {
+	var browser, os string
+	switch {
+	case strings.Contains(ua, "Edg/"):
+		browser = "Edge"
+	case strings.Contains(ua, "OPR/"):
+		browser = "Opera"
+	case strings.Contains(ua, "Firefox/"):
+		browser = "Firefox"
+	case strings.Contains(ua, "Chrome/"):
+		browser = "Chrome"
+	case strings.Contains(ua, "Safari/"):
+		browser = "Safari"
+	}
+	switch {
+	case strings.Contains(ua, "iPhone"):
+		os = "iOS"
+	case strings.Contains(ua, "iPad"):
+		os = "iPadOS"
+	case strings.Contains(ua, "Android"):
+		os = "Android"
+	case strings.Contains(ua, "Mac OS X"):
+		os = "macOS"
+	case strings.Contains(ua, "Windows"):
+		os = "Windows"
+	case strings.Contains(ua, "Linux"):
+		os = "Linux"
+	}
+
+	switch {
+	case browser != "" && os != "":
+		return browser + " on " + os
+	case browser != "":
+		return browser
+	case os != "":
+		return os
+	}
+	return "Unknown device"
+}
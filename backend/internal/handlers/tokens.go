@@ -0,0 +1,112 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/bit2swaz/junto/internal/auth"
+	"github.com/bit2swaz/junto/internal/database"
+	"github.com/bit2swaz/junto/internal/middleware"
+	"github.com/bit2swaz/junto/internal/problem"
+	"github.com/bit2swaz/junto/internal/validate"
+)
+
+const maxTokenNameLength = 100
+
+// TokenHandler manages personal access tokens, which let scripts act for
+// a user within a fixed set of scopes without holding a login session.
+type TokenHandler struct {
+	DB database.Service
+}
+
+type CreateTokenRequest struct {
+	Name      string     `json:"name"`
+	Scopes    []string   `json:"scopes"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+func (req CreateTokenRequest) Validate() error {
+	var v validate.Validator
+	v.Required("name", req.Name)
+	v.MaxLength("name", req.Name, maxTokenNameLength)
+	v.Check(len(req.Scopes) > 0, "scopes", "is required")
+	for i, s := range req.Scopes {
+		field := fmt.Sprintf("scopes[%d]", i)
+		v.Check(auth.ValidScope(s), field, "is not a known scope")
+		v.Check(!slices.Contains(req.Scopes[:i], s), field, "is repeated")
+	}
+	if req.ExpiresAt != nil {
+		v.Check(req.ExpiresAt.After(time.Now()), "expires_at", "must be in the future")
+		v.Check(!req.ExpiresAt.After(time.Now().Add(auth.MaxPersonalAccessTokenTTL)), "expires_at", "must be within a year")
+	}
+	return v.Err()
+}
+
+// CreateTokenResponse is the only time the token itself is shown.
+type CreateTokenResponse struct {
+	database.PersonalAccessToken
+	Token string `json:"token"`
+}
+
+func (h *TokenHandler) CreateToken(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(middleware.UserIDKey).(int64)
+
+	var req CreateTokenRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	expiresAt := time.Now().Add(auth.DefaultPersonalAccessTokenTTL)
+	if req.ExpiresAt != nil {
+		expiresAt = *req.ExpiresAt
+	}
+
+	token, hash, err := auth.NewPersonalAccessToken()
+	if err != nil {
+		problem.Internal(w)
+		return
+	}
+	pat, err := h.DB.CreatePersonalAccessToken(r.Context(), userID, req.Name, hash, req.Scopes, expiresAt)
+	if err != nil {
+		problem.Internal(w)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(CreateTokenResponse{PersonalAccessToken: *pat, Token: token})
+}
+
+func (h *TokenHandler) ListTokens(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(middleware.UserIDKey).(int64)
+
+	tokens, err := h.DB.ListPersonalAccessTokens(r.Context(), userID)
+	if err != nil {
+		problem.Internal(w)
+		return
+	}
+	if tokens == nil {
+		tokens = []database.PersonalAccessToken{}
+	}
+	json.NewEncoder(w).Encode(tokens)
+}
+
+func (h *TokenHandler) DeleteToken(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(middleware.UserIDKey).(int64)
+	tokenID, ok := pathID(w, r, "Token not found")
+	if !ok {
+		return
+	}
+
+	deleted, err := h.DB.DeletePersonalAccessToken(r.Context(), userID, tokenID)
+	if err != nil {
+		problem.Internal(w)
+		return
+	}
+	if !deleted {
+		problem.Write(w, problem.CodeNotFound, "Token not found")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
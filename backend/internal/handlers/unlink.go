@@ -0,0 +1,241 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/bit2swaz/junto/internal/database"
+	"github.com/bit2swaz/junto/internal/middleware"
+	"github.com/bit2swaz/junto/internal/problem"
+	"github.com/bit2swaz/junto/internal/validate"
+	"github.com/bit2swaz/junto/internal/websocket"
+)
+
+// UnlinkCoolingOff is how long either member has to call off an unlink;
+// jobs.CoupleUnlink carries it out afterwards.
+const UnlinkCoolingOff = 72 * time.Hour
+
+type UnlinkRequest struct {
+	VaultDisposition string `json:"vault_disposition"`
+}
+
+func (req UnlinkRequest) Validate() error {
+	var v validate.Validator
+	switch req.VaultDisposition {
+	case database.VaultArchive, database.VaultDelete, database.VaultExport:
+	default:
+		v.Check(false, "vault_disposition", "must be archive, delete or export")
+	}
+	return v.Err()
+}
+
+// UnlinkStatus describes a pending unlink.
+type UnlinkStatus struct {
+	CoupleID         int64     `json:"couple_id"`
+	RequestedBy      int64     `json:"requested_by"`
+	ScheduledAt      time.Time `json:"scheduled_at"`
+	VaultDisposition string    `json:"vault_disposition"`
+}
+
+func unlinkStatus(c *database.Couple) UnlinkStatus {
+	status := UnlinkStatus{CoupleID: c.ID, ScheduledAt: *c.UnlinkScheduledAt, VaultDisposition: *c.VaultDisposition}
+	if c.UnlinkRequestedBy != nil {
+		status.RequestedBy = *c.UnlinkRequestedBy
+	}
+	return status
+}
+
+// LeaveRequest says what happens to the leaving member's own vault items:
+// archive leaves them with the rest of the pod, delete takes them along.
+// Either way they can still download them through /me/export first.
+type LeaveRequest struct {
+	VaultDisposition string `json:"vault_disposition"`
+}
+
+func (req LeaveRequest) Validate() error {
+	var v validate.Validator
+	switch req.VaultDisposition {
+	case database.VaultArchive, database.VaultDelete:
+	default:
+		v.Check(false, "vault_disposition", "must be archive or delete")
+	}
+	return v.Err()
+}
+
+// RequestUnlink starts the cooling-off period. The partner is told over
+// the hub. With the export disposition, each member is mailed a copy of the
+// vault when the unlink goes through, before it is deleted.
+func (h *CoupleHandler) RequestUnlink(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(middleware.UserIDKey).(int64)
+
+	var req UnlinkRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	user, ok := h.coupledUser(w, r, userID)
+	if !ok {
+		return
+	}
+	couple, err := h.DB.GetCoupleByID(r.Context(), *user.CoupleID)
+	if err != nil || couple == nil {
+		problem.Internal(w)
+		return
+	}
+	if !mayDissolve(w, couple, userID) {
+		return
+	}
+
+	scheduledAt := time.Now().Add(UnlinkCoolingOff)
+	requested, err := h.DB.RequestUnlink(r.Context(), *user.CoupleID, userID, req.VaultDisposition, scheduledAt)
+	if err != nil {
+		problem.Internal(w)
+		return
+	}
+	if !requested {
+		problem.Write(w, problem.CodeConflict, "An unlink is already pending")
+		return
+	}
+	couple, err = h.DB.GetCoupleByID(r.Context(), *user.CoupleID)
+	if err != nil || couple == nil {
+		problem.Internal(w)
+		return
+	}
+	status := unlinkStatus(couple)
+
+	recordEvent(r, h.DB, userID, database.AuditUnlinkRequested, map[string]interface{}{"couple_id": couple.ID, "vault_disposition": req.VaultDisposition})
+	h.Hub.BroadcastToCouple(couple.ID, map[string]interface{}{
+		"type":   websocket.MessageUnlinkRequested,
+		"unlink": status,
+	}, userID)
+
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(status)
+}
+
+func (h *CoupleHandler) GetUnlink(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(middleware.UserIDKey).(int64)
+	user, ok := h.coupledUser(w, r, userID)
+	if !ok {
+		return
+	}
+
+	couple, err := h.DB.GetCoupleByID(r.Context(), *user.CoupleID)
+	if err != nil || couple == nil {
+		problem.Internal(w)
+		return
+	}
+	if couple.UnlinkScheduledAt == nil {
+		problem.Write(w, problem.CodeNotFound, "No unlink pending")
+		return
+	}
+	json.NewEncoder(w).Encode(unlinkStatus(couple))
+}
+
+// CancelUnlink lets either member of a couple call off a pending unlink;
+// in a pod only the owner can.
+func (h *CoupleHandler) CancelUnlink(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(middleware.UserIDKey).(int64)
+	user, ok := h.coupledUser(w, r, userID)
+	if !ok {
+		return
+	}
+	couple, err := h.DB.GetCoupleByID(r.Context(), *user.CoupleID)
+	if err != nil || couple == nil {
+		problem.Internal(w)
+		return
+	}
+	if !mayDissolve(w, couple, userID) {
+		return
+	}
+
+	cancelled, err := h.DB.CancelUnlink(r.Context(), *user.CoupleID)
+	if err != nil {
+		problem.Internal(w)
+		return
+	}
+	if !cancelled {
+		problem.Write(w, problem.CodeNotFound, "No unlink pending")
+		return
+	}
+
+	recordEvent(r, h.DB, userID, database.AuditUnlinkCancelled, map[string]interface{}{"couple_id": *user.CoupleID})
+	h.Hub.BroadcastToCouple(*user.CoupleID, map[string]interface{}{
+		"type":         websocket.MessageUnlinkCancelled,
+		"couple_id":    *user.CoupleID,
+		"cancelled_by": userID,
+	}, userID)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// LeaveCouple takes the user out of their pod right away. The others stay
+// together, so unlike an unlink there is no cooling-off; a couple of two
+// has to be unlinked instead.
+func (h *CoupleHandler) LeaveCouple(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(middleware.UserIDKey).(int64)
+
+	var req LeaveRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	user, ok := h.coupledUser(w, r, userID)
+	if !ok {
+		return
+	}
+
+	couple, err := h.DB.LeaveCouple(r.Context(), *user.CoupleID, userID, req.VaultDisposition)
+	if errors.Is(err, database.ErrLeaveWouldDissolve) {
+		problem.Write(w, problem.CodeConflict, "Leaving would end the couple; request an unlink instead")
+		return
+	}
+	if err != nil {
+		problem.Internal(w)
+		return
+	}
+	if couple == nil {
+		problem.Write(w, problem.CodeNotInCouple, "")
+		return
+	}
+
+	recordEvent(r, h.DB, userID, database.AuditCoupleLeft, map[string]interface{}{"couple_id": couple.ID, "vault_disposition": req.VaultDisposition})
+	h.Hub.LeaveRoom(userID)
+	h.Hub.BroadcastToCouple(couple.ID, map[string]interface{}{
+		"type":      websocket.MessageMemberLeft,
+		"couple_id": couple.ID,
+		"user_id":   userID,
+		"members":   couple.Members,
+	}, userID)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// mayDissolve answers 403 unless the user may decide whether the couple is
+// dissolved. Either half of a couple can, but a pod is the owner's to
+// dissolve; anyone else can leave it.
+func mayDissolve(w http.ResponseWriter, couple *database.Couple, userID int64) bool {
+	if len(couple.ActiveMemberIDs()) > 2 && couple.RoleOf(userID) != database.MemberRoleOwner {
+		problem.Write(w, problem.CodeForbidden, "Only the owner can dissolve the pod; leave it instead")
+		return false
+	}
+	return true
+}
+
+// coupledUser loads the user, answering 400 if they are not in a couple.
+func (h *CoupleHandler) coupledUser(w http.ResponseWriter, r *http.Request, userID int64) (*database.User, bool) {
+	user, err := h.DB.GetUserByID(r.Context(), userID)
+	if err != nil {
+		problem.Internal(w)
+		return nil, false
+	}
+	if user == nil {
+		problem.Write(w, problem.CodeNotFound, "User not found")
+		return nil, false
+	}
+	if user.CoupleID == nil {
+		problem.Write(w, problem.CodeNotInCouple, "")
+		return nil, false
+	}
+	return user, true
+}
@@ -5,74 +5,110 @@ import (
 	"net/http"
 	"time"
 
+	"github.com/bit2swaz/junto/internal/auth"
 	"github.com/bit2swaz/junto/internal/database"
 	"github.com/bit2swaz/junto/internal/middleware"
+	"github.com/bit2swaz/junto/internal/problem"
+	"github.com/bit2swaz/junto/internal/validate"
 )
 
 type VaultHandler struct {
 	DB database.Service
 }
 
+const maxVaultContentLength = 10000
+
 type CreateVaultItemRequest struct {
 	Content  string    `json:"content"`
 	UnlockAt time.Time `json:"unlock_at"`
 }
 
+func (req CreateVaultItemRequest) Validate() error {
+	var v validate.Validator
+	v.Required("content", req.Content)
+	v.MaxLength("content", req.Content, maxVaultContentLength)
+	v.Check(!req.UnlockAt.IsZero(), "unlock_at", "is required")
+	return v.Err()
+}
+
 func (h *VaultHandler) AddToVault(w http.ResponseWriter, r *http.Request) {
+	if !middleware.RequireScope(w, r, auth.ScopeVaultWrite) {
+		return
+	}
 	userID := r.Context().Value(middleware.UserIDKey).(int64)
 
 	var req CreateVaultItemRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+	if !decodeJSON(w, r, &req) {
 		return
 	}
 
 	// Get user to find couple_id
 	user, err := h.DB.GetUserByID(r.Context(), userID)
 	if err != nil {
-		http.Error(w, "User not found", http.StatusNotFound)
+		problem.Write(w, problem.CodeNotFound, "User not found")
 		return
 	}
 	if user == nil {
-		http.Error(w, "User not found", http.StatusNotFound)
+		problem.Write(w, problem.CodeNotFound, "User not found")
 		return
 	}
 	if user.CoupleID == nil {
-		http.Error(w, "User is not in a couple", http.StatusBadRequest)
+		problem.Write(w, problem.CodeNotInCouple, "")
 		return
 	}
 
 	item, err := h.DB.CreateVaultItem(r.Context(), *user.CoupleID, userID, req.Content, req.UnlockAt)
 	if err != nil {
-		http.Error(w, "Failed to create vault item", http.StatusInternalServerError)
+		problem.Internal(w)
 		return
 	}
+	recordEvent(r, h.DB, userID, database.AuditVaultItemCreated, map[string]interface{}{"vault_item_id": item.ID})
 
 	w.WriteHeader(http.StatusCreated)
 	json.NewEncoder(w).Encode(item)
 }
 
 func (h *VaultHandler) GetVaultItems(w http.ResponseWriter, r *http.Request) {
+	if !middleware.RequireScope(w, r, auth.ScopeVaultRead) {
+		return
+	}
 	userID := r.Context().Value(middleware.UserIDKey).(int64)
 
 	// Get user to find couple_id
 	user, err := h.DB.GetUserByID(r.Context(), userID)
 	if err != nil {
-		http.Error(w, "User not found", http.StatusNotFound)
+		problem.Write(w, problem.CodeNotFound, "User not found")
 		return
 	}
 	if user == nil {
-		http.Error(w, "User not found", http.StatusNotFound)
+		problem.Write(w, problem.CodeNotFound, "User not found")
 		return
 	}
 	if user.CoupleID == nil {
-		http.Error(w, "User is not in a couple", http.StatusBadRequest)
+		problem.Write(w, problem.CodeNotInCouple, "")
 		return
 	}
 
 	items, err := h.DB.GetVaultItems(r.Context(), *user.CoupleID, userID)
 	if err != nil {
-		http.Error(w, "Failed to fetch vault items", http.StatusInternalServerError)
+		problem.Internal(w)
+		return
+	}
+
+	json.NewEncoder(w).Encode(items)
+}
+
+// GetArchivedVaultItems lists what the user kept from couples that were
+// unlinked with the archive disposition.
+func (h *VaultHandler) GetArchivedVaultItems(w http.ResponseWriter, r *http.Request) {
+	if !middleware.RequireScope(w, r, auth.ScopeVaultRead) {
+		return
+	}
+	userID := r.Context().Value(middleware.UserIDKey).(int64)
+
+	items, err := h.DB.GetArchivedVaultItems(r.Context(), userID)
+	if err != nil {
+		problem.Internal(w)
 		return
 	}
 
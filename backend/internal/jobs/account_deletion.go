@@ -0,0 +1,68 @@
+package jobs
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/bit2swaz/junto/internal/database"
+	"github.com/bit2swaz/junto/internal/websocket"
+)
+
+// AccountDeletion hard-deletes accounts whose deletion grace period is over.
+// The rest of each user's couple is told over the hub.
+type AccountDeletion struct {
+	DB       database.Service
+	Hub      *websocket.Hub
+	Interval time.Duration
+}
+
+func (j *AccountDeletion) Run(ctx context.Context) {
+	ticker := time.NewTicker(j.Interval)
+	defer ticker.Stop()
+	for {
+		if _, err := j.RunOnce(ctx); err != nil {
+			log.Printf("account deletion job failed: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RunOnce deletes every account that is due and reports how many it removed.
+func (j *AccountDeletion) RunOnce(ctx context.Context) (int, error) {
+	ids, err := j.DB.ListUsersDueForDeletion(ctx, time.Now())
+	if err != nil {
+		return 0, err
+	}
+
+	deleted := 0
+	for _, id := range ids {
+		if err := j.DB.RevokeUserSessions(ctx, id); err != nil {
+			return deleted, err
+		}
+		couple, err := j.DB.DeleteUser(ctx, id)
+		if err != nil {
+			return deleted, err
+		}
+		j.Hub.LeaveRoom(id)
+		j.Hub.DisconnectUser(id, "account deleted")
+		if couple != nil {
+			j.Hub.BroadcastToCouple(couple.ID, map[string]interface{}{
+				"type":      websocket.MessageMemberLeft,
+				"couple_id": couple.ID,
+				"user_id":   id,
+				"members":   couple.Members,
+			}, id)
+			if couple.DissolvedAt != nil {
+				j.Hub.DissolveRoom(couple.ID)
+			}
+		}
+		log.Printf("deleted user %d", id)
+		deleted++
+	}
+	return deleted, nil
+}
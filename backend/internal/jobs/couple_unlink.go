@@ -0,0 +1,144 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/bit2swaz/junto/internal/database"
+	"github.com/bit2swaz/junto/internal/mailer"
+	"github.com/bit2swaz/junto/internal/websocket"
+)
+
+// CoupleUnlink dissolves couples whose unlink cooling-off period is over.
+type CoupleUnlink struct {
+	DB       database.Service
+	Hub      *websocket.Hub
+	Mailer   mailer.Mailer
+	Interval time.Duration
+}
+
+func (j *CoupleUnlink) Run(ctx context.Context) {
+	ticker := time.NewTicker(j.Interval)
+	defer ticker.Stop()
+	for {
+		if _, err := j.RunOnce(ctx); err != nil {
+			log.Printf("couple unlink job failed: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RunOnce completes every unlink that is due and reports how many couples
+// it dissolved.
+func (j *CoupleUnlink) RunOnce(ctx context.Context) (int, error) {
+	ids, err := j.DB.ListCouplesDueForUnlink(ctx, time.Now())
+	if err != nil {
+		return 0, err
+	}
+
+	unlinked := 0
+	for _, id := range ids {
+		if err := j.sendVaultExports(ctx, id); err != nil {
+			// Nothing is deleted until everyone has their copy; try again
+			// next time
+			log.Printf("failed to export the vault of couple %d: %v", id, err)
+			continue
+		}
+		couple, err := j.DB.CompleteUnlink(ctx, id)
+		if err != nil {
+			return unlinked, err
+		}
+		if couple == nil {
+			// Cancelled since it was listed
+			continue
+		}
+
+		j.Hub.DissolveRoom(couple.ID)
+		for _, member := range couple.ActiveMemberIDs() {
+			j.Hub.SendToUser(member, map[string]interface{}{
+				"type":              websocket.MessageUnlinked,
+				"couple_id":         couple.ID,
+				"vault_disposition": couple.VaultDisposition,
+			})
+			event := database.AuditEvent{
+				UserID:   member,
+				Type:     database.AuditCoupleUnlinked,
+				Metadata: map[string]interface{}{"couple_id": couple.ID, "vault_disposition": couple.VaultDisposition},
+			}
+			if err := j.DB.RecordAuditEvent(ctx, event); err != nil {
+				log.Printf("failed to record unlink of couple %d: %v", couple.ID, err)
+			}
+		}
+		log.Printf("unlinked couple %d", couple.ID)
+		unlinked++
+	}
+	return unlinked, nil
+}
+
+// sendVaultExports mails each member of a couple unlinking with the export
+// disposition the vault items they can read, before CompleteUnlink deletes
+// them. Members mailed on an earlier try are skipped. Other couples are
+// left alone.
+func (j *CoupleUnlink) sendVaultExports(ctx context.Context, coupleID int64) error {
+	couple, err := j.DB.GetCoupleByID(ctx, coupleID)
+	if err != nil || couple == nil || couple.UnlinkScheduledAt == nil {
+		return err
+	}
+	if couple.VaultDisposition == nil || *couple.VaultDisposition != database.VaultExport {
+		return nil
+	}
+	scheduledAt := *couple.UnlinkScheduledAt
+
+	members, err := j.DB.ListCoupleUsers(ctx, coupleID)
+	if err != nil {
+		return err
+	}
+	for _, member := range members {
+		sent, err := j.DB.VaultExportSent(ctx, coupleID, scheduledAt, member.ID)
+		if err != nil {
+			return err
+		}
+		if sent {
+			continue
+		}
+		items, err := j.DB.GetVaultItems(ctx, coupleID, member.ID)
+		if err != nil {
+			return err
+		}
+		if err := j.Mailer.Send(ctx, vaultExportMessage(member.Email, items)); err != nil {
+			return err
+		}
+		if err := j.DB.MarkVaultExportSent(ctx, coupleID, scheduledAt, member.ID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// vaultExportMessage is the email carrying a copy of vault items that are
+// about to be deleted. Items still locked from the recipient are listed
+// without their content.
+func vaultExportMessage(to string, items []database.VaultItem) mailer.Message {
+	var b strings.Builder
+	b.WriteString("Your shared vault is being deleted. Here is a copy of what was in it.\n")
+	if len(items) == 0 {
+		b.WriteString("\nThe vault was empty.\n")
+	}
+	for _, item := range items {
+		fmt.Fprintf(&b, "\n--- Written %s, unlocks %s\n",
+			item.CreatedAt.UTC().Format("January 2, 2006"), item.UnlockAt.UTC().Format("January 2, 2006"))
+		if item.ContentText == "" {
+			b.WriteString("(still locked)\n")
+		} else {
+			b.WriteString(item.ContentText + "\n")
+		}
+	}
+	return mailer.Message{To: to, Subject: "A copy of your Junto vault", Body: b.String()}
+}
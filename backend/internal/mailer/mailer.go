@@ -0,0 +1,35 @@
+package mailer
+
+import (
+	"context"
+	"os"
+)
+
+type Message struct {
+	To      string `json:"to"`
+	Subject string `json:"subject"`
+	Body    string `json:"body"`
+}
+
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// NewFromEnv returns an SMTP mailer when SMTP_HOST is set, otherwise an
+// outbox that writes messages to MAIL_OUTBOX_DIR (or keeps them in memory).
+func NewFromEnv() Mailer {
+	if host := os.Getenv("SMTP_HOST"); host != "" {
+		port := os.Getenv("SMTP_PORT")
+		if port == "" {
+			port = "587"
+		}
+		return &SMTPMailer{
+			Host:     host,
+			Port:     port,
+			Username: os.Getenv("SMTP_USERNAME"),
+			Password: os.Getenv("SMTP_PASSWORD"),
+			From:     os.Getenv("SMTP_FROM"),
+		}
+	}
+	return NewOutbox(os.Getenv("MAIL_OUTBOX_DIR"))
+}
@@ -0,0 +1,64 @@
+package mailer
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Outbox is a Mailer for development and tests. Every message is kept in
+// memory and, if Dir is set, also written there as a JSON file.
+type Outbox struct {
+	Dir string
+
+	mu       sync.Mutex
+	messages []Message
+}
+
+func NewOutbox(dir string) *Outbox {
+	return &Outbox{Dir: dir}
+}
+
+func (o *Outbox) Send(ctx context.Context, msg Message) error {
+	o.mu.Lock()
+	o.messages = append(o.messages, msg)
+	n := len(o.messages)
+	o.mu.Unlock()
+
+	if o.Dir == "" {
+		return nil
+	}
+
+	if err := os.MkdirAll(o.Dir, 0o700); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(msg, "", "  ")
+	if err != nil {
+		return err
+	}
+	name := fmt.Sprintf("%d-%03d.json", time.Now().UnixNano(), n)
+	return os.WriteFile(filepath.Join(o.Dir, name), data, 0o600)
+}
+
+// Messages returns a copy of everything sent so far.
+func (o *Outbox) Messages() []Message {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return append([]Message(nil), o.messages...)
+}
+
+// Last returns the most recent message sent to the given address.
+func (o *Outbox) Last(to string) (Message, bool) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	for i := len(o.messages) - 1; i >= 0; i-- {
+		if o.messages[i].To == to {
+			return o.messages[i], true
+		}
+	}
+	return Message{}, false
+}
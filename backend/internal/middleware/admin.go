@@ -0,0 +1,30 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/bit2swaz/junto/internal/database"
+	"github.com/bit2swaz/junto/internal/problem"
+)
+
+// RequireAdmin must run after AuthMiddleware and RequireSession. The role is
+// read from the database on every request so a demotion takes effect
+// immediately rather than when the access token expires.
+func RequireAdmin(db database.Service) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			userID := r.Context().Value(UserIDKey).(int64)
+			user, err := db.GetUserByID(r.Context(), userID)
+			if err != nil {
+				problem.Internal(w)
+				return
+			}
+			if user == nil || user.Role != database.RoleAdmin || user.DisabledAt != nil {
+				problem.Write(w, problem.CodeForbidden, "")
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
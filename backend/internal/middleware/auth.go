@@ -2,65 +2,98 @@ package middleware
 
 import (
 	"context"
-	"fmt"
+	"log"
 	"net/http"
-	"os"
 	"strings"
+	"time"
 
-	"github.com/golang-jwt/jwt/v5"
+	"github.com/bit2swaz/junto/internal/auth"
+	"github.com/bit2swaz/junto/internal/database"
+	"github.com/bit2swaz/junto/internal/problem"
 )
 
 type contextKey string
 
-const UserIDKey contextKey = "user_id"
+const (
+	UserIDKey    contextKey = "user_id"
+	SessionIDKey contextKey = "session_id"
+	// TokenExpiryKey holds the expiry of the access token the request
+	// was authenticated with.
+	TokenExpiryKey contextKey = "token_expiry"
+	// ScopesKey holds the scopes of the personal access token the request
+	// was authenticated with. It is unset for session tokens.
+	ScopesKey contextKey = "scopes"
+)
 
-func AuthMiddleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		tokenString := ""
-		authHeader := r.Header.Get("Authorization")
+func AuthMiddleware(db database.Service, keys *auth.KeyManager) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			tokenString := ""
+			authHeader := r.Header.Get("Authorization")
 
-		if authHeader != "" {
-			parts := strings.Split(authHeader, " ")
-			if len(parts) == 2 && parts[0] == "Bearer" {
-				tokenString = parts[1]
+			if authHeader != "" {
+				parts := strings.Split(authHeader, " ")
+				if len(parts) == 2 && parts[0] == "Bearer" {
+					tokenString = parts[1]
+				}
 			}
-		}
 
-		// Fallback to query param for WebSockets
-		if tokenString == "" {
-			tokenString = r.URL.Query().Get("token")
-		}
+			if tokenString == "" {
+				problem.Write(w, problem.CodeAuthRequired, "")
+				return
+			}
 
-		if tokenString == "" {
-			http.Error(w, "Authorization required", http.StatusUnauthorized)
-			return
-		}
+			if strings.HasPrefix(tokenString, auth.PersonalAccessTokenPrefix) {
+				authenticatePersonalAccessToken(db, next, w, r, tokenString)
+				return
+			}
 
-		token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+			claims, err := keys.ParseAccessToken(tokenString)
+			if err != nil {
+				problem.Write(w, problem.CodeInvalidToken, "")
+				return
 			}
-			return []byte(os.Getenv("JWT_SECRET")), nil
-		})
 
-		if err != nil || !token.Valid {
-			http.Error(w, "Invalid token", http.StatusUnauthorized)
-			return
-		}
+			// Reject tokens whose session was logged out or revoked
+			session, err := db.GetSession(r.Context(), claims.SessionID)
+			if err != nil {
+				problem.Internal(w)
+				return
+			}
+			if session == nil || session.UserID != claims.UserID {
+				problem.Write(w, problem.CodeSessionRevoked, "")
+				return
+			}
+
+			ctx := context.WithValue(r.Context(), UserIDKey, claims.UserID)
+			ctx = context.WithValue(ctx, SessionIDKey, claims.SessionID)
+			ctx = context.WithValue(ctx, TokenExpiryKey, claims.ExpiresAt.Time)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
 
-		claims, ok := token.Claims.(jwt.MapClaims)
-		if !ok {
-			http.Error(w, "Invalid token claims", http.StatusUnauthorized)
-			return
-		}
+func authenticatePersonalAccessToken(db database.Service, next http.Handler, w http.ResponseWriter, r *http.Request, token string) {
+	pat, err := db.GetPersonalAccessTokenByHash(r.Context(), auth.HashToken(token))
+	if err != nil {
+		problem.Internal(w)
+		return
+	}
+	if pat == nil || time.Now().After(pat.ExpiresAt) {
+		problem.Write(w, problem.CodeInvalidToken, "")
+		return
+	}
 
-		userIDFloat, ok := claims["user_id"].(float64)
-		if !ok {
-			http.Error(w, "Invalid user ID in token", http.StatusUnauthorized)
-			return
-		}
+	if err := db.TouchPersonalAccessToken(r.Context(), pat.ID); err != nil {
+		log.Printf("failed to record personal access token use: %v", err)
+	}
 
-		ctx := context.WithValue(r.Context(), UserIDKey, int64(userIDFloat))
-		next.ServeHTTP(w, r.WithContext(ctx))
-	})
+	scopes := pat.Scopes
+	if scopes == nil {
+		scopes = []string{}
+	}
+	ctx := context.WithValue(r.Context(), UserIDKey, pat.UserID)
+	ctx = context.WithValue(ctx, TokenExpiryKey, pat.ExpiresAt)
+	ctx = context.WithValue(ctx, ScopesKey, scopes)
+	next.ServeHTTP(w, r.WithContext(ctx))
 }
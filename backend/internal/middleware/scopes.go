@@ -0,0 +1,41 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"slices"
+
+	"github.com/bit2swaz/junto/internal/auth"
+	"github.com/bit2swaz/junto/internal/problem"
+)
+
+// HasScope reports whether the request may act within scope. Session tokens
+// carry every scope; personal access tokens only those they were minted with.
+func HasScope(ctx context.Context, scope auth.Scope) bool {
+	scopes, ok := ctx.Value(ScopesKey).([]string)
+	if !ok {
+		return true
+	}
+	return slices.Contains(scopes, string(scope))
+}
+
+// RequireScope writes a 403 and returns false if the request lacks scope.
+func RequireScope(w http.ResponseWriter, r *http.Request, scope auth.Scope) bool {
+	if !HasScope(r.Context(), scope) {
+		problem.Write(w, problem.CodeInsufficientScope, "requires scope "+string(scope))
+		return false
+	}
+	return true
+}
+
+// RequireSession rejects requests authenticated with a personal access
+// token. Routes opt in to tokens by staying outside it.
+func RequireSession(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := r.Context().Value(ScopesKey).([]string); ok {
+			problem.Write(w, problem.CodeSessionRequired, "")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,33 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/bit2swaz/junto/internal/database"
+	"github.com/bit2swaz/junto/internal/problem"
+)
+
+// RequireVerifiedEmail must run after AuthMiddleware. It blocks users who
+// have not confirmed their email address yet.
+func RequireVerifiedEmail(db database.Service) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			userID := r.Context().Value(UserIDKey).(int64)
+			user, err := db.GetUserByID(r.Context(), userID)
+			if err != nil {
+				problem.Internal(w)
+				return
+			}
+			if user == nil {
+				problem.Write(w, problem.CodeNotFound, "User not found")
+				return
+			}
+			if user.EmailVerifiedAt == nil {
+				problem.Write(w, problem.CodeEmailNotVerified, "")
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,140 @@
+// Package problem writes RFC 7807 application/problem+json error responses.
+// Every problem carries a stable machine-readable code; clients should
+// branch on the code, never on the human-readable title or detail.
+package problem
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/bit2swaz/junto/internal/validate"
+)
+
+const ContentType = "application/problem+json"
+
+type Code string
+
+const (
+	CodeInvalidBody          Code = "invalid_body"
+	CodeBodyTooLarge         Code = "body_too_large"
+	CodeValidation           Code = "validation_failed"
+	CodeAuthRequired         Code = "authentication_required"
+	CodeInvalidToken         Code = "invalid_token"
+	CodeSessionRevoked       Code = "session_revoked"
+	CodeInvalidCredentials   Code = "invalid_credentials"
+	CodeRefreshTokenReused   Code = "refresh_token_reused"
+	CodeInvalidOrExpired     Code = "invalid_or_expired"
+	CodeInvalidCode          Code = "invalid_code"
+	CodeMFANotEnrolled       Code = "mfa_not_enrolled"
+	CodeMFANotEnabled        Code = "mfa_not_enabled"
+	CodeMFAAlreadyEnabled    Code = "mfa_already_enabled"
+	CodeEmailNotVerified     Code = "email_not_verified"
+	CodeEmailAlreadyVerified Code = "email_already_verified"
+	CodeEmailTaken           Code = "email_taken"
+	CodeAccountDisabled      Code = "account_disabled"
+	CodeAccountExists        Code = "account_exists"
+	CodeNotInCouple          Code = "not_in_couple"
+	CodeAlreadyPaired        Code = "already_paired"
+	CodeSelfLink             Code = "cannot_link_self"
+	CodeIdentityLoginFailed  Code = "identity_login_failed"
+	CodeUpstreamUnavailable  Code = "upstream_unavailable"
+	CodeForbidden            Code = "forbidden"
+	CodeInsufficientScope    Code = "insufficient_scope"
+	CodeSessionRequired      Code = "session_required"
+	CodeNotFound             Code = "not_found"
+	CodeConflict             Code = "conflict"
+	CodePreconditionRequired Code = "precondition_required"
+	CodePreconditionFailed   Code = "precondition_failed"
+	CodeTooManyRequests      Code = "too_many_requests"
+	CodeInternal             Code = "internal_error"
+)
+
+type codeInfo struct {
+	status int
+	title  string
+}
+
+var codes = map[Code]codeInfo{
+	CodeInvalidBody:          {http.StatusBadRequest, "Malformed request body"},
+	CodeBodyTooLarge:         {http.StatusRequestEntityTooLarge, "Request body too large"},
+	CodeValidation:           {http.StatusBadRequest, "Request validation failed"},
+	CodeAuthRequired:         {http.StatusUnauthorized, "Authentication required"},
+	CodeInvalidToken:         {http.StatusUnauthorized, "Invalid or expired token"},
+	CodeSessionRevoked:       {http.StatusUnauthorized, "Session revoked"},
+	CodeInvalidCredentials:   {http.StatusUnauthorized, "Invalid credentials"},
+	CodeRefreshTokenReused:   {http.StatusUnauthorized, "Refresh token reuse detected"},
+	CodeInvalidOrExpired:     {http.StatusBadRequest, "Invalid or expired"},
+	CodeInvalidCode:          {http.StatusBadRequest, "Invalid code"},
+	CodeMFANotEnrolled:       {http.StatusBadRequest, "No two-factor enrollment in progress"},
+	CodeMFANotEnabled:        {http.StatusBadRequest, "Two-factor authentication not enabled"},
+	CodeMFAAlreadyEnabled:    {http.StatusConflict, "Two-factor authentication already enabled"},
+	CodeEmailNotVerified:     {http.StatusForbidden, "Email not verified"},
+	CodeEmailAlreadyVerified: {http.StatusBadRequest, "Email already verified"},
+	CodeEmailTaken:           {http.StatusConflict, "Email already registered"},
+	CodeAccountDisabled:      {http.StatusForbidden, "Account disabled"},
+	CodeAccountExists:        {http.StatusConflict, "Account already exists"},
+	CodeNotInCouple:          {http.StatusBadRequest, "User is not in a couple"},
+	CodeAlreadyPaired:        {http.StatusConflict, "Already in a couple"},
+	CodeSelfLink:             {http.StatusBadRequest, "Cannot link with yourself"},
+	CodeIdentityLoginFailed:  {http.StatusUnauthorized, "Login with identity provider failed"},
+	CodeUpstreamUnavailable:  {http.StatusBadGateway, "Identity provider unavailable"},
+	CodeForbidden:            {http.StatusForbidden, "Forbidden"},
+	CodeInsufficientScope:    {http.StatusForbidden, "Token lacks the required scope"},
+	CodeSessionRequired:      {http.StatusForbidden, "Not available to personal access tokens"},
+	CodeNotFound:             {http.StatusNotFound, "Not found"},
+	CodeConflict:             {http.StatusConflict, "Conflict"},
+	CodePreconditionRequired: {http.StatusPreconditionRequired, "If-Match header required"},
+	CodePreconditionFailed:   {http.StatusPreconditionFailed, "Changed since it was read"},
+	CodeTooManyRequests:      {http.StatusTooManyRequests, "Too many attempts"},
+	CodeInternal:             {http.StatusInternalServerError, "Internal server error"},
+}
+
+// Problem is the response body. Code and Errors are extension members.
+type Problem struct {
+	Type   string                `json:"type"`
+	Title  string                `json:"title"`
+	Status int                   `json:"status"`
+	Detail string                `json:"detail,omitempty"`
+	Code   Code                  `json:"code"`
+	Errors []validate.FieldError `json:"errors,omitempty"`
+}
+
+func New(code Code, detail string) *Problem {
+	info, ok := codes[code]
+	if !ok {
+		info = codes[CodeInternal]
+	}
+	return &Problem{
+		Type:   "urn:junto:problem:" + string(code),
+		Title:  info.title,
+		Status: info.status,
+		Detail: detail,
+		Code:   code,
+	}
+}
+
+func (p *Problem) Write(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", ContentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(p.Status)
+	json.NewEncoder(w).Encode(p)
+}
+
+// Write sends a problem for code. detail may be empty, in which case the
+// title alone describes the error.
+func Write(w http.ResponseWriter, code Code, detail string) {
+	New(code, detail).Write(w)
+}
+
+// Internal is shorthand for the opaque 500 every handler sends when a
+// dependency fails.
+func Internal(w http.ResponseWriter) {
+	Write(w, CodeInternal, "")
+}
+
+// Invalid sends a validation problem listing each offending field.
+func Invalid(w http.ResponseWriter, errs validate.Errors) {
+	p := New(CodeValidation, errs.Error())
+	p.Errors = errs
+	p.Write(w)
+}
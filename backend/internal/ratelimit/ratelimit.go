@@ -0,0 +1,82 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Policy describes how failures against one kind of key are punished. After
+// MaxAttempts failures within Window, every further failure locks the key for
+// BaseDelay, doubling each time up to MaxDelay.
+type Policy struct {
+	Name        string
+	MaxAttempts int
+	Window      time.Duration
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+}
+
+type Limiter struct {
+	redis  *redis.Client
+	policy Policy
+}
+
+func New(rdb *redis.Client, policy Policy) *Limiter {
+	return &Limiter{redis: rdb, policy: policy}
+}
+
+func (l *Limiter) failuresKey(key string) string {
+	return fmt.Sprintf("ratelimit:%s:%s:failures", l.policy.Name, key)
+}
+
+func (l *Limiter) lockKey(key string) string {
+	return fmt.Sprintf("ratelimit:%s:%s:lock", l.policy.Name, key)
+}
+
+// Check returns how long key is still locked out, or 0 if it may try again.
+func (l *Limiter) Check(ctx context.Context, key string) (time.Duration, error) {
+	ttl, err := l.redis.PTTL(ctx, l.lockKey(key)).Result()
+	if err != nil {
+		return 0, err
+	}
+	if ttl < 0 {
+		return 0, nil
+	}
+	return ttl, nil
+}
+
+// Fail records a failed attempt and returns the lockout it triggered, if any.
+func (l *Limiter) Fail(ctx context.Context, key string) (time.Duration, error) {
+	pipe := l.redis.TxPipeline()
+	incr := pipe.Incr(ctx, l.failuresKey(key))
+	pipe.Expire(ctx, l.failuresKey(key), l.policy.Window)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return 0, err
+	}
+
+	excess := int(incr.Val()) - l.policy.MaxAttempts
+	if excess <= 0 {
+		return 0, nil
+	}
+
+	delay := l.policy.BaseDelay
+	for i := 1; i < excess && delay < l.policy.MaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > l.policy.MaxDelay {
+		delay = l.policy.MaxDelay
+	}
+
+	if err := l.redis.Set(ctx, l.lockKey(key), 1, delay).Err(); err != nil {
+		return 0, err
+	}
+	return delay, nil
+}
+
+// Reset forgets all failures for key, e.g. after a successful login.
+func (l *Limiter) Reset(ctx context.Context, key string) error {
+	return l.redis.Del(ctx, l.failuresKey(key), l.lockKey(key)).Err()
+}
@@ -0,0 +1,57 @@
+// Package validate collects field-level errors for request bodies.
+package validate
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// FieldError describes one invalid field, using its JSON name.
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// Errors is returned by Validate methods when one or more fields are invalid.
+type Errors []FieldError
+
+func (e Errors) Error() string {
+	parts := make([]string, len(e))
+	for i, fe := range e {
+		parts[i] = fe.Field + ": " + fe.Message
+	}
+	return strings.Join(parts, "; ")
+}
+
+// Validator accumulates field errors. The zero value is ready to use.
+type Validator struct {
+	errs Errors
+}
+
+// Check records message against field unless ok holds.
+func (v *Validator) Check(ok bool, field, message string) {
+	if !ok {
+		v.errs = append(v.errs, FieldError{Field: field, Message: message})
+	}
+}
+
+func (v *Validator) Required(field, value string) {
+	v.Check(strings.TrimSpace(value) != "", field, "is required")
+}
+
+// MaxLength counts characters, not bytes.
+func (v *Validator) MaxLength(field, value string, n int) {
+	v.Check(utf8.RuneCountInString(value) <= n, field, "is too long")
+}
+
+func (v *Validator) MinLength(field, value string, n int) {
+	v.Check(utf8.RuneCountInString(value) >= n, field, "is too short")
+}
+
+// Err returns the collected errors as Errors, or nil if there were none.
+func (v *Validator) Err() error {
+	if len(v.errs) == 0 {
+		return nil
+	}
+	return v.errs
+}
@@ -0,0 +1,157 @@
+package websocket
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/coder/websocket"
+	"github.com/coder/websocket/wsjson"
+)
+
+// Frames used to keep an open connection authenticated. The server sends
+// REAUTH_REQUIRED shortly before the connection's access token expires;
+// the client answers with AUTH carrying a fresh access token for the same
+// session and gets AUTH_OK back. Connections that let their auth lapse, or
+// whose session is revoked, are closed with StatusPolicyViolation.
+const (
+	MessageReauthRequired = "REAUTH_REQUIRED"
+	MessageAuth           = "AUTH"
+	MessageAuthOK         = "AUTH_OK"
+)
+
+type authMessage struct {
+	Type      string    `json:"type"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// client is one open socket and the session it was opened for.
+type client struct {
+	conn      *websocket.Conn
+	userID    int64
+	sessionID string
+	// connectedAt is only reported, never used for decisions.
+	connectedAt time.Time
+	// room is the couple the socket relays to, or 0. Guarded by
+	// Hub.roomsMu, since it changes with the room's membership.
+	room int64
+
+	mu        sync.Mutex
+	expiresAt time.Time
+	// renewed wakes watchAuth after a successful re-auth.
+	renewed chan struct{}
+}
+
+func newClient(conn *websocket.Conn, userID int64, sessionID string, expiresAt time.Time) *client {
+	return &client{
+		conn:        conn,
+		userID:      userID,
+		sessionID:   sessionID,
+		connectedAt: time.Now(),
+		expiresAt:   expiresAt,
+		renewed:     make(chan struct{}, 1),
+	}
+}
+
+func (c *client) authExpiry() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.expiresAt
+}
+
+func (c *client) renew(expiresAt time.Time) {
+	c.mu.Lock()
+	c.expiresAt = expiresAt
+	c.mu.Unlock()
+
+	select {
+	case c.renewed <- struct{}{}:
+	default:
+	}
+}
+
+// watchAuth runs for the lifetime of a connection. It warns the client
+// before its auth expires, and closes the socket once it has expired or
+// the session is gone.
+func (h *Hub) watchAuth(ctx context.Context, c *client) {
+	sessionCheck := time.NewTicker(h.SessionCheckInterval)
+	defer sessionCheck.Stop()
+
+	var warnedFor time.Time
+	for {
+		expiresAt := c.authExpiry()
+		untilExpiry := time.Until(expiresAt)
+		if untilExpiry <= 0 {
+			c.conn.Close(websocket.StatusPolicyViolation, "authentication expired")
+			return
+		}
+
+		// Warn once per expiry; re-auth with a token that expires no
+		// later does not earn another warning.
+		expiryTimer := time.NewTimer(untilExpiry)
+		var warnTimer *time.Timer
+		var warn <-chan time.Time
+		if !warnedFor.Equal(expiresAt) {
+			warnTimer = time.NewTimer(max(untilExpiry-h.ReauthWarning, 0))
+			warn = warnTimer.C
+		}
+		stopTimers := func() {
+			expiryTimer.Stop()
+			if warnTimer != nil {
+				warnTimer.Stop()
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			stopTimers()
+			return
+		case <-c.renewed:
+		case <-warn:
+			warnedFor = expiresAt
+			msg := authMessage{Type: MessageReauthRequired, ExpiresAt: expiresAt}
+			if err := wsjson.Write(ctx, c.conn, msg); err != nil {
+				log.Printf("failed to write to websocket: %v", err)
+			}
+		case <-expiryTimer.C:
+		case <-sessionCheck.C:
+			if !h.sessionActive(ctx, c) {
+				stopTimers()
+				c.conn.Close(websocket.StatusPolicyViolation, "session revoked")
+				return
+			}
+		}
+		stopTimers()
+	}
+}
+
+func (h *Hub) sessionActive(ctx context.Context, c *client) bool {
+	session, err := h.db.GetSession(ctx, c.sessionID)
+	if err != nil {
+		// Don't drop sockets over a Redis blip; the next check decides.
+		log.Printf("failed to check websocket session: %v", err)
+		return true
+	}
+	return session != nil && session.UserID == c.userID
+}
+
+// reauthenticate handles an in-band AUTH frame. The token must belong to
+// the session the socket was opened with; anything else closes the socket.
+func (h *Hub) reauthenticate(ctx context.Context, c *client, token string) {
+	claims, err := h.keys.ParseAccessToken(token)
+	if err != nil || claims.UserID != c.userID || claims.SessionID != c.sessionID || !h.sessionActive(ctx, c) {
+		c.conn.Close(websocket.StatusPolicyViolation, "re-authentication failed")
+		return
+	}
+
+	expiresAt := claims.ExpiresAt.Time
+	if expiresAt.After(c.authExpiry()) {
+		c.renew(expiresAt)
+	}
+
+	msg := authMessage{Type: MessageAuthOK, ExpiresAt: c.authExpiry()}
+	if err := wsjson.Write(ctx, c.conn, msg); err != nil {
+		log.Printf("failed to write to websocket: %v", err)
+	}
+}
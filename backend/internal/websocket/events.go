@@ -0,0 +1,60 @@
+package websocket
+
+import (
+	"encoding/json"
+
+	"github.com/bit2swaz/junto/internal/database"
+)
+
+// Messages the server sends about the couple itself, as opposed to those
+// relayed between partners.
+const (
+	// MessagePairingRequested tells a code's owner that someone redeemed it
+	// and is waiting for them to accept or reject.
+	MessagePairingRequested = "PAIRING_REQUESTED"
+	// MessagePairingAccepted and MessagePairingRejected tell the requester
+	// how the owner answered.
+	MessagePairingAccepted = "PAIRING_ACCEPTED"
+	MessagePairingRejected = "PAIRING_REJECTED"
+	// MessagePartnerLinked is sent to everyone in a couple when someone
+	// joins it, with the profile of whoever is new to them.
+	MessagePartnerLinked = "PARTNER_LINKED"
+	// MessageUnlinkRequested tells the partner that an unlink was requested
+	// and when it takes effect.
+	MessageUnlinkRequested = "UNLINK_REQUESTED"
+	MessageUnlinkCancelled = "UNLINK_CANCELLED"
+	// MessageUnlinked is sent to both members once the couple is dissolved.
+	MessageUnlinked = "UNLINKED"
+	// MessageMemberLeft tells the rest of a pod that someone left it.
+	MessageMemberLeft = "MEMBER_LEFT"
+	// MessageCoupleProfileUpdated carries the couple's profile to the other
+	// members after one of them changed it.
+	MessageCoupleProfileUpdated = "COUPLE_PROFILE_UPDATED"
+	// MessageAvatarUpdated carries a member's new profile to the rest of
+	// the couple when they change their avatar.
+	MessageAvatarUpdated = "AVATAR_UPDATED"
+)
+
+// PartnerProfile is what a member is told about their partner.
+type PartnerProfile struct {
+	ID           int64           `json:"id"`
+	Email        string          `json:"email"`
+	DisplayName  string          `json:"display_name"`
+	Pronouns     string          `json:"pronouns"`
+	AvatarConfig json.RawMessage `json:"avatar_config"`
+}
+
+func NewPartnerProfile(u *database.User) PartnerProfile {
+	return PartnerProfile{ID: u.ID, Email: u.Email, DisplayName: u.DisplayName, Pronouns: u.Pronouns, AvatarConfig: u.AvatarConfig}
+}
+
+// partnerProfiles describes everyone in members but userID.
+func partnerProfiles(members []database.User, userID int64) []PartnerProfile {
+	profiles := []PartnerProfile{}
+	for i := range members {
+		if members[i].ID != userID {
+			profiles = append(profiles, NewPartnerProfile(&members[i]))
+		}
+	}
+	return profiles
+}
@@ -2,123 +2,294 @@ package websocket
 
 import (
 	"context"
+	"encoding/json"
 	"log"
 	"net/http"
 	"sync"
+	"time"
 
+	"github.com/bit2swaz/junto/internal/auth"
 	"github.com/bit2swaz/junto/internal/database"
 	"github.com/bit2swaz/junto/internal/middleware"
+	"github.com/bit2swaz/junto/internal/problem"
 	"github.com/coder/websocket"
 	"github.com/coder/websocket/wsjson"
 )
 
+// TicketTTL is how long a client has to open the socket after asking for
+// a ticket.
+const TicketTTL = 30 * time.Second
+
 type Hub struct {
-	// Map coupleID -> list of userIDs
-	rooms   map[int64][]int64
+	// Map coupleID -> connected members
+	rooms   map[int64][]*client
 	roomsMu sync.RWMutex
 
 	// Map userID -> connection
-	conns   map[int64]*websocket.Conn
+	conns   map[int64]*client
 	connsMu sync.RWMutex
 
-	db database.Service
+	db   database.Service
+	keys *auth.KeyManager
+
+	// ReauthWarning is how long before a connection's auth expires that
+	// the client is asked to re-authenticate.
+	ReauthWarning time.Duration
+	// SessionCheckInterval is how often open connections check that
+	// their session has not been revoked.
+	SessionCheckInterval time.Duration
 }
 
-func NewHub(db database.Service) *Hub {
+func NewHub(db database.Service, keys *auth.KeyManager) *Hub {
 	return &Hub{
-		rooms: make(map[int64][]int64),
-		conns: make(map[int64]*websocket.Conn),
-		db:    db,
+		rooms:                make(map[int64][]*client),
+		conns:                make(map[int64]*client),
+		db:                   db,
+		keys:                 keys,
+		ReauthWarning:        time.Minute,
+		SessionCheckInterval: 30 * time.Second,
 	}
 }
 
-func (h *Hub) Add(userID int64, coupleID *int64, conn *websocket.Conn) {
+func (h *Hub) Add(c *client, coupleID *int64) {
 	h.connsMu.Lock()
-	if oldConn, ok := h.conns[userID]; ok {
-		oldConn.Close(websocket.StatusNormalClosure, "New connection replaced this one")
+	if old, ok := h.conns[c.userID]; ok {
+		old.conn.Close(websocket.StatusNormalClosure, "New connection replaced this one")
 	}
-	h.conns[userID] = conn
+	h.conns[c.userID] = c
 	h.connsMu.Unlock()
 
 	if coupleID != nil {
 		h.roomsMu.Lock()
-		h.rooms[*coupleID] = append(h.rooms[*coupleID], userID)
+		h.join(c, *coupleID)
 		h.roomsMu.Unlock()
 	}
 }
 
-func (h *Hub) Remove(userID int64, coupleID *int64) {
+func (h *Hub) Remove(c *client) {
 	h.connsMu.Lock()
-	delete(h.conns, userID)
+	// A replaced connection must not unregister its replacement
+	if h.conns[c.userID] == c {
+		delete(h.conns, c.userID)
+	}
 	h.connsMu.Unlock()
 
-	if coupleID != nil {
-		h.roomsMu.Lock()
-		defer h.roomsMu.Unlock()
-		users := h.rooms[*coupleID]
-		for i, uid := range users {
-			if uid == userID {
-				h.rooms[*coupleID] = append(users[:i], users[i+1:]...)
-				break
-			}
+	h.roomsMu.Lock()
+	h.leave(c)
+	h.roomsMu.Unlock()
+}
+
+// join moves c into the couple's room. The caller holds roomsMu.
+func (h *Hub) join(c *client, coupleID int64) {
+	h.leave(c)
+	c.room = coupleID
+	h.rooms[coupleID] = append(h.rooms[coupleID], c)
+}
+
+// leave takes c out of its room, if any. The caller holds roomsMu.
+func (h *Hub) leave(c *client) {
+	if c.room == 0 {
+		return
+	}
+	members := h.rooms[c.room]
+	for i, m := range members {
+		if m == c {
+			h.rooms[c.room] = append(members[:i], members[i+1:]...)
+			break
+		}
+	}
+	if len(h.rooms[c.room]) == 0 {
+		delete(h.rooms, c.room)
+	}
+	c.room = 0
+}
+
+func (h *Hub) roomOf(c *client) int64 {
+	h.roomsMu.RLock()
+	defer h.roomsMu.RUnlock()
+	return c.room
+}
+
+// JoinRoom moves the users' open sockets into the couple's room, so a
+// couple linked while its members are connected can talk straight away.
+func (h *Hub) JoinRoom(coupleID int64, userIDs ...int64) {
+	h.connsMu.RLock()
+	defer h.connsMu.RUnlock()
+	h.roomsMu.Lock()
+	defer h.roomsMu.Unlock()
+	for _, uid := range userIDs {
+		if c, ok := h.conns[uid]; ok {
+			h.join(c, coupleID)
+		}
+	}
+}
+
+// MemberJoined puts a new member's socket in the couple's room and
+// introduces everyone: joined is told about the member who invited them
+// and the rest of the couple, and each of the others about joined.
+// members is the whole couple, joined included.
+func (h *Hub) MemberJoined(coupleID int64, joined, inviter *database.User, members []database.User) {
+	h.JoinRoom(coupleID, joined.ID)
+	for i := range members {
+		m := &members[i]
+		partner := joined
+		if m.ID == joined.ID {
+			partner = inviter
 		}
-		if len(h.rooms[*coupleID]) == 0 {
-			delete(h.rooms, *coupleID)
+		h.SendToUser(m.ID, map[string]interface{}{
+			"type":      MessagePartnerLinked,
+			"couple_id": coupleID,
+			"partner":   NewPartnerProfile(partner),
+			"members":   partnerProfiles(members, m.ID),
+		})
+	}
+}
+
+// DisconnectSession closes the socket opened by sessionID, if any. It is
+// used when a session is revoked so the device drops off immediately
+// rather than at its next session check.
+func (h *Hub) DisconnectSession(sessionID string) {
+	h.connsMu.RLock()
+	defer h.connsMu.RUnlock()
+	for _, c := range h.conns {
+		if c.sessionID == sessionID {
+			go c.conn.Close(websocket.StatusPolicyViolation, "session revoked")
 		}
 	}
 }
 
+// DisconnectUser closes the user's socket, if any, e.g. when their account
+// is disabled.
+func (h *Hub) DisconnectUser(userID int64, reason string) {
+	h.connsMu.RLock()
+	defer h.connsMu.RUnlock()
+	if c, ok := h.conns[userID]; ok {
+		go c.conn.Close(websocket.StatusPolicyViolation, reason)
+	}
+}
+
+// LeaveRoom takes the user's socket out of its couple's room, once they
+// have left the couple. The socket stays open.
+func (h *Hub) LeaveRoom(userID int64) {
+	h.connsMu.RLock()
+	defer h.connsMu.RUnlock()
+	h.roomsMu.Lock()
+	defer h.roomsMu.Unlock()
+	if c, ok := h.conns[userID]; ok {
+		h.leave(c)
+	}
+}
+
+// DissolveRoom stops relaying messages between the members of a couple
+// that has been unlinked. Their sockets stay open.
+func (h *Hub) DissolveRoom(coupleID int64) {
+	h.roomsMu.Lock()
+	for _, c := range h.rooms[coupleID] {
+		c.room = 0
+	}
+	delete(h.rooms, coupleID)
+	h.roomsMu.Unlock()
+}
+
 func (h *Hub) BroadcastToCouple(coupleID int64, message interface{}, excludeUserID int64) {
 	h.roomsMu.RLock()
-	userIDs := h.rooms[coupleID]
+	members := append([]*client(nil), h.rooms[coupleID]...)
 	h.roomsMu.RUnlock()
 
-	for _, uid := range userIDs {
-		if uid == excludeUserID {
+	for _, c := range members {
+		if c.userID == excludeUserID {
 			continue
 		}
+		go func(c *client) {
+			err := wsjson.Write(context.Background(), c.conn, message)
+			if err != nil {
+				log.Printf("failed to write to websocket: %v", err)
+			}
+		}(c)
+	}
+}
 
-		h.connsMu.RLock()
-		conn, ok := h.conns[uid]
-		h.connsMu.RUnlock()
+// SendToUser delivers message to the user's socket, if they have one open.
+func (h *Hub) SendToUser(userID int64, message interface{}) {
+	h.connsMu.RLock()
+	c, ok := h.conns[userID]
+	h.connsMu.RUnlock()
+	if !ok {
+		return
+	}
 
-		if ok {
-			go func(c *websocket.Conn) {
-				err := wsjson.Write(context.Background(), c, message)
-				if err != nil {
-					log.Printf("failed to write to websocket: %v", err)
-				}
-			}(conn)
+	go func() {
+		if err := wsjson.Write(context.Background(), c.conn, message); err != nil {
+			log.Printf("failed to write to websocket: %v", err)
 		}
+	}()
+}
+
+// IssueTicket mints a single-use ticket for opening a socket. Browsers
+// cannot set headers on WebSocket requests, so the ticket travels in the
+// query string instead of the access token; it is useless once redeemed.
+func (h *Hub) IssueTicket(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(middleware.UserIDKey).(int64)
+	sessionID := r.Context().Value(middleware.SessionIDKey).(string)
+	authExpiresAt := r.Context().Value(middleware.TokenExpiryKey).(time.Time)
+
+	ticket, err := auth.RandomToken(32)
+	if err != nil {
+		problem.Internal(w)
+		return
+	}
+	t := database.WSTicket{UserID: userID, SessionID: sessionID, AuthExpiresAt: authExpiresAt}
+	if err := h.db.CreateWSTicket(r.Context(), auth.HashToken(ticket), t, TicketTTL); err != nil {
+		problem.Internal(w)
+		return
 	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"ticket":     ticket,
+		"expires_at": time.Now().Add(TicketTTL),
+	})
 }
 
 func (h *Hub) HandleWebSocket(w http.ResponseWriter, r *http.Request) {
 	// 1. Authenticate
-	userIDVal := r.Context().Value(middleware.UserIDKey)
-	if userIDVal == nil {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+	ticketParam := r.URL.Query().Get("ticket")
+	if ticketParam == "" {
+		problem.Write(w, problem.CodeAuthRequired, "")
 		return
 	}
-	userID, ok := userIDVal.(int64)
-	if !ok {
-		http.Error(w, "Invalid user ID", http.StatusUnauthorized)
+	ticket, err := h.db.ConsumeWSTicket(r.Context(), auth.HashToken(ticketParam))
+	if err != nil {
+		problem.Internal(w)
+		return
+	}
+	if ticket == nil {
+		problem.Write(w, problem.CodeInvalidToken, "Invalid or expired ticket")
+		return
+	}
+	session, err := h.db.GetSession(r.Context(), ticket.SessionID)
+	if err != nil {
+		problem.Internal(w)
+		return
+	}
+	if session == nil || session.UserID != ticket.UserID {
+		problem.Write(w, problem.CodeSessionRevoked, "")
 		return
 	}
+	userID := ticket.UserID
 
 	// Fetch user to get couple_id
 	user, err := h.db.GetUserByID(r.Context(), userID)
 	if err != nil {
-		http.Error(w, "Failed to fetch user", http.StatusInternalServerError)
+		problem.Internal(w)
 		return
 	}
 	if user == nil {
-		http.Error(w, "User not found", http.StatusUnauthorized)
+		problem.Write(w, problem.CodeNotFound, "User not found")
 		return
 	}
 
 	// 2. Upgrade
-	c, err := websocket.Accept(w, r, &websocket.AcceptOptions{
+	conn, err := websocket.Accept(w, r, &websocket.AcceptOptions{
 		OriginPatterns: []string{"*"}, // Allow all origins for now
 	})
 	if err != nil {
@@ -127,20 +298,23 @@ func (h *Hub) HandleWebSocket(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// 3. Register
-	h.Add(userID, user.CoupleID, c)
+	c := newClient(conn, userID, ticket.SessionID, ticket.AuthExpiresAt)
+	h.Add(c, user.CoupleID)
 	log.Printf("User %d connected via WebSocket", userID)
 
 	// 4. Listen (Keep connection open)
-	ctx := r.Context()
+	ctx, cancel := context.WithCancel(r.Context())
 	defer func() {
-		h.Remove(userID, user.CoupleID)
-		c.Close(websocket.StatusNormalClosure, "")
+		cancel()
+		h.Remove(c)
+		conn.Close(websocket.StatusNormalClosure, "")
 	}()
+	go h.watchAuth(ctx, c)
 
 	for {
 		// Read loop
 		var msg map[string]interface{}
-		err := wsjson.Read(ctx, c, &msg)
+		err := wsjson.Read(ctx, conn, &msg)
 		if err != nil {
 			if websocket.CloseStatus(err) == websocket.StatusNormalClosure ||
 				websocket.CloseStatus(err) == websocket.StatusGoingAway {
@@ -154,9 +328,15 @@ func (h *Hub) HandleWebSocket(w http.ResponseWriter, r *http.Request) {
 		if msgType, ok := msg["type"].(string); ok {
 			switch msgType {
 			case "move", "TOUCH_START", "TOUCH_END":
-				if user.CoupleID != nil {
-					h.BroadcastToCouple(*user.CoupleID, msg, userID)
+				// The room can change while connected; see JoinRoom.
+				// Rooms can hold more than two, so say who it is from.
+				if room := h.roomOf(c); room != 0 {
+					msg["from"] = userID
+					h.BroadcastToCouple(room, msg, userID)
 				}
+			case MessageAuth:
+				token, _ := msg["token"].(string)
+				h.reauthenticate(ctx, c, token)
 			}
 		}
 	}
@@ -0,0 +1,49 @@
+package websocket
+
+import (
+	"sort"
+	"time"
+)
+
+// ConnectionState describes one open socket.
+type ConnectionState struct {
+	UserID        int64     `json:"user_id"`
+	SessionID     string    `json:"session_id"`
+	ConnectedAt   time.Time `json:"connected_at"`
+	AuthExpiresAt time.Time `json:"auth_expires_at"`
+}
+
+// State is a point-in-time view of the hub for operators.
+type State struct {
+	Connections []ConnectionState `json:"connections"`
+	// Rooms maps couple IDs to the connected members.
+	Rooms map[int64][]int64 `json:"rooms"`
+}
+
+func (h *Hub) State() State {
+	state := State{Connections: []ConnectionState{}, Rooms: map[int64][]int64{}}
+
+	h.connsMu.RLock()
+	for _, c := range h.conns {
+		state.Connections = append(state.Connections, ConnectionState{
+			UserID:        c.userID,
+			SessionID:     c.sessionID,
+			ConnectedAt:   c.connectedAt,
+			AuthExpiresAt: c.authExpiry(),
+		})
+	}
+	h.connsMu.RUnlock()
+	sort.Slice(state.Connections, func(i, j int) bool {
+		return state.Connections[i].UserID < state.Connections[j].UserID
+	})
+
+	h.roomsMu.RLock()
+	for coupleID, members := range h.rooms {
+		for _, c := range members {
+			state.Rooms[coupleID] = append(state.Rooms[coupleID], c.userID)
+		}
+	}
+	h.roomsMu.RUnlock()
+
+	return state
+}
@@ -0,0 +1,7 @@
+-- Canonicalize existing emails. If this leaves duplicates, they must be
+-- merged by hand before the unique index below can be created.
+UPDATE users SET email = lower(trim(email));
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_email_lower ON users (lower(email));
+
+ALTER TABLE users ADD COLUMN email_verified_at TIMESTAMPTZ;
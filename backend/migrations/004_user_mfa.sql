@@ -0,0 +1,9 @@
+-- TOTP second factor. The secret is AES-GCM encrypted by the application;
+-- recovery codes are stored as SHA-256 hashes and removed once used.
+CREATE TABLE user_mfa (
+    user_id BIGINT PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    totp_secret_encrypted BYTEA NOT NULL,
+    recovery_code_hashes TEXT[] NOT NULL DEFAULT '{}',
+    enabled_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
@@ -0,0 +1,13 @@
+-- Asymmetric JWT signing keys. Private keys are AES-GCM encrypted by the
+-- application; public keys are PKIX DER and published via JWKS.
+CREATE TABLE signing_keys (
+    kid TEXT PRIMARY KEY,
+    algorithm TEXT NOT NULL,
+    private_key_encrypted BYTEA NOT NULL,
+    public_key BYTEA NOT NULL,
+    activates_at TIMESTAMPTZ NOT NULL,
+    expires_at TIMESTAMPTZ NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_signing_keys_expires_at ON signing_keys(expires_at);
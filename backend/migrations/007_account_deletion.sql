@@ -0,0 +1,10 @@
+-- Accounts are hard-deleted by a background job once the grace period ends.
+ALTER TABLE users ADD COLUMN deletion_scheduled_at TIMESTAMPTZ;
+CREATE INDEX idx_users_deletion_scheduled_at ON users(deletion_scheduled_at) WHERE deletion_scheduled_at IS NOT NULL;
+
+-- A couple outlives a deleted member so the partner's own vault items keep
+-- their couple; the deleted member's slot is cleared and the couple is
+-- marked dissolved.
+ALTER TABLE couples ALTER COLUMN user1_id DROP NOT NULL;
+ALTER TABLE couples ALTER COLUMN user2_id DROP NOT NULL;
+ALTER TABLE couples ADD COLUMN dissolved_at TIMESTAMPTZ;
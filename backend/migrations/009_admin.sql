@@ -0,0 +1,22 @@
+-- Operators are ordinary accounts with role 'admin'. There is no API for
+-- granting the role; promote an account with
+--   UPDATE users SET role = 'admin' WHERE email = '...';
+ALTER TABLE users ADD COLUMN role TEXT NOT NULL DEFAULT 'user' CHECK (role IN ('user', 'admin'));
+
+-- Disabled accounts cannot log in; their sessions and tokens are revoked
+-- when they are disabled.
+ALTER TABLE users ADD COLUMN disabled_at TIMESTAMPTZ;
+
+-- Every request an admin makes through the admin API, reads included. The
+-- admin is kept as NULL if their account is later deleted.
+CREATE TABLE admin_audit_log (
+    id BIGSERIAL PRIMARY KEY,
+    admin_id BIGINT REFERENCES users(id) ON DELETE SET NULL,
+    action TEXT NOT NULL,
+    target_user_id BIGINT,
+    target_couple_id BIGINT,
+    details JSONB NOT NULL DEFAULT '{}',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_admin_audit_log_created_at ON admin_audit_log(created_at);
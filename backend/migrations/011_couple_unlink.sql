@@ -0,0 +1,12 @@
+-- Either member can ask to unlink. The couple is dissolved once
+-- unlink_scheduled_at passes unless someone cancels first; the requester's
+-- vault_disposition then decides what happens to the shared vault items:
+--   archive  both former members keep read-only access
+--   delete   the items are deleted
+--   export   as delete, after both members were told to export them
+ALTER TABLE couples ADD COLUMN unlink_requested_by BIGINT REFERENCES users(id) ON DELETE SET NULL;
+ALTER TABLE couples ADD COLUMN unlink_scheduled_at TIMESTAMPTZ;
+ALTER TABLE couples ADD COLUMN vault_disposition TEXT CHECK (vault_disposition IN ('archive', 'delete', 'export'));
+
+CREATE INDEX idx_couples_unlink_scheduled_at ON couples(unlink_scheduled_at)
+    WHERE unlink_scheduled_at IS NOT NULL AND dissolved_at IS NULL;
@@ -0,0 +1,30 @@
+-- Membership is tracked per user so the database can guarantee that nobody
+-- is in more than one active couple at a time. users.couple_id and the
+-- couples.user1_id/user2_id pair are kept as before.
+CREATE TABLE couple_members (
+    couple_id BIGINT NOT NULL REFERENCES couples(id) ON DELETE CASCADE,
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    joined_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    left_at TIMESTAMPTZ,
+    PRIMARY KEY (couple_id, user_id)
+);
+
+CREATE UNIQUE INDEX idx_couple_members_one_active ON couple_members(user_id) WHERE left_at IS NULL;
+
+ALTER TABLE couples ADD CONSTRAINT couples_distinct_members CHECK (user1_id <> user2_id);
+
+-- Before this migration a user could be linked twice, leaving couples that
+-- neither member points at any more. Dissolve those before backfilling.
+UPDATE couples c
+SET dissolved_at = NOW()
+WHERE dissolved_at IS NULL
+    AND NOT EXISTS (SELECT 1 FROM users u WHERE u.couple_id = c.id);
+
+INSERT INTO couple_members (couple_id, user_id, joined_at, left_at)
+SELECT c.id, m.user_id, c.created_at,
+    CASE WHEN c.dissolved_at IS NOT NULL THEN c.dissolved_at
+         WHEN u.couple_id IS DISTINCT FROM c.id THEN NOW()
+    END
+FROM couples c
+CROSS JOIN LATERAL (VALUES (c.user1_id), (c.user2_id)) AS m(user_id)
+JOIN users u ON u.id = m.user_id;
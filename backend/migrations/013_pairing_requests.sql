@@ -0,0 +1,15 @@
+-- Redeeming a pairing code no longer links the two users; it asks the
+-- code's owner, who has until expires_at to accept or reject. A pending
+-- request past expires_at is treated as expired.
+CREATE TABLE pairing_requests (
+    id BIGSERIAL PRIMARY KEY,
+    owner_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    requester_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    status TEXT NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'accepted', 'rejected')),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    expires_at TIMESTAMPTZ NOT NULL,
+    responded_at TIMESTAMPTZ
+);
+
+CREATE INDEX idx_pairing_requests_owner_id ON pairing_requests(owner_id) WHERE status = 'pending';
+CREATE INDEX idx_pairing_requests_requester_id ON pairing_requests(requester_id) WHERE status = 'pending';
@@ -0,0 +1,16 @@
+-- Couples become pods of any size: couple_members is the only record of
+-- who is in one, and says who may invite. The fixed user1_id/user2_id
+-- slots go away.
+ALTER TABLE couple_members ADD COLUMN role TEXT NOT NULL DEFAULT 'member' CHECK (role IN ('owner', 'member'));
+
+-- user1 was the code's owner, so they invited the other
+UPDATE couple_members m
+SET role = 'owner'
+FROM couples c
+WHERE c.id = m.couple_id AND c.user1_id = m.user_id;
+
+ALTER TABLE couples DROP CONSTRAINT couples_distinct_members;
+ALTER TABLE couples DROP COLUMN user1_id;
+ALTER TABLE couples DROP COLUMN user2_id;
+
+CREATE INDEX idx_couple_members_couple_id ON couple_members(couple_id) WHERE left_at IS NULL;
@@ -0,0 +1,17 @@
+-- What a couple says about itself. Every member can edit it; version goes
+-- up on each change so that an edit based on a stale read is refused
+-- rather than silently overwriting someone else's.
+CREATE TABLE couple_profiles (
+    couple_id BIGINT PRIMARY KEY REFERENCES couples(id) ON DELETE CASCADE,
+    display_name TEXT NOT NULL DEFAULT '',
+    anniversary DATE,
+    relationship_start DATE,
+    cover_image_url TEXT NOT NULL DEFAULT '',
+    preferences JSONB NOT NULL DEFAULT '{}' CHECK (jsonb_typeof(preferences) = 'object'),
+    version BIGINT NOT NULL DEFAULT 1,
+    updated_by BIGINT REFERENCES users(id) ON DELETE SET NULL,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+INSERT INTO couple_profiles (couple_id)
+SELECT id FROM couples;
@@ -0,0 +1,6 @@
+-- What a user says about themselves, edited through /me/profile.
+-- avatar_config (from 001) holds a document the avatar package validates;
+-- nothing wrote it before, so it is still NULL everywhere.
+ALTER TABLE users ADD COLUMN display_name TEXT NOT NULL DEFAULT '';
+ALTER TABLE users ADD COLUMN pronouns TEXT NOT NULL DEFAULT '';
+ALTER TABLE users ADD COLUMN timezone TEXT NOT NULL DEFAULT 'UTC';
@@ -0,0 +1,15 @@
+-- Audit events may only be deleted along with their user, by the ON DELETE
+-- CASCADE from users. That delete runs from the foreign key's own trigger,
+-- so a direct DELETE is the only one seen at trigger depth 1.
+CREATE FUNCTION audit_events_cascade_only() RETURNS trigger AS $$
+BEGIN
+    IF pg_trigger_depth() < 2 THEN
+        RAISE EXCEPTION 'audit_events is append-only';
+    END IF;
+    RETURN OLD;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER audit_events_no_delete
+    BEFORE DELETE ON audit_events
+    FOR EACH ROW EXECUTE FUNCTION audit_events_cascade_only();
@@ -0,0 +1,7 @@
+-- A member who left can be invited back into the same couple, so each stint
+-- is its own row. idx_couple_members_one_active still keeps a user to one
+-- active membership.
+ALTER TABLE couple_members DROP CONSTRAINT couple_members_pkey;
+ALTER TABLE couple_members ADD COLUMN id BIGSERIAL PRIMARY KEY;
+
+CREATE INDEX idx_couple_members_couple_user ON couple_members(couple_id, user_id);
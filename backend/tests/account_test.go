@@ -0,0 +1,147 @@
+package tests
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/bit2swaz/junto/internal/handlers"
+	"github.com/bit2swaz/junto/internal/jobs"
+	"github.com/bit2swaz/junto/internal/mailer"
+	"github.com/bit2swaz/junto/internal/middleware"
+	wsInternal "github.com/bit2swaz/junto/internal/websocket"
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAccountDeletion(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	keys := setupTestKeys(t, db)
+
+	outbox := mailer.NewOutbox("")
+	authHandler := &handlers.AuthHandler{DB: db, Mailer: outbox, Keys: keys}
+	accountHandler := &handlers.AccountHandler{DB: db, Mailer: outbox}
+	hub := wsInternal.NewHub(db, keys)
+	coupleHandler := &handlers.CoupleHandler{DB: db, Hub: hub}
+	vaultHandler := &handlers.VaultHandler{DB: db}
+
+	r := chi.NewRouter()
+	r.Post("/register", authHandler.Register)
+	r.Post("/login", authHandler.Login)
+	r.Group(func(r chi.Router) {
+		r.Use(middleware.AuthMiddleware(db, keys))
+		r.Get("/me", authHandler.Me)
+		r.Delete("/me", accountHandler.DeleteAccount)
+		r.Post("/me/deletion/cancel", accountHandler.CancelDeletion)
+		r.Get("/me/export", accountHandler.ExportData)
+		r.Post("/couples/code", coupleHandler.GeneratePairingCode)
+		r.Post("/couples/link", coupleHandler.LinkPartner)
+		r.Post("/couples/requests/{id}/accept", coupleHandler.AcceptPairingRequest)
+		r.Post("/vault", vaultHandler.AddToVault)
+		r.Get("/vault", vaultHandler.GetVaultItems)
+	})
+
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+	client := ts.Client()
+
+	emailA, emailB := "alice@example.com", "bob@example.com"
+	registerUser(t, client, ts.URL, emailA, "password123")
+	registerUser(t, client, ts.URL, emailB, "password123")
+	tokenA := loginUser(t, client, ts.URL, emailA, "password123")
+	tokenB := loginUser(t, client, ts.URL, emailB, "password123")
+	linkPartner(t, client, ts.URL, tokenA, tokenB, generatePairingCode(t, client, ts.URL, tokenA))
+
+	createVaultItem(t, client, ts.URL, tokenA, "from alice", time.Now().Add(-time.Hour))
+	createVaultItem(t, client, ts.URL, tokenB, "from bob", time.Now().Add(24*time.Hour))
+
+	t.Run("Export", func(t *testing.T) {
+		req, _ := http.NewRequest("GET", ts.URL+"/me/export", nil)
+		req.Header.Set("Authorization", "Bearer "+tokenA)
+		resp, err := client.Do(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, "application/zip", resp.Header.Get("Content-Type"))
+
+		body, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		zr, err := zip.NewReader(bytes.NewReader(body), int64(len(body)))
+		require.NoError(t, err)
+
+		files := map[string][]byte{}
+		for _, f := range zr.File {
+			rc, err := f.Open()
+			require.NoError(t, err)
+			files[f.Name], _ = io.ReadAll(rc)
+			rc.Close()
+		}
+		for _, name := range []string{
+			"user.json", "couple.json", "couple_profile.json", "pairing_requests.json", "vault_items.json",
+			"identities.json", "sessions.json", "access_tokens.json", "security.json",
+		} {
+			assert.Contains(t, files, name)
+		}
+		assert.NotContains(t, string(files["user.json"]), "password")
+		assert.Contains(t, string(files["sessions.json"]), "device_name")
+		assert.NotContains(t, string(files["sessions.json"]), "refresh")
+		assert.Contains(t, string(files["pairing_requests.json"]), "accepted")
+		assert.Contains(t, string(files["vault_items.json"]), "from alice")
+		assert.NotContains(t, string(files["vault_items.json"]), "from bob", "locked partner items stay locked")
+	})
+
+	t.Run("ScheduleAndCancel", func(t *testing.T) {
+		var resp map[string]interface{}
+		require.Equal(t, http.StatusAccepted, doJSON(t, client, "DELETE", ts.URL+"/me", tokenA, nil, &resp))
+		assert.NotEmpty(t, resp["deletion_scheduled_at"])
+		_, ok := outbox.Last(emailA)
+		assert.True(t, ok)
+
+		require.Equal(t, http.StatusOK, postWithToken(t, client, ts.URL+"/me/deletion/cancel", tokenA))
+		user, err := db.GetUserByEmail(context.Background(), emailA)
+		require.NoError(t, err)
+		assert.Nil(t, user.DeletionScheduledAt)
+	})
+
+	t.Run("HardDeleteAfterGrace", func(t *testing.T) {
+		require.Equal(t, http.StatusAccepted, doJSON(t, client, "DELETE", ts.URL+"/me", tokenA, nil, nil))
+
+		job := &jobs.AccountDeletion{DB: db, Hub: hub, Interval: time.Hour}
+		n, err := job.RunOnce(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, 0, n, "nothing is due during the grace period")
+
+		user, err := db.GetUserByEmail(context.Background(), emailA)
+		require.NoError(t, err)
+		require.NoError(t, db.ScheduleUserDeletion(context.Background(), user.ID, time.Now().Add(-time.Minute)))
+
+		n, err = job.RunOnce(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, 1, n)
+
+		user, err = db.GetUserByEmail(context.Background(), emailA)
+		require.NoError(t, err)
+		assert.Nil(t, user)
+		assert.Equal(t, http.StatusUnauthorized, getWithToken(t, client, ts.URL+"/me", tokenA))
+
+		var me struct {
+			ID       int64  `json:"id"`
+			CoupleID *int64 `json:"couple_id"`
+		}
+		require.Equal(t, http.StatusOK, doJSON(t, client, "GET", ts.URL+"/me", tokenB, nil, &me))
+		assert.Nil(t, me.CoupleID, "partner is unlinked")
+
+		items, err := db.GetVaultItemsForExport(context.Background(), me.ID, nil)
+		require.NoError(t, err)
+		for _, item := range items {
+			assert.NotEqual(t, "from alice", item.ContentText)
+		}
+	})
+}
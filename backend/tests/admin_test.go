@@ -0,0 +1,155 @@
+package tests
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/bit2swaz/junto/internal/database"
+	"github.com/bit2swaz/junto/internal/handlers"
+	"github.com/bit2swaz/junto/internal/mailer"
+	"github.com/bit2swaz/junto/internal/middleware"
+	wsInternal "github.com/bit2swaz/junto/internal/websocket"
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAdminAPI(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	keys := setupTestKeys(t, db)
+
+	authHandler := &handlers.AuthHandler{DB: db, Mailer: mailer.NewOutbox(""), Keys: keys}
+	hub := wsInternal.NewHub(db, keys)
+	coupleHandler := &handlers.CoupleHandler{DB: db, Hub: hub}
+	adminHandler := &handlers.AdminHandler{DB: db, Hub: hub}
+
+	r := chi.NewRouter()
+	r.Post("/register", authHandler.Register)
+	r.Post("/login", authHandler.Login)
+	r.Group(func(r chi.Router) {
+		r.Use(middleware.AuthMiddleware(db, keys))
+		r.Use(middleware.RequireSession)
+		r.Get("/me", authHandler.Me)
+		r.Post("/couples/code", coupleHandler.GeneratePairingCode)
+		r.Post("/couples/link", coupleHandler.LinkPartner)
+		r.Post("/couples/requests/{id}/accept", coupleHandler.AcceptPairingRequest)
+		r.Route("/admin", func(r chi.Router) {
+			r.Use(middleware.RequireAdmin(db))
+			r.Get("/users", adminHandler.SearchUsers)
+			r.Post("/users/{id}/disable", adminHandler.DisableUser)
+			r.Post("/users/{id}/enable", adminHandler.EnableUser)
+			r.Get("/couples/{id}", adminHandler.GetCouple)
+			r.Post("/couples/{id}/unlink", adminHandler.UnlinkCouple)
+			r.Get("/hub", adminHandler.HubState)
+			r.Get("/audit", adminHandler.AuditLog)
+		})
+	})
+
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+	client := ts.Client()
+	ctx := context.Background()
+
+	for _, email := range []string{"admin@example.com", "member-a@example.com", "member-b@example.com"} {
+		registerUser(t, client, ts.URL, email, "password123")
+		verifyEmail(t, db, email)
+	}
+	_, err := db.GetPool().Exec(ctx, `UPDATE users SET role = 'admin' WHERE email = 'admin@example.com'`)
+	require.NoError(t, err)
+
+	adminToken := loginUser(t, client, ts.URL, "admin@example.com", "password123")
+	tokenA := loginUser(t, client, ts.URL, "member-a@example.com", "password123")
+	tokenB := loginUser(t, client, ts.URL, "member-b@example.com", "password123")
+	linkPartner(t, client, ts.URL, tokenA, tokenB, generatePairingCode(t, client, ts.URL, tokenA))
+
+	memberA, err := db.GetUserByEmail(ctx, "member-a@example.com")
+	require.NoError(t, err)
+	reason := map[string]string{"reason": "support ticket 42"}
+
+	t.Run("NonAdminForbidden", func(t *testing.T) {
+		assert.Equal(t, http.StatusForbidden, doJSON(t, client, "GET", ts.URL+"/admin/users?q=member", tokenA, nil, nil))
+		assert.Equal(t, http.StatusForbidden, doJSON(t, client, "GET", ts.URL+"/admin/hub", tokenA, nil, nil))
+	})
+
+	t.Run("SearchUsers", func(t *testing.T) {
+		var users []database.User
+		require.Equal(t, http.StatusOK, doJSON(t, client, "GET", ts.URL+"/admin/users?q=member-", adminToken, nil, &users))
+		assert.Len(t, users, 2)
+
+		require.Equal(t, http.StatusOK, doJSON(t, client, "GET", ts.URL+"/admin/users?q=_", adminToken, nil, &users))
+		assert.Empty(t, users, "LIKE wildcards in the query are literal")
+
+		require.Equal(t, http.StatusOK, doJSON(t, client, "GET", fmt.Sprintf("%s/admin/users?q=%d", ts.URL, memberA.ID), adminToken, nil, &users))
+		require.NotEmpty(t, users)
+		assert.Equal(t, memberA.ID, users[0].ID)
+	})
+
+	t.Run("ViewAndUnlinkCouple", func(t *testing.T) {
+		require.NotNil(t, memberA.CoupleID)
+		url := fmt.Sprintf("%s/admin/couples/%d", ts.URL, *memberA.CoupleID)
+
+		var couple handlers.AdminCoupleResponse
+		require.Equal(t, http.StatusOK, doJSON(t, client, "GET", url, adminToken, nil, &couple))
+		assert.Len(t, couple.Members, 2)
+
+		assert.Equal(t, http.StatusBadRequest, doJSON(t, client, "POST", url+"/unlink", adminToken, map[string]string{}, nil))
+		assert.Equal(t, http.StatusNoContent, doJSON(t, client, "POST", url+"/unlink", adminToken, reason, nil))
+		assert.Equal(t, http.StatusNotFound, doJSON(t, client, "POST", url+"/unlink", adminToken, reason, nil))
+
+		for _, email := range []string{"member-a@example.com", "member-b@example.com"} {
+			user, err := db.GetUserByEmail(ctx, email)
+			require.NoError(t, err)
+			assert.Nil(t, user.CoupleID)
+		}
+	})
+
+	t.Run("DisableAndEnable", func(t *testing.T) {
+		url := fmt.Sprintf("%s/admin/users/%d", ts.URL, memberA.ID)
+		require.Equal(t, http.StatusNoContent, doJSON(t, client, "POST", url+"/disable", adminToken, reason, nil))
+
+		assert.Equal(t, http.StatusUnauthorized, doJSON(t, client, "GET", ts.URL+"/me", tokenA, nil, nil))
+		login := map[string]string{"email": "member-a@example.com", "password": "password123"}
+		assert.Equal(t, http.StatusForbidden, doJSON(t, client, "POST", ts.URL+"/login", "", login, nil))
+
+		require.Equal(t, http.StatusNoContent, doJSON(t, client, "POST", url+"/enable", adminToken, reason, nil))
+		assert.Equal(t, http.StatusOK, doJSON(t, client, "POST", ts.URL+"/login", "", login, nil))
+	})
+
+	t.Run("CannotDisableSelf", func(t *testing.T) {
+		admin, err := db.GetUserByEmail(ctx, "admin@example.com")
+		require.NoError(t, err)
+		url := fmt.Sprintf("%s/admin/users/%d/disable", ts.URL, admin.ID)
+		assert.Equal(t, http.StatusForbidden, doJSON(t, client, "POST", url, adminToken, reason, nil))
+	})
+
+	t.Run("HubState", func(t *testing.T) {
+		var state wsInternal.State
+		require.Equal(t, http.StatusOK, doJSON(t, client, "GET", ts.URL+"/admin/hub", adminToken, nil, &state))
+		assert.NotNil(t, state.Connections)
+	})
+
+	t.Run("AuditTrail", func(t *testing.T) {
+		var actions []database.AdminAction
+		require.Equal(t, http.StatusOK, doJSON(t, client, "GET", ts.URL+"/admin/audit", adminToken, nil, &actions))
+
+		seen := map[string]bool{}
+		for _, a := range actions {
+			seen[a.Action] = true
+		}
+		for _, action := range []string{
+			handlers.AdminActionSearchUsers,
+			handlers.AdminActionViewCouple,
+			handlers.AdminActionUnlinkCouple,
+			handlers.AdminActionDisableUser,
+			handlers.AdminActionEnableUser,
+			handlers.AdminActionViewHub,
+			handlers.AdminActionViewAuditLog,
+		} {
+			assert.True(t, seen[action], action)
+		}
+	})
+}
@@ -0,0 +1,125 @@
+package tests
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/bit2swaz/junto/internal/database"
+	"github.com/bit2swaz/junto/internal/handlers"
+	"github.com/bit2swaz/junto/internal/mailer"
+	"github.com/bit2swaz/junto/internal/middleware"
+	wsInternal "github.com/bit2swaz/junto/internal/websocket"
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSecurityEvents(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	keys := setupTestKeys(t, db)
+
+	authHandler := &handlers.AuthHandler{DB: db, Mailer: mailer.NewOutbox(""), Keys: keys}
+	accountHandler := &handlers.AccountHandler{DB: db, Mailer: authHandler.Mailer}
+	coupleHandler := &handlers.CoupleHandler{DB: db, Hub: wsInternal.NewHub(db, keys)}
+	vaultHandler := &handlers.VaultHandler{DB: db}
+
+	r := chi.NewRouter()
+	r.Post("/register", authHandler.Register)
+	r.Post("/login", authHandler.Login)
+	r.Group(func(r chi.Router) {
+		r.Use(middleware.AuthMiddleware(db, keys))
+		r.Post("/logout", authHandler.Logout)
+		r.Get("/me/security-events", accountHandler.SecurityEvents)
+		r.Post("/couples/code", coupleHandler.GeneratePairingCode)
+		r.Post("/couples/link", coupleHandler.LinkPartner)
+		r.Post("/couples/requests/{id}/accept", coupleHandler.AcceptPairingRequest)
+		r.Post("/vault", vaultHandler.AddToVault)
+	})
+
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+	client := ts.Client()
+
+	registerUser(t, client, ts.URL, "audit-a@example.com", "password123")
+	registerUser(t, client, ts.URL, "audit-b@example.com", "password123")
+	verifyEmail(t, db, "audit-a@example.com")
+	verifyEmail(t, db, "audit-b@example.com")
+
+	wrong := map[string]string{"email": "audit-a@example.com", "password": "wrong-password"}
+	require.Equal(t, http.StatusUnauthorized, doJSON(t, client, "POST", ts.URL+"/login", "", wrong, nil))
+	unknown := map[string]string{"email": "nobody@example.com", "password": "password123"}
+	require.Equal(t, http.StatusUnauthorized, doJSON(t, client, "POST", ts.URL+"/login", "", unknown, nil))
+
+	tokenA := loginUser(t, client, ts.URL, "audit-a@example.com", "password123")
+	tokenB := loginUser(t, client, ts.URL, "audit-b@example.com", "password123")
+	linkPartner(t, client, ts.URL, tokenA, tokenB, generatePairingCode(t, client, ts.URL, tokenA))
+	createVaultItem(t, client, ts.URL, tokenA, "for later", time.Now().Add(time.Hour))
+
+	otherA := loginUser(t, client, ts.URL, "audit-a@example.com", "password123")
+	require.Equal(t, http.StatusOK, postWithToken(t, client, ts.URL+"/logout", otherA))
+
+	types := func(events []database.AuditEvent) []string {
+		out := make([]string, len(events))
+		for i, e := range events {
+			out[i] = e.Type
+		}
+		return out
+	}
+
+	t.Run("OwnHistoryNewestFirst", func(t *testing.T) {
+		var events []database.AuditEvent
+		require.Equal(t, http.StatusOK, doJSON(t, client, "GET", ts.URL+"/me/security-events", tokenA, nil, &events))
+		assert.Equal(t, []string{
+			database.AuditLogout,
+			database.AuditLogin,
+			database.AuditVaultItemCreated,
+			database.AuditCoupleLinked,
+			database.AuditPairingCodeCreated,
+			database.AuditLogin,
+			database.AuditLoginFailed,
+		}, types(events))
+		assert.Equal(t, "password", events[len(events)-1].Metadata["method"])
+		assert.NotEmpty(t, events[0].IP)
+	})
+
+	t.Run("PartnerSeesLink", func(t *testing.T) {
+		var events []database.AuditEvent
+		require.Equal(t, http.StatusOK, doJSON(t, client, "GET", ts.URL+"/me/security-events", tokenB, nil, &events))
+		assert.Equal(t, []string{database.AuditCoupleLinked, database.AuditPairingRequested, database.AuditLogin}, types(events))
+	})
+
+	t.Run("Paging", func(t *testing.T) {
+		var page1, page2 []database.AuditEvent
+		require.Equal(t, http.StatusOK, doJSON(t, client, "GET", ts.URL+"/me/security-events?limit=3", tokenA, nil, &page1))
+		require.Len(t, page1, 3)
+
+		url := fmt.Sprintf("%s/me/security-events?limit=3&before=%d", ts.URL, page1[2].ID)
+		require.Equal(t, http.StatusOK, doJSON(t, client, "GET", url, tokenA, nil, &page2))
+		require.Len(t, page2, 3)
+		assert.Less(t, page2[0].ID, page1[2].ID)
+
+		assert.Equal(t, http.StatusBadRequest, doJSON(t, client, "GET", ts.URL+"/me/security-events?before=x", tokenA, nil, nil))
+	})
+
+	t.Run("AppendOnly", func(t *testing.T) {
+		ctx := context.Background()
+		_, err := db.GetPool().Exec(ctx, `UPDATE audit_events SET event_type = 'tampered'`)
+		assert.Error(t, err)
+		_, err = db.GetPool().Exec(ctx, `DELETE FROM audit_events`)
+		assert.Error(t, err)
+
+		// Deleting the user still takes their history with them
+		userB, err := db.GetUserByEmail(ctx, "audit-b@example.com")
+		require.NoError(t, err)
+		_, err = db.DeleteUser(ctx, userB.ID)
+		require.NoError(t, err)
+		var left int
+		require.NoError(t, db.GetPool().QueryRow(ctx, `SELECT COUNT(*) FROM audit_events WHERE user_id = $1`, userB.ID).Scan(&left))
+		assert.Zero(t, left)
+	})
+}
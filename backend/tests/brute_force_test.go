@@ -0,0 +1,79 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/bit2swaz/junto/internal/handlers"
+	"github.com/bit2swaz/junto/internal/mailer"
+	"github.com/bit2swaz/junto/internal/middleware"
+	wsInternal "github.com/bit2swaz/junto/internal/websocket"
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBruteForceProtection(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	keys := setupTestKeys(t, db)
+
+	authHandler := &handlers.AuthHandler{DB: db, Mailer: mailer.NewOutbox(""), Keys: keys}
+	coupleHandler := &handlers.CoupleHandler{DB: db, Hub: wsInternal.NewHub(db, keys)}
+
+	r := chi.NewRouter()
+	r.Post("/register", authHandler.Register)
+	r.Post("/login", authHandler.Login)
+	r.Group(func(r chi.Router) {
+		r.Use(middleware.AuthMiddleware(db, keys))
+		r.With(middleware.RequireVerifiedEmail(db)).Post("/couples/link", coupleHandler.LinkPartner)
+		r.With(middleware.RequireVerifiedEmail(db)).Post("/couples/requests/{id}/accept", coupleHandler.AcceptPairingRequest)
+	})
+
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+	client := ts.Client()
+
+	t.Run("LoginLockout", func(t *testing.T) {
+		email := "victim@example.com"
+		registerUser(t, client, ts.URL, email, "correct-password")
+
+		wrong := map[string]string{"email": email, "password": "wrong"}
+		for i := 0; i < 5; i++ {
+			assert.Equal(t, http.StatusUnauthorized, postJSON(t, client, ts.URL+"/login", wrong))
+		}
+
+		resp := postRaw(t, client, ts.URL+"/login", wrong)
+		assert.Equal(t, http.StatusTooManyRequests, resp.StatusCode)
+		assert.NotEmpty(t, resp.Header.Get("Retry-After"))
+
+		// Even the right password is refused while locked
+		right := map[string]string{"email": email, "password": "correct-password"}
+		assert.Equal(t, http.StatusTooManyRequests, postJSON(t, client, ts.URL+"/login", right))
+	})
+
+	t.Run("LinkLockout", func(t *testing.T) {
+		email := "guesser@example.com"
+		registerUser(t, client, ts.URL, email, "password123")
+		verifyEmail(t, db, email)
+		token := loginUser(t, client, ts.URL, email, "password123")
+
+		for i := 0; i < 3; i++ {
+			linkStatus := doJSON(t, client, "POST", ts.URL+"/couples/link", token, map[string]string{"code": "000000"}, nil)
+			assert.Equal(t, http.StatusBadRequest, linkStatus)
+		}
+		linkStatus := doJSON(t, client, "POST", ts.URL+"/couples/link", token, map[string]string{"code": "000000"}, nil)
+		assert.Equal(t, http.StatusTooManyRequests, linkStatus)
+	})
+}
+
+func postRaw(t *testing.T, client *http.Client, url string, body interface{}) *http.Response {
+	reqBody, _ := json.Marshal(body)
+	resp, err := client.Post(url, "application/json", bytes.NewBuffer(reqBody))
+	require.NoError(t, err)
+	resp.Body.Close()
+	return resp
+}
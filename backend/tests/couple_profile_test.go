@@ -0,0 +1,196 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bit2swaz/junto/internal/database"
+	"github.com/bit2swaz/junto/internal/handlers"
+	"github.com/bit2swaz/junto/internal/mailer"
+	"github.com/bit2swaz/junto/internal/middleware"
+	wsInternal "github.com/bit2swaz/junto/internal/websocket"
+	"github.com/coder/websocket"
+	"github.com/coder/websocket/wsjson"
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCoupleProfile(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	keys := setupTestKeys(t, db)
+
+	authHandler := &handlers.AuthHandler{DB: db, Mailer: mailer.NewOutbox(""), Keys: keys}
+	hub := wsInternal.NewHub(db, keys)
+	coupleHandler := &handlers.CoupleHandler{DB: db, Hub: hub}
+
+	r := chi.NewRouter()
+	r.Post("/register", authHandler.Register)
+	r.Post("/login", authHandler.Login)
+	r.Get("/ws", hub.HandleWebSocket)
+	r.Group(func(r chi.Router) {
+		r.Use(middleware.AuthMiddleware(db, keys))
+		r.Post("/ws/ticket", hub.IssueTicket)
+		r.Post("/couples/code", coupleHandler.GeneratePairingCode)
+		r.Post("/couples/link", coupleHandler.LinkPartner)
+		r.Post("/couples/requests/{id}/accept", coupleHandler.AcceptPairingRequest)
+		r.Get("/couples/profile", coupleHandler.GetCoupleProfile)
+		r.Patch("/couples/profile", coupleHandler.UpdateCoupleProfile)
+	})
+
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+	client := ts.Client()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	for _, email := range []string{"profile-a@example.com", "profile-b@example.com", "profile-single@example.com"} {
+		registerUser(t, client, ts.URL, email, "password123")
+		verifyEmail(t, db, email)
+	}
+	tokenA := loginUser(t, client, ts.URL, "profile-a@example.com", "password123")
+	tokenB := loginUser(t, client, ts.URL, "profile-b@example.com", "password123")
+	tokenSingle := loginUser(t, client, ts.URL, "profile-single@example.com", "password123")
+	linkPartner(t, client, ts.URL, tokenA, tokenB, generatePairingCode(t, client, ts.URL, tokenA))
+
+	wsURL := "ws" + strings.TrimPrefix(ts.URL, "http") + "/ws"
+	connB, _, err := websocket.Dial(ctx, wsURL+"?ticket="+wsTicket(t, client, ts.URL, tokenB), nil)
+	require.NoError(t, err)
+	defer connB.Close(websocket.StatusNormalClosure, "")
+
+	getProfile := func(t *testing.T, token string) (database.CoupleProfile, string) {
+		req, err := http.NewRequest("GET", ts.URL+"/couples/profile", nil)
+		require.NoError(t, err)
+		req.Header.Set("Authorization", "Bearer "+token)
+		resp, err := client.Do(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+
+		var profile database.CoupleProfile
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&profile))
+		return profile, resp.Header.Get("ETag")
+	}
+	patchProfile := func(t *testing.T, token, ifMatch string, body interface{}) (*http.Response, database.CoupleProfile) {
+		var buf bytes.Buffer
+		require.NoError(t, json.NewEncoder(&buf).Encode(body))
+		req, err := http.NewRequest("PATCH", ts.URL+"/couples/profile", &buf)
+		require.NoError(t, err)
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+token)
+		if ifMatch != "" {
+			req.Header.Set("If-Match", ifMatch)
+		}
+		resp, err := client.Do(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+
+		var profile database.CoupleProfile
+		if resp.StatusCode == http.StatusOK {
+			require.NoError(t, json.NewDecoder(resp.Body).Decode(&profile))
+		}
+		return resp, profile
+	}
+
+	t.Run("NotInCouple", func(t *testing.T) {
+		assert.Equal(t, http.StatusBadRequest, doJSON(t, client, "GET", ts.URL+"/couples/profile", tokenSingle, nil, nil))
+	})
+
+	t.Run("Defaults", func(t *testing.T) {
+		profile, etag := getProfile(t, tokenA)
+		assert.Equal(t, int64(1), profile.Version)
+		assert.Equal(t, `"1"`, etag)
+		assert.Empty(t, profile.DisplayName)
+		assert.Nil(t, profile.Anniversary)
+		assert.JSONEq(t, `{}`, string(profile.Preferences))
+	})
+
+	t.Run("RequiresIfMatch", func(t *testing.T) {
+		resp, _ := patchProfile(t, tokenA, "", map[string]string{"display_name": "Us"})
+		assert.Equal(t, http.StatusPreconditionRequired, resp.StatusCode)
+	})
+
+	t.Run("Validation", func(t *testing.T) {
+		_, etag := getProfile(t, tokenA)
+		for _, body := range []map[string]interface{}{
+			{"anniversary": "14/02/2020"},
+			{"relationship_start": time.Now().AddDate(1, 0, 0).Format("2006-01-02")},
+			{"cover_image_url": "javascript:alert(1)"},
+			{"preferences": []string{"not", "an", "object"}},
+			{"display_name": strings.Repeat("x", 101)},
+		} {
+			resp, _ := patchProfile(t, tokenA, etag, body)
+			assert.Equal(t, http.StatusBadRequest, resp.StatusCode, body)
+		}
+	})
+
+	t.Run("UpdateAndBroadcast", func(t *testing.T) {
+		_, etag := getProfile(t, tokenA)
+		resp, profile := patchProfile(t, tokenA, etag, map[string]interface{}{
+			"display_name":       "The Two of Us",
+			"anniversary":        "2020-02-14",
+			"relationship_start": "2019-06-01",
+			"cover_image_url":    "https://example.com/cover.jpg",
+			"preferences":        map[string]interface{}{"theme": "dusk", "haptics": true},
+		})
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, "The Two of Us", profile.DisplayName)
+		require.NotNil(t, profile.Anniversary)
+		assert.Equal(t, "2020-02-14", *profile.Anniversary)
+		assert.Equal(t, int64(2), profile.Version)
+		assert.Equal(t, `"2"`, resp.Header.Get("ETag"))
+
+		var msg struct {
+			Type    string                 `json:"type"`
+			Profile database.CoupleProfile `json:"profile"`
+		}
+		require.NoError(t, wsjson.Read(ctx, connB, &msg))
+		assert.Equal(t, wsInternal.MessageCoupleProfileUpdated, msg.Type)
+		assert.Equal(t, "The Two of Us", msg.Profile.DisplayName)
+		assert.Equal(t, int64(2), msg.Profile.Version)
+
+		// Fields left out are kept, preferences merge key by key and an
+		// empty date clears it
+		resp, profile = patchProfile(t, tokenB, resp.Header.Get("ETag"), map[string]interface{}{
+			"anniversary": "",
+			"preferences": map[string]interface{}{"haptics": nil, "emoji": "🌙"},
+		})
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, "The Two of Us", profile.DisplayName)
+		assert.Nil(t, profile.Anniversary)
+		require.NotNil(t, profile.RelationshipStart)
+		assert.Equal(t, "2019-06-01", *profile.RelationshipStart)
+		assert.JSONEq(t, `{"theme": "dusk", "emoji": "🌙"}`, string(profile.Preferences))
+	})
+
+	t.Run("ConcurrentEdits", func(t *testing.T) {
+		// Both partners read the same version
+		_, etag := getProfile(t, tokenA)
+		_, etagB := getProfile(t, tokenB)
+		require.Equal(t, etag, etagB)
+
+		resp, _ := patchProfile(t, tokenA, etag, map[string]string{"display_name": "A's name"})
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		current := resp.Header.Get("ETag")
+
+		// B's edit is based on what they read before A's, so it is refused
+		// rather than overwriting it
+		resp, _ = patchProfile(t, tokenB, etagB, map[string]string{"display_name": "B's name"})
+		assert.Equal(t, http.StatusPreconditionFailed, resp.StatusCode)
+		assert.Equal(t, current, resp.Header.Get("ETag"))
+
+		profile, _ := getProfile(t, tokenB)
+		assert.Equal(t, "A's name", profile.DisplayName)
+
+		resp, _ = patchProfile(t, tokenB, "*", map[string]string{"display_name": "B's name"})
+		assert.Equal(t, http.StatusPreconditionFailed, resp.StatusCode)
+	})
+}
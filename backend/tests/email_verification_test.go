@@ -0,0 +1,69 @@
+package tests
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+
+	"github.com/bit2swaz/junto/internal/handlers"
+	"github.com/bit2swaz/junto/internal/mailer"
+	"github.com/bit2swaz/junto/internal/middleware"
+	wsInternal "github.com/bit2swaz/junto/internal/websocket"
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var verifyTokenPattern = regexp.MustCompile(`verify-email\?token=([A-Za-z0-9_-]+)`)
+
+func TestEmailVerification(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	keys := setupTestKeys(t, db)
+
+	outbox := mailer.NewOutbox("")
+	authHandler := &handlers.AuthHandler{DB: db, Mailer: outbox, Keys: keys}
+	coupleHandler := &handlers.CoupleHandler{DB: db, Hub: wsInternal.NewHub(db, keys)}
+
+	r := chi.NewRouter()
+	r.Post("/register", authHandler.Register)
+	r.Post("/login", authHandler.Login)
+	r.Post("/verify-email", authHandler.VerifyEmail)
+	r.Group(func(r chi.Router) {
+		r.Use(middleware.AuthMiddleware(db, keys))
+		r.With(middleware.RequireVerifiedEmail(db)).Post("/couples/code", coupleHandler.GeneratePairingCode)
+	})
+
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+	client := ts.Client()
+
+	t.Run("Normalization", func(t *testing.T) {
+		assert.Equal(t, http.StatusBadRequest, postJSON(t, client, ts.URL+"/register", map[string]string{"email": "not-an-email", "password": "password123"}))
+		assert.Equal(t, http.StatusBadRequest, postJSON(t, client, ts.URL+"/register", map[string]string{"email": "Bob <bob@example.com>", "password": "password123"}))
+
+		registerUser(t, client, ts.URL, "  Bob@Example.com ", "password123")
+		assert.NotEqual(t, http.StatusCreated, postJSON(t, client, ts.URL+"/register", map[string]string{"email": "bob@example.com", "password": "password123"}))
+
+		loginUser(t, client, ts.URL, "BOB@example.COM", "password123")
+	})
+
+	t.Run("GatesPairing", func(t *testing.T) {
+		email := "carol@example.com"
+		registerUser(t, client, ts.URL, email, "password123")
+		token := loginUser(t, client, ts.URL, email, "password123")
+
+		assert.Equal(t, http.StatusForbidden, postWithToken(t, client, ts.URL+"/couples/code", token))
+
+		msg, ok := outbox.Last(email)
+		require.True(t, ok, "verification email should be sent on register")
+		match := verifyTokenPattern.FindStringSubmatch(msg.Body)
+		require.Len(t, match, 2)
+
+		require.Equal(t, http.StatusOK, postJSON(t, client, ts.URL+"/verify-email", map[string]string{"token": match[1]}))
+		assert.Equal(t, http.StatusBadRequest, postJSON(t, client, ts.URL+"/verify-email", map[string]string{"token": match[1]}))
+
+		assert.Equal(t, http.StatusOK, postWithToken(t, client, ts.URL+"/couples/code", token))
+	})
+}
@@ -3,13 +3,16 @@ package tests
 import (
 	"context"
 	"fmt"
+	"net/http"
 	"net/http/httptest"
 	"strings"
 	"testing"
 	"time"
 
+	"github.com/bit2swaz/junto/internal/auth"
 	"github.com/bit2swaz/junto/internal/database"
 	"github.com/bit2swaz/junto/internal/handlers"
+	"github.com/bit2swaz/junto/internal/mailer"
 	"github.com/bit2swaz/junto/internal/middleware"
 	wsInternal "github.com/bit2swaz/junto/internal/websocket"
 	"github.com/coder/websocket"
@@ -20,22 +23,26 @@ import (
 	"github.com/stretchr/testify/require"
 )
 
-func setupRouterWithWS(db database.Service) *chi.Mux {
-	authHandler := &handlers.AuthHandler{DB: db}
-	coupleHandler := &handlers.CoupleHandler{DB: db}
-	hub := wsInternal.NewHub(db)
+func setupRouterWithWS(db database.Service, keys *auth.KeyManager) *chi.Mux {
+	authHandler := &handlers.AuthHandler{DB: db, Mailer: mailer.NewOutbox(""), Keys: keys}
+	hub := wsInternal.NewHub(db, keys)
+	coupleHandler := &handlers.CoupleHandler{DB: db, Hub: hub}
 
 	r := chi.NewRouter()
 	r.Use(chiMiddleware.Logger)
 
 	r.Post("/register", authHandler.Register)
 	r.Post("/login", authHandler.Login)
+	r.Get("/ws", hub.HandleWebSocket)
 
 	r.Group(func(r chi.Router) {
-		r.Use(middleware.AuthMiddleware)
-		r.Post("/couples/code", coupleHandler.GeneratePairingCode)
-		r.Post("/couples/link", coupleHandler.LinkPartner)
-		r.Get("/ws", hub.HandleWebSocket)
+		r.Use(middleware.AuthMiddleware(db, keys))
+		r.With(middleware.RequireVerifiedEmail(db)).Post("/couples/code", coupleHandler.GeneratePairingCode)
+		r.With(middleware.RequireVerifiedEmail(db)).Post("/couples/link", coupleHandler.LinkPartner)
+		r.With(middleware.RequireVerifiedEmail(db)).Get("/couples/requests", coupleHandler.ListPairingRequests)
+		r.With(middleware.RequireVerifiedEmail(db)).Post("/couples/requests/{id}/accept", coupleHandler.AcceptPairingRequest)
+		r.With(middleware.RequireVerifiedEmail(db)).Post("/couples/requests/{id}/reject", coupleHandler.RejectPairingRequest)
+		r.Post("/ws/ticket", hub.IssueTicket)
 	})
 
 	return r
@@ -44,8 +51,9 @@ func setupRouterWithWS(db database.Service) *chi.Mux {
 func TestHaptics(t *testing.T) {
 	db := setupTestDB(t)
 	defer db.Close()
+	keys := setupTestKeys(t, db)
 
-	r := setupRouterWithWS(db)
+	r := setupRouterWithWS(db, keys)
 	ts := httptest.NewServer(r)
 	defer ts.Close()
 
@@ -56,28 +64,41 @@ func TestHaptics(t *testing.T) {
 	userAEmail := "haptic_a@example.com"
 	userAPass := "password123"
 	registerUser(t, client, ts.URL, userAEmail, userAPass)
+	verifyEmail(t, db, userAEmail)
 	tokenA := loginUser(t, client, ts.URL, userAEmail, userAPass)
 
 	userBEmail := "haptic_b@example.com"
 	userBPass := "password123"
 	registerUser(t, client, ts.URL, userBEmail, userBPass)
+	verifyEmail(t, db, userBEmail)
 	tokenB := loginUser(t, client, ts.URL, userBEmail, userBPass)
 
 	// 2. Link Users
 	code := generatePairingCode(t, client, ts.URL, tokenA)
-	linkPartner(t, client, ts.URL, tokenB, code)
+	linkPartner(t, client, ts.URL, tokenA, tokenB, code)
 
 	// 3. Connect WebSockets
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
+	// Access tokens are not accepted in the query string
+	_, resp, err := websocket.Dial(ctx, fmt.Sprintf("%s?token=%s", wsURL, tokenA), nil)
+	require.Error(t, err)
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+
 	// Connect Client A
-	connA, _, err := websocket.Dial(ctx, fmt.Sprintf("%s?token=%s", wsURL, tokenA), nil)
+	ticketA := wsTicket(t, client, ts.URL, tokenA)
+	connA, _, err := websocket.Dial(ctx, fmt.Sprintf("%s?ticket=%s", wsURL, ticketA), nil)
 	require.NoError(t, err, "Client A failed to connect")
 	defer connA.Close(websocket.StatusNormalClosure, "")
 
+	// Tickets are single-use
+	_, resp, err = websocket.Dial(ctx, fmt.Sprintf("%s?ticket=%s", wsURL, ticketA), nil)
+	require.Error(t, err)
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+
 	// Connect Client B
-	connB, _, err := websocket.Dial(ctx, fmt.Sprintf("%s?token=%s", wsURL, tokenB), nil)
+	connB, _, err := websocket.Dial(ctx, fmt.Sprintf("%s?ticket=%s", wsURL, wsTicket(t, client, ts.URL, tokenB)), nil)
 	require.NoError(t, err, "Client B failed to connect")
 	defer connB.Close(websocket.StatusNormalClosure, "")
 
@@ -111,3 +132,12 @@ func TestHaptics(t *testing.T) {
 		assert.Equal(t, "TOUCH_END", received["type"])
 	})
 }
+
+func wsTicket(t *testing.T, client *http.Client, baseURL, token string) string {
+	var res struct {
+		Ticket string `json:"ticket"`
+	}
+	require.Equal(t, http.StatusOK, doJSON(t, client, "POST", baseURL+"/ws/ticket", token, nil, &res))
+	require.NotEmpty(t, res.Ticket)
+	return res.Ticket
+}
@@ -4,14 +4,18 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"testing"
 
+	"github.com/bit2swaz/junto/internal/auth"
 	"github.com/bit2swaz/junto/internal/database"
 	"github.com/bit2swaz/junto/internal/handlers"
+	"github.com/bit2swaz/junto/internal/mailer"
 	"github.com/bit2swaz/junto/internal/middleware"
+	wsInternal "github.com/bit2swaz/junto/internal/websocket"
 	"github.com/go-chi/chi/v5"
 	chiMiddleware "github.com/go-chi/chi/v5/middleware"
 	"github.com/joho/godotenv"
@@ -24,6 +28,9 @@ func setupTestEnv() {
 	if os.Getenv("DATABASE_URL") == "" {
 		_ = godotenv.Load("../.env")
 	}
+	if os.Getenv("ENCRYPTION_KEY") == "" && os.Getenv("MFA_ENCRYPTION_KEY") == "" {
+		os.Setenv("ENCRYPTION_KEY", "anVudG8tdGVzdC1lbmNyeXB0aW9uLWtleS0zMmJ5dGU=")
+	}
 }
 
 func setupTestDB(t *testing.T) database.Service {
@@ -48,9 +55,15 @@ func setupTestDB(t *testing.T) database.Service {
 	return db
 }
 
-func setupRouter(db database.Service) *chi.Mux {
-	authHandler := &handlers.AuthHandler{DB: db}
-	coupleHandler := &handlers.CoupleHandler{DB: db}
+func setupTestKeys(t *testing.T, db database.Service) *auth.KeyManager {
+	keys, err := auth.NewKeyManager(context.Background(), db)
+	require.NoError(t, err)
+	return keys
+}
+
+func setupRouter(db database.Service, keys *auth.KeyManager) *chi.Mux {
+	authHandler := &handlers.AuthHandler{DB: db, Mailer: mailer.NewOutbox(""), Keys: keys}
+	coupleHandler := &handlers.CoupleHandler{DB: db, Hub: wsInternal.NewHub(db, keys)}
 
 	r := chi.NewRouter()
 	r.Use(chiMiddleware.Logger)
@@ -59,9 +72,15 @@ func setupRouter(db database.Service) *chi.Mux {
 	r.Post("/login", authHandler.Login)
 
 	r.Group(func(r chi.Router) {
-		r.Use(middleware.AuthMiddleware)
-		r.Post("/couples/code", coupleHandler.GeneratePairingCode)
-		r.Post("/couples/link", coupleHandler.LinkPartner)
+		r.Use(middleware.AuthMiddleware(db, keys))
+		r.With(middleware.RequireVerifiedEmail(db)).Post("/couples/code", coupleHandler.GeneratePairingCode)
+		r.With(middleware.RequireVerifiedEmail(db)).Get("/couples/invite", coupleHandler.GetPairingInvite)
+		r.With(middleware.RequireVerifiedEmail(db)).Get("/couples/invite/qr.png", coupleHandler.PairingInviteQRPNG)
+		r.With(middleware.RequireVerifiedEmail(db)).Get("/couples/invite/qr.svg", coupleHandler.PairingInviteQRSVG)
+		r.With(middleware.RequireVerifiedEmail(db)).Post("/couples/link", coupleHandler.LinkPartner)
+		r.With(middleware.RequireVerifiedEmail(db)).Get("/couples/requests", coupleHandler.ListPairingRequests)
+		r.With(middleware.RequireVerifiedEmail(db)).Post("/couples/requests/{id}/accept", coupleHandler.AcceptPairingRequest)
+		r.With(middleware.RequireVerifiedEmail(db)).Post("/couples/requests/{id}/reject", coupleHandler.RejectPairingRequest)
 	})
 
 	return r
@@ -70,7 +89,8 @@ func setupRouter(db database.Service) *chi.Mux {
 func TestIntegrationPhase1(t *testing.T) {
 	db := setupTestDB(t)
 	defer db.Close()
-	r := setupRouter(db)
+	keys := setupTestKeys(t, db)
+	r := setupRouter(db, keys)
 	ts := httptest.NewServer(r)
 	defer ts.Close()
 
@@ -80,11 +100,13 @@ func TestIntegrationPhase1(t *testing.T) {
 	userAEmail := "usera@example.com"
 	userAPass := "password123"
 	registerUser(t, client, ts.URL, userAEmail, userAPass)
+	verifyEmail(t, db, userAEmail)
 
 	// 2. Register User B
 	userBEmail := "userb@example.com"
 	userBPass := "password123"
 	registerUser(t, client, ts.URL, userBEmail, userBPass)
+	verifyEmail(t, db, userBEmail)
 
 	// 3. Login User A
 	tokenA := loginUser(t, client, ts.URL, userAEmail, userAPass)
@@ -97,7 +119,7 @@ func TestIntegrationPhase1(t *testing.T) {
 	assert.Len(t, code, 6)
 
 	// 6. User B links with code
-	linkPartner(t, client, ts.URL, tokenB, code)
+	linkPartner(t, client, ts.URL, tokenA, tokenB, code)
 
 	// 7. Verify DB state
 	verifyCouples(t, db, userAEmail, userBEmail)
@@ -114,6 +136,14 @@ func registerUser(t *testing.T, client *http.Client, baseURL, email, password st
 	require.Equal(t, http.StatusCreated, resp.StatusCode)
 }
 
+// verifyEmail marks the address as confirmed, standing in for the emailed link.
+func verifyEmail(t *testing.T, db database.Service, email string) {
+	user, err := db.GetUserByEmail(context.Background(), email)
+	require.NoError(t, err)
+	require.NotNil(t, user)
+	require.NoError(t, db.MarkEmailVerified(context.Background(), user.ID))
+}
+
 func loginUser(t *testing.T, client *http.Client, baseURL, email, password string) string {
 	reqBody, _ := json.Marshal(map[string]string{
 		"email":    email,
@@ -146,19 +176,12 @@ func generatePairingCode(t *testing.T, client *http.Client, baseURL, token strin
 	return res["code"]
 }
 
-func linkPartner(t *testing.T, client *http.Client, baseURL, token, code string) {
-	reqBody, _ := json.Marshal(map[string]string{
-		"code": code,
-	})
-	req, err := http.NewRequest("POST", baseURL+"/couples/link", bytes.NewBuffer(reqBody))
-	require.NoError(t, err)
-	req.Header.Set("Authorization", "Bearer "+token)
-	req.Header.Set("Content-Type", "application/json")
-
-	resp, err := client.Do(req)
-	require.NoError(t, err)
-	defer resp.Body.Close()
-	require.Equal(t, http.StatusCreated, resp.StatusCode)
+// linkPartner redeems ownerToken's code with token and has the owner
+// accept the resulting request.
+func linkPartner(t *testing.T, client *http.Client, baseURL, ownerToken, token, code string) {
+	var request database.PairingRequest
+	require.Equal(t, http.StatusAccepted, doJSON(t, client, "POST", baseURL+"/couples/link", token, map[string]string{"code": code}, &request))
+	require.Equal(t, http.StatusCreated, doJSON(t, client, "POST", fmt.Sprintf("%s/couples/requests/%d/accept", baseURL, request.ID), ownerToken, nil, nil))
 }
 
 func verifyCouples(t *testing.T, db database.Service, emailA, emailB string) {
@@ -172,7 +195,7 @@ func verifyCouples(t *testing.T, db database.Service, emailA, emailB string) {
 
 	// Check couples table
 	var count int
-	err = db.GetPool().QueryRow(ctx, "SELECT COUNT(*) FROM couples WHERE (user1_id = $1 AND user2_id = $2) OR (user1_id = $2 AND user2_id = $1)", userA.ID, userB.ID).Scan(&count)
+	err = db.GetPool().QueryRow(ctx, "SELECT COUNT(*) FROM couple_members a JOIN couple_members b ON a.couple_id = b.couple_id WHERE a.user_id = $1 AND b.user_id = $2", userA.ID, userB.ID).Scan(&count)
 	require.NoError(t, err)
 	assert.Equal(t, 1, count, "Couple row should exist")
 
@@ -0,0 +1,112 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/bit2swaz/junto/internal/database"
+	"github.com/bit2swaz/junto/internal/handlers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPairingInvites(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	keys := setupTestKeys(t, db)
+	ts := httptest.NewServer(setupRouter(db, keys))
+	defer ts.Close()
+	client := ts.Client()
+
+	tokens := map[string]string{}
+	for _, name := range []string{"owner", "partner"} {
+		email := name + "@invite.example.com"
+		registerUser(t, client, ts.URL, email, "password123")
+		verifyEmail(t, db, email)
+		tokens[name] = loginUser(t, client, ts.URL, email, "password123")
+	}
+	generate := func() handlers.PairingInviteResponse {
+		var invite handlers.PairingInviteResponse
+		require.Equal(t, http.StatusOK, doJSON(t, client, "POST", ts.URL+"/couples/code", tokens["owner"], nil, &invite))
+		return invite
+	}
+	link := func(body map[string]string) int {
+		return doJSON(t, client, "POST", ts.URL+"/couples/link", tokens["partner"], body, nil)
+	}
+	get := func(path string) (int, string, []byte) {
+		req, err := http.NewRequest("GET", ts.URL+path, nil)
+		require.NoError(t, err)
+		req.Header.Set("Authorization", "Bearer "+tokens["owner"])
+		resp, err := client.Do(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		return resp.StatusCode, resp.Header.Get("Content-Type"), body
+	}
+
+	t.Run("RegenerateRevokes", func(t *testing.T) {
+		old := generate()
+		assert.Len(t, old.Code, 6)
+		assert.GreaterOrEqual(t, len(old.Token), 32)
+		u, err := url.Parse(old.URL)
+		require.NoError(t, err)
+		assert.Equal(t, "/pair", u.Path)
+		assert.Equal(t, old.Token, u.Query().Get("token"))
+
+		current := generate()
+		assert.NotEqual(t, old.Token, current.Token)
+		assert.Equal(t, http.StatusBadRequest, link(map[string]string{"code": old.Code}))
+		assert.Equal(t, http.StatusBadRequest, link(map[string]string{"token": old.Token}))
+
+		var fetched handlers.PairingInviteResponse
+		require.Equal(t, http.StatusOK, doJSON(t, client, "GET", ts.URL+"/couples/invite", tokens["owner"], nil, &fetched))
+		assert.Equal(t, current.Token, fetched.Token)
+		assert.Equal(t, current.URL, fetched.URL)
+	})
+
+	t.Run("QRCode", func(t *testing.T) {
+		status, contentType, body := get("/couples/invite/qr.png")
+		require.Equal(t, http.StatusOK, status)
+		assert.Equal(t, "image/png", contentType)
+		assert.True(t, bytes.HasPrefix(body, []byte("\x89PNG")))
+
+		status, contentType, body = get("/couples/invite/qr.svg")
+		require.Equal(t, http.StatusOK, status)
+		assert.Equal(t, "image/svg+xml", contentType)
+		assert.True(t, bytes.HasPrefix(body, []byte("<svg")))
+	})
+
+	t.Run("CodesAreUnique", func(t *testing.T) {
+		invite := generate()
+		partner, err := db.GetUserByEmail(context.Background(), "partner@invite.example.com")
+		require.NoError(t, err)
+
+		created, err := db.CreatePairingInvite(context.Background(), partner.ID, database.PairingInvite{
+			Code:      invite.Code,
+			Token:     "another-token",
+			ExpiresAt: invite.ExpiresAt,
+		})
+		require.NoError(t, err)
+		assert.False(t, created)
+
+		var fetched handlers.PairingInviteResponse
+		require.Equal(t, http.StatusOK, doJSON(t, client, "GET", ts.URL+"/couples/invite", tokens["owner"], nil, &fetched))
+		assert.Equal(t, invite.Code, fetched.Code)
+	})
+
+	t.Run("RedeemByToken", func(t *testing.T) {
+		invite := generate()
+		assert.Equal(t, http.StatusAccepted, link(map[string]string{"token": invite.Token}))
+
+		// The code went with the token
+		assert.Equal(t, http.StatusBadRequest, link(map[string]string{"code": invite.Code}))
+		status, _, _ := get("/couples/invite/qr.svg")
+		assert.Equal(t, http.StatusNotFound, status)
+	})
+}
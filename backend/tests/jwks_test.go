@@ -0,0 +1,72 @@
+package tests
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/bit2swaz/junto/internal/auth"
+	"github.com/bit2swaz/junto/internal/handlers"
+	"github.com/bit2swaz/junto/internal/mailer"
+	"github.com/go-chi/chi/v5"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJWKSVerifiesIssuedTokens(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	keys := setupTestKeys(t, db)
+
+	authHandler := &handlers.AuthHandler{DB: db, Mailer: mailer.NewOutbox(""), Keys: keys}
+	jwksHandler := &handlers.JWKSHandler{Keys: keys}
+
+	r := chi.NewRouter()
+	r.Get("/.well-known/jwks.json", jwksHandler.ServeJWKS)
+	r.Post("/register", authHandler.Register)
+	r.Post("/login", authHandler.Login)
+
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+	client := ts.Client()
+
+	registerUser(t, client, ts.URL, "jwks@example.com", "password123")
+	token := loginUser(t, client, ts.URL, "jwks@example.com", "password123")
+
+	resp, err := client.Get(ts.URL + "/.well-known/jwks.json")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var set auth.JWKS
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&set))
+	require.NotEmpty(t, set.Keys)
+
+	// Verify the way an outside service would: only the published JWKS
+	parsed, err := jwt.Parse(token, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		for _, jwk := range set.Keys {
+			if jwk.KeyID == kid && jwk.KeyType == "OKP" {
+				x, err := base64.RawURLEncoding.DecodeString(jwk.X)
+				if err != nil {
+					return nil, err
+				}
+				return ed25519.PublicKey(x), nil
+			}
+		}
+		return nil, jwt.ErrTokenUnverifiable
+	}, jwt.WithValidMethods([]string{auth.AlgEdDSA}), jwt.WithIssuer("junto"))
+	require.NoError(t, err)
+	assert.True(t, parsed.Valid)
+
+	// HS256 tokens signed with the old shared secret are no longer accepted
+	legacy := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"user_id": 1, "typ": auth.TokenTypeAccess, "sid": "x", "iss": "junto"})
+	legacyString, err := legacy.SignedString([]byte("secret"))
+	require.NoError(t, err)
+	_, err = keys.ParseAccessToken(legacyString)
+	assert.Error(t, err)
+}
@@ -0,0 +1,162 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/base32"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bit2swaz/junto/internal/auth"
+	"github.com/bit2swaz/junto/internal/handlers"
+	"github.com/bit2swaz/junto/internal/mailer"
+	"github.com/bit2swaz/junto/internal/middleware"
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTOTPVectors(t *testing.T) {
+	// RFC 6238 appendix B, SHA1, truncated to 6 digits
+	secret := []byte("12345678901234567890")
+	vectors := map[int64]string{
+		59:         "287082",
+		1111111109: "081804",
+		1234567890: "005924",
+		2000000000: "279037",
+	}
+	for ts, want := range vectors {
+		assert.Equal(t, want, auth.TOTPCode(secret, time.Unix(ts, 0)), "t=%d", ts)
+	}
+
+	now := time.Unix(1234567890, 0)
+	_, ok := auth.ValidateTOTP(secret, auth.TOTPCode(secret, now.Add(-30*time.Second)), now)
+	assert.True(t, ok, "previous step should be accepted")
+	_, ok = auth.ValidateTOTP(secret, auth.TOTPCode(secret, now.Add(-90*time.Second)), now)
+	assert.False(t, ok, "codes outside the skew window should be rejected")
+}
+
+func TestMFALogin(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	keys := setupTestKeys(t, db)
+
+	authHandler := &handlers.AuthHandler{DB: db, Mailer: mailer.NewOutbox(""), Keys: keys}
+
+	r := chi.NewRouter()
+	r.Post("/register", authHandler.Register)
+	r.Post("/login", authHandler.Login)
+	r.Post("/login/mfa/totp", authHandler.LoginTOTP)
+	r.Post("/login/mfa/recovery", authHandler.LoginRecoveryCode)
+	r.Group(func(r chi.Router) {
+		r.Use(middleware.AuthMiddleware(db, keys))
+		r.Get("/me", authHandler.Me)
+		r.Post("/me/mfa/totp", authHandler.EnrollTOTP)
+		r.Post("/me/mfa/totp/verify", authHandler.ConfirmTOTP)
+	})
+
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+	client := ts.Client()
+
+	email := "mfa@example.com"
+	pass := "password123"
+	registerUser(t, client, ts.URL, email, pass)
+	token := loginUser(t, client, ts.URL, email, pass)
+
+	// Enroll and confirm
+	var enrollment handlers.TOTPEnrollmentResponse
+	status := doJSON(t, client, "POST", ts.URL+"/me/mfa/totp", token, nil, &enrollment)
+	require.Equal(t, http.StatusCreated, status)
+	require.Len(t, enrollment.RecoveryCodes, 10)
+	assert.Contains(t, enrollment.OTPAuthURI, "otpauth://totp/")
+
+	secret, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(enrollment.Secret)
+	require.NoError(t, err)
+
+	now := time.Now()
+	status = doJSON(t, client, "POST", ts.URL+"/me/mfa/totp/verify", token, map[string]string{"code": auth.TOTPCode(secret, now)}, nil)
+	require.Equal(t, http.StatusOK, status)
+
+	// Password alone now only yields an mfa token, which is not a session
+	var challenge handlers.MFAChallengeResponse
+	status = doJSON(t, client, "POST", ts.URL+"/login", "", map[string]string{"email": email, "password": pass}, &challenge)
+	require.Equal(t, http.StatusOK, status)
+	require.True(t, challenge.MFARequired)
+	assert.Equal(t, http.StatusUnauthorized, getWithToken(t, client, ts.URL+"/me", challenge.MFAToken))
+
+	// The code already used to confirm enrollment cannot be replayed
+	status = doJSON(t, client, "POST", ts.URL+"/login/mfa/totp", "", map[string]string{"mfa_token": challenge.MFAToken, "code": auth.TOTPCode(secret, now)}, nil)
+	assert.Equal(t, http.StatusUnauthorized, status)
+
+	var session handlers.AuthResponse
+	status = doJSON(t, client, "POST", ts.URL+"/login/mfa/totp", "", map[string]string{"mfa_token": challenge.MFAToken, "code": auth.TOTPCode(secret, now.Add(30*time.Second))}, &session)
+	require.Equal(t, http.StatusOK, status)
+	assert.Equal(t, http.StatusOK, getWithToken(t, client, ts.URL+"/me", session.Token))
+
+	// Recovery codes work exactly once
+	doJSON(t, client, "POST", ts.URL+"/login", "", map[string]string{"email": email, "password": pass}, &challenge)
+	recovery := map[string]string{"mfa_token": challenge.MFAToken, "recovery_code": enrollment.RecoveryCodes[0]}
+	assert.Equal(t, http.StatusOK, doJSON(t, client, "POST", ts.URL+"/login/mfa/recovery", "", recovery, nil))
+
+	doJSON(t, client, "POST", ts.URL+"/login", "", map[string]string{"email": email, "password": pass}, &challenge)
+	recovery["mfa_token"] = challenge.MFAToken
+	assert.Equal(t, http.StatusUnauthorized, doJSON(t, client, "POST", ts.URL+"/login/mfa/recovery", "", recovery, nil))
+
+	// An mfa token yields one session even when raced with several valid codes
+	doJSON(t, client, "POST", ts.URL+"/login", "", map[string]string{"email": email, "password": pass}, &challenge)
+	statuses := make([]int, 4)
+	var wg sync.WaitGroup
+	for i := range statuses {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			body := map[string]string{"mfa_token": challenge.MFAToken, "recovery_code": enrollment.RecoveryCodes[i+1]}
+			statuses[i] = doJSON(t, client, "POST", ts.URL+"/login/mfa/recovery", "", body, nil)
+		}(i)
+	}
+	wg.Wait()
+	sessions := 0
+	for _, status := range statuses {
+		if status == http.StatusOK {
+			sessions++
+		}
+	}
+	assert.Equal(t, 1, sessions)
+
+	// The codes that lost the race were not used up
+	for i, status := range statuses {
+		if status == http.StatusOK {
+			continue
+		}
+		doJSON(t, client, "POST", ts.URL+"/login", "", map[string]string{"email": email, "password": pass}, &challenge)
+		body := map[string]string{"mfa_token": challenge.MFAToken, "recovery_code": enrollment.RecoveryCodes[i+1]}
+		assert.Equal(t, http.StatusOK, doJSON(t, client, "POST", ts.URL+"/login/mfa/recovery", "", body, nil))
+	}
+}
+
+// doJSON sends body as JSON (if any) and decodes a successful response into out.
+func doJSON(t *testing.T, client *http.Client, method, url, token string, body, out interface{}) int {
+	var buf bytes.Buffer
+	if body != nil {
+		require.NoError(t, json.NewEncoder(&buf).Encode(body))
+	}
+	req, err := http.NewRequest(method, url, &buf)
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := client.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	if out != nil && resp.StatusCode < 300 {
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(out))
+	}
+	return resp.StatusCode
+}
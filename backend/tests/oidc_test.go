@@ -0,0 +1,143 @@
+package tests
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/bit2swaz/junto/internal/handlers"
+	"github.com/bit2swaz/junto/internal/mailer"
+	"github.com/bit2swaz/junto/internal/middleware"
+	"github.com/bit2swaz/junto/internal/oidc"
+	"github.com/bit2swaz/junto/internal/oidc/oidctest"
+	"github.com/go-chi/chi/v5"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOIDCIDTokenVerification(t *testing.T) {
+	idp := oidctest.NewServer("junto-test")
+	defer idp.Close()
+	provider := oidc.NewProvider(oidc.Config{Name: "mock", Issuer: idp.URL, ClientID: "junto-test"}, nil)
+
+	claims := func(aud, nonce string, exp time.Time) jwt.MapClaims {
+		return jwt.MapClaims{"iss": idp.URL, "sub": "123", "aud": aud, "nonce": nonce, "exp": exp.Unix()}
+	}
+	ctx := context.Background()
+
+	_, err := provider.VerifyIDToken(ctx, idp.SignIDToken(claims("junto-test", "n1", time.Now().Add(time.Minute))), "n1")
+	assert.NoError(t, err)
+
+	_, err = provider.VerifyIDToken(ctx, idp.SignIDToken(claims("junto-test", "n1", time.Now().Add(time.Minute))), "n2")
+	assert.Error(t, err, "nonce mismatch")
+
+	_, err = provider.VerifyIDToken(ctx, idp.SignIDToken(claims("someone-else", "n1", time.Now().Add(time.Minute))), "n1")
+	assert.Error(t, err, "wrong audience")
+
+	_, err = provider.VerifyIDToken(ctx, idp.SignIDToken(claims("junto-test", "n1", time.Now().Add(-time.Hour))), "n1")
+	assert.Error(t, err, "expired")
+}
+
+func TestOIDCLogin(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	keys := setupTestKeys(t, db)
+
+	idp := oidctest.NewServer("junto-test")
+	defer idp.Close()
+
+	authHandler := &handlers.AuthHandler{
+		DB:     db,
+		Mailer: mailer.NewOutbox(""),
+		Keys:   keys,
+		Providers: map[string]*oidc.Provider{
+			"mock": oidc.NewProvider(oidc.Config{
+				Name:        "mock",
+				Issuer:      idp.URL,
+				ClientID:    "junto-test",
+				RedirectURL: "http://localhost:3000/oidc/callback",
+			}, nil),
+		},
+	}
+
+	r := chi.NewRouter()
+	r.Post("/register", authHandler.Register)
+	r.Post("/auth/oidc/{provider}/start", authHandler.StartOIDC)
+	r.Post("/auth/oidc/{provider}/callback", authHandler.OIDCCallback)
+	r.Group(func(r chi.Router) {
+		r.Use(middleware.AuthMiddleware(db, keys))
+		r.Get("/me", authHandler.Me)
+	})
+
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+	client := ts.Client()
+
+	// signIn runs the browser part of the flow and returns the callback status
+	signIn := func(user oidctest.User) (int, handlers.AuthResponse, map[string]string) {
+		idp.SetUser(user)
+
+		var start handlers.OIDCStartResponse
+		require.Equal(t, http.StatusOK, doJSON(t, client, "POST", ts.URL+"/auth/oidc/mock/start", "", nil, &start))
+
+		redirect, err := idp.Authorize(start.AuthorizationURL)
+		require.NoError(t, err)
+		callback := map[string]string{
+			"code":  redirect.Query().Get("code"),
+			"state": redirect.Query().Get("state"),
+		}
+
+		var session handlers.AuthResponse
+		status := doJSON(t, client, "POST", ts.URL+"/auth/oidc/mock/callback", "", callback, &session)
+		return status, session, callback
+	}
+
+	t.Run("CreatesUser", func(t *testing.T) {
+		status, session, callback := signIn(oidctest.User{Subject: "sub-1", Email: "Social@Example.com", EmailVerified: true})
+		require.Equal(t, http.StatusOK, status)
+		assert.Equal(t, http.StatusOK, getWithToken(t, client, ts.URL+"/me", session.Token))
+
+		user, err := db.GetUserByIdentity(context.Background(), "mock", "sub-1")
+		require.NoError(t, err)
+		require.NotNil(t, user)
+		assert.Equal(t, "social@example.com", user.Email)
+		assert.NotNil(t, user.EmailVerifiedAt)
+
+		// The state cannot be replayed
+		assert.Equal(t, http.StatusBadRequest, doJSON(t, client, "POST", ts.URL+"/auth/oidc/mock/callback", "", callback, nil))
+
+		// Signing in again finds the same user
+		status, _, _ = signIn(oidctest.User{Subject: "sub-1", Email: "social@example.com", EmailVerified: true})
+		require.Equal(t, http.StatusOK, status)
+		again, err := db.GetUserByIdentity(context.Background(), "mock", "sub-1")
+		require.NoError(t, err)
+		assert.Equal(t, user.ID, again.ID)
+	})
+
+	t.Run("LinksVerifiedAccount", func(t *testing.T) {
+		registerUser(t, client, ts.URL, "linked@example.com", "password123")
+		verifyEmail(t, db, "linked@example.com")
+		existing, err := db.GetUserByEmail(context.Background(), "linked@example.com")
+		require.NoError(t, err)
+
+		status, _, _ := signIn(oidctest.User{Subject: "sub-2", Email: "linked@example.com", EmailVerified: true})
+		require.Equal(t, http.StatusOK, status)
+
+		user, err := db.GetUserByIdentity(context.Background(), "mock", "sub-2")
+		require.NoError(t, err)
+		assert.Equal(t, existing.ID, user.ID)
+	})
+
+	t.Run("RefusesUnverifiedLink", func(t *testing.T) {
+		registerUser(t, client, ts.URL, "squatted@example.com", "password123")
+
+		status, _, _ := signIn(oidctest.User{Subject: "sub-3", Email: "squatted@example.com", EmailVerified: true})
+		assert.Equal(t, http.StatusConflict, status)
+
+		status, _, _ = signIn(oidctest.User{Subject: "sub-4", Email: "linked@example.com", EmailVerified: false})
+		assert.Equal(t, http.StatusConflict, status)
+	})
+}
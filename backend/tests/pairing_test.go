@@ -0,0 +1,224 @@
+package tests
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bit2swaz/junto/internal/database"
+	wsInternal "github.com/bit2swaz/junto/internal/websocket"
+	"github.com/coder/websocket"
+	"github.com/coder/websocket/wsjson"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPairingIsExclusive(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	keys := setupTestKeys(t, db)
+	ts := httptest.NewServer(setupRouter(db, keys))
+	defer ts.Close()
+	client := ts.Client()
+
+	tokens := map[string]string{}
+	for _, name := range []string{"owner", "first", "second", "third"} {
+		email := name + "@pairing.example.com"
+		registerUser(t, client, ts.URL, email, "password123")
+		verifyEmail(t, db, email)
+		tokens[name] = loginUser(t, client, ts.URL, email, "password123")
+	}
+	link := func(token, code string) int {
+		return doJSON(t, client, "POST", ts.URL+"/couples/link", token, map[string]string{"code": code}, nil)
+	}
+	acceptAll := func(token string) {
+		var requests []database.PairingRequest
+		require.Equal(t, http.StatusOK, doJSON(t, client, "GET", ts.URL+"/couples/requests", token, nil, &requests))
+		require.Len(t, requests, 1)
+		require.Equal(t, http.StatusCreated, doJSON(t, client, "POST", fmt.Sprintf("%s/couples/requests/%d/accept", ts.URL, requests[0].ID), token, nil, nil))
+	}
+
+	t.Run("SelfLinkKeepsCode", func(t *testing.T) {
+		code := generatePairingCode(t, client, ts.URL, tokens["owner"])
+		assert.Equal(t, http.StatusBadRequest, link(tokens["owner"], code))
+
+		// Two people race for the same code; exactly one gets to ask
+		var wg sync.WaitGroup
+		statuses := make(chan int, 2)
+		for _, name := range []string{"first", "second"} {
+			wg.Add(1)
+			go func(token string) {
+				defer wg.Done()
+				statuses <- link(token, code)
+			}(tokens[name])
+		}
+		wg.Wait()
+		close(statuses)
+
+		counts := map[int]int{}
+		for s := range statuses {
+			counts[s]++
+		}
+		assert.Equal(t, map[int]int{http.StatusAccepted: 1, http.StatusBadRequest: 1}, counts)
+		acceptAll(tokens["owner"])
+	})
+
+	t.Run("AlreadyPaired", func(t *testing.T) {
+		// owner is now paired with first or second
+		winner, loser := "second", "first"
+		if user, err := db.GetUserByEmail(context.Background(), "first@pairing.example.com"); err == nil && user.CoupleID != nil {
+			winner, loser = "first", "second"
+		}
+		// Only the owner may invite more people in
+		assert.Equal(t, http.StatusConflict, doJSON(t, client, "POST", ts.URL+"/couples/code", tokens[winner], nil, nil))
+
+		code := generatePairingCode(t, client, ts.URL, tokens["third"])
+		assert.Equal(t, http.StatusConflict, link(tokens["owner"], code))
+
+		// The refused attempt did not use up third's code
+		assert.Equal(t, http.StatusAccepted, link(tokens[loser], code))
+		acceptAll(tokens["third"])
+	})
+
+	t.Run("DatabaseConstraint", func(t *testing.T) {
+		ctx := context.Background()
+		owner, err := db.GetUserByEmail(ctx, "owner@pairing.example.com")
+		require.NoError(t, err)
+		third, err := db.GetUserByEmail(ctx, "third@pairing.example.com")
+		require.NoError(t, err)
+
+		_, err = db.CreateCouple(ctx, third.ID, owner.ID)
+		assert.True(t, database.IsUniqueViolation(err), fmt.Sprint(err))
+
+		// Nothing changed
+		after, err := db.GetUserByEmail(ctx, "owner@pairing.example.com")
+		require.NoError(t, err)
+		assert.Equal(t, owner.CoupleID, after.CoupleID)
+	})
+}
+
+func TestPairingConsent(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	keys := setupTestKeys(t, db)
+	ts := httptest.NewServer(setupRouterWithWS(db, keys))
+	defer ts.Close()
+	client := ts.Client()
+	wsURL := "ws" + strings.TrimPrefix(ts.URL, "http") + "/ws"
+
+	tokens := map[string]string{}
+	for _, name := range []string{"owner", "requester", "other"} {
+		email := name + "@consent.example.com"
+		registerUser(t, client, ts.URL, email, "password123")
+		verifyEmail(t, db, email)
+		tokens[name] = loginUser(t, client, ts.URL, email, "password123")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	dial := func(token string) *websocket.Conn {
+		conn, _, err := websocket.Dial(ctx, fmt.Sprintf("%s?ticket=%s", wsURL, wsTicket(t, client, ts.URL, token)), nil)
+		require.NoError(t, err)
+		return conn
+	}
+	ownerConn := dial(tokens["owner"])
+	defer ownerConn.Close(websocket.StatusNormalClosure, "")
+	requesterConn := dial(tokens["requester"])
+	defer requesterConn.Close(websocket.StatusNormalClosure, "")
+
+	ask := func() database.PairingRequest {
+		code := generatePairingCode(t, client, ts.URL, tokens["owner"])
+		var request database.PairingRequest
+		require.Equal(t, http.StatusAccepted, doJSON(t, client, "POST", ts.URL+"/couples/link", tokens["requester"], map[string]string{"code": code}, &request))
+		return request
+	}
+	respond := func(token string, id int64, answer string) int {
+		return doJSON(t, client, "POST", fmt.Sprintf("%s/couples/requests/%d/%s", ts.URL, id, answer), token, nil, nil)
+	}
+	pending := func(token string) []database.PairingRequest {
+		var requests []database.PairingRequest
+		require.Equal(t, http.StatusOK, doJSON(t, client, "GET", ts.URL+"/couples/requests", token, nil, &requests))
+		return requests
+	}
+
+	t.Run("Reject", func(t *testing.T) {
+		request := ask()
+		assert.Equal(t, database.PairingPending, request.Status)
+		assert.Equal(t, "requester@consent.example.com", request.RequesterEmail)
+
+		var msg map[string]interface{}
+		require.NoError(t, wsjson.Read(ctx, ownerConn, &msg))
+		assert.Equal(t, wsInternal.MessagePairingRequested, msg["type"])
+
+		// Both sides see it; neither is linked yet
+		require.Len(t, pending(tokens["owner"]), 1)
+		require.Len(t, pending(tokens["requester"]), 1)
+		requester, err := db.GetUserByEmail(ctx, "requester@consent.example.com")
+		require.NoError(t, err)
+		assert.Nil(t, requester.CoupleID)
+
+		// Only the owner can answer
+		assert.Equal(t, http.StatusNotFound, respond(tokens["requester"], request.ID, "accept"))
+		assert.Equal(t, http.StatusNotFound, respond(tokens["other"], request.ID, "reject"))
+
+		assert.Equal(t, http.StatusNoContent, respond(tokens["owner"], request.ID, "reject"))
+		require.NoError(t, wsjson.Read(ctx, requesterConn, &msg))
+		assert.Equal(t, wsInternal.MessagePairingRejected, msg["type"])
+
+		assert.Empty(t, pending(tokens["owner"]))
+		assert.Equal(t, http.StatusNotFound, respond(tokens["owner"], request.ID, "accept"))
+	})
+
+	t.Run("Expired", func(t *testing.T) {
+		owner, err := db.GetUserByEmail(ctx, "owner@consent.example.com")
+		require.NoError(t, err)
+		other, err := db.GetUserByEmail(ctx, "other@consent.example.com")
+		require.NoError(t, err)
+
+		request, err := db.CreatePairingRequest(ctx, owner.ID, other.ID, time.Now().Add(-time.Minute))
+		require.NoError(t, err)
+		assert.Empty(t, pending(tokens["other"]))
+		assert.Equal(t, http.StatusNotFound, respond(tokens["owner"], request.ID, "accept"))
+	})
+
+	t.Run("Accept", func(t *testing.T) {
+		request := ask()
+		var msg map[string]interface{}
+		require.NoError(t, wsjson.Read(ctx, ownerConn, &msg))
+
+		var couple database.Couple
+		require.Equal(t, http.StatusCreated, doJSON(t, client, "POST", fmt.Sprintf("%s/couples/requests/%d/accept", ts.URL, request.ID), tokens["owner"], nil, &couple))
+		// Both are told who they are linked with; the requester also hears
+		// back about their request. The pushes are not ordered.
+		received := map[string]map[string]interface{}{}
+		for i := 0; i < 2; i++ {
+			var m map[string]interface{}
+			require.NoError(t, wsjson.Read(ctx, requesterConn, &m))
+			received[m["type"].(string)] = m
+		}
+		assert.Contains(t, received, wsInternal.MessagePairingAccepted)
+		require.Contains(t, received, wsInternal.MessagePartnerLinked)
+		assert.Equal(t, "owner@consent.example.com", received[wsInternal.MessagePartnerLinked]["partner"].(map[string]interface{})["email"])
+
+		require.NoError(t, wsjson.Read(ctx, ownerConn, &msg))
+		assert.Equal(t, wsInternal.MessagePartnerLinked, msg["type"])
+		assert.Equal(t, float64(couple.ID), msg["couple_id"])
+		assert.Equal(t, "requester@consent.example.com", msg["partner"].(map[string]interface{})["email"])
+
+		// The sockets opened before the link relay to each other
+		require.NoError(t, wsjson.Write(ctx, ownerConn, map[string]string{"type": "TOUCH_START"}))
+		require.NoError(t, wsjson.Read(ctx, requesterConn, &msg))
+		assert.Equal(t, "TOUCH_START", msg["type"])
+
+		requester, err := db.GetUserByEmail(ctx, "requester@consent.example.com")
+		require.NoError(t, err)
+		require.NotNil(t, requester.CoupleID)
+		assert.Equal(t, couple.ID, *requester.CoupleID)
+		assert.Empty(t, pending(tokens["requester"]))
+	})
+}
@@ -0,0 +1,116 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bit2swaz/junto/internal/auth"
+	"github.com/bit2swaz/junto/internal/handlers"
+	"github.com/bit2swaz/junto/internal/mailer"
+	"github.com/bit2swaz/junto/internal/middleware"
+	wsInternal "github.com/bit2swaz/junto/internal/websocket"
+	"github.com/coder/websocket"
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var resetTokenPattern = regexp.MustCompile(`token=([A-Za-z0-9_-]+)`)
+
+func TestPasswordReset(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	keys := setupTestKeys(t, db)
+
+	outbox := mailer.NewOutbox("")
+	hub := wsInternal.NewHub(db, keys)
+	authHandler := &handlers.AuthHandler{DB: db, Mailer: outbox, Keys: keys, Hub: hub}
+
+	r := chi.NewRouter()
+	r.Post("/register", authHandler.Register)
+	r.Post("/login", authHandler.Login)
+	r.Post("/password-reset/request", authHandler.RequestPasswordReset)
+	r.Post("/password-reset/confirm", authHandler.ConfirmPasswordReset)
+	r.Get("/ws", hub.HandleWebSocket)
+	r.Group(func(r chi.Router) {
+		r.Use(middleware.AuthMiddleware(db, keys))
+		r.Get("/me", authHandler.Me)
+		r.Post("/ws/ticket", hub.IssueTicket)
+	})
+
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+	client := ts.Client()
+
+	email := "reset@example.com"
+	registerUser(t, client, ts.URL, email, "old-password")
+	oldToken := loginUser(t, client, ts.URL, email, "old-password")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	wsURL := "ws" + strings.TrimPrefix(ts.URL, "http") + "/ws?ticket=" + wsTicket(t, client, ts.URL, oldToken)
+	conn, _, err := websocket.Dial(ctx, wsURL, nil)
+	require.NoError(t, err)
+	defer conn.Close(websocket.StatusNormalClosure, "")
+
+	user, err := db.GetUserByEmail(ctx, email)
+	require.NoError(t, err)
+	_, patHash, err := auth.NewPersonalAccessToken()
+	require.NoError(t, err)
+	_, err = db.CreatePersonalAccessToken(ctx, user.ID, "script", patHash, []string{"vault:read"}, time.Now().Add(time.Hour))
+	require.NoError(t, err)
+
+	// Unknown emails get the same answer and no mail
+	assert.Equal(t, http.StatusAccepted, postJSON(t, client, ts.URL+"/password-reset/request", map[string]string{"email": "nobody@example.com"}))
+	_, sent := outbox.Last("nobody@example.com")
+	assert.False(t, sent)
+
+	// Mail goes out in the background
+	requestReset := func() string {
+		sent := len(outbox.Messages())
+		require.Equal(t, http.StatusAccepted, postJSON(t, client, ts.URL+"/password-reset/request", map[string]string{"email": email}))
+		require.Eventually(t, func() bool { return len(outbox.Messages()) > sent }, 2*time.Second, 10*time.Millisecond, "reset email should be sent")
+		msg, _ := outbox.Last(email)
+		match := resetTokenPattern.FindStringSubmatch(msg.Body)
+		require.Len(t, match, 2)
+		return match[1]
+	}
+	staleToken := requestReset()
+	resetToken := requestReset()
+
+	// Asking again replaces the earlier link
+	stale := map[string]string{"token": staleToken, "password": "new-password"}
+	assert.Equal(t, http.StatusBadRequest, postJSON(t, client, ts.URL+"/password-reset/confirm", stale))
+
+	confirm := map[string]string{"token": resetToken, "password": "new-password"}
+	require.Equal(t, http.StatusOK, postJSON(t, client, ts.URL+"/password-reset/confirm", confirm))
+
+	// Single use
+	assert.Equal(t, http.StatusBadRequest, postJSON(t, client, ts.URL+"/password-reset/confirm", confirm))
+
+	// Existing sessions, sockets and access tokens are gone, the new
+	// password works
+	assert.Equal(t, http.StatusUnauthorized, getWithToken(t, client, ts.URL+"/me", oldToken))
+	_, _, err = conn.Read(ctx)
+	assert.Equal(t, websocket.StatusPolicyViolation, websocket.CloseStatus(err))
+	pat, err := db.GetPersonalAccessTokenByHash(ctx, patHash)
+	require.NoError(t, err)
+	assert.Nil(t, pat)
+	assert.Equal(t, http.StatusUnauthorized, postJSON(t, client, ts.URL+"/login", map[string]string{"email": email, "password": "old-password"}))
+	loginUser(t, client, ts.URL, email, "new-password")
+}
+
+func postJSON(t *testing.T, client *http.Client, url string, body interface{}) int {
+	reqBody, _ := json.Marshal(body)
+	resp, err := client.Post(url, "application/json", bytes.NewBuffer(reqBody))
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	return resp.StatusCode
+}
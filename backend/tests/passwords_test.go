@@ -0,0 +1,130 @@
+package tests
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/bit2swaz/junto/internal/auth"
+	"github.com/bit2swaz/junto/internal/handlers"
+	"github.com/bit2swaz/junto/internal/mailer"
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestPasswordHasher(t *testing.T) {
+	hasher := auth.DefaultPasswordHasher
+
+	encoded, err := hasher.Hash("correct horse")
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(encoded, "$argon2id$v=19$m=65536,t=3,p=4$"))
+
+	match, rehash, err := hasher.Verify("correct horse", encoded)
+	require.NoError(t, err)
+	assert.True(t, match)
+	assert.False(t, rehash)
+
+	match, _, err = hasher.Verify("wrong horse", encoded)
+	require.NoError(t, err)
+	assert.False(t, match)
+
+	// Hashes with weaker parameters still verify but ask for an upgrade
+	weak, err := auth.NewArgon2idHasher(auth.Argon2idParams{Memory: 8 * 1024, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32}).Hash("correct horse")
+	require.NoError(t, err)
+	match, rehash, err = hasher.Verify("correct horse", weak)
+	require.NoError(t, err)
+	assert.True(t, match)
+	assert.True(t, rehash)
+
+	legacy, err := bcrypt.GenerateFromPassword([]byte("correct horse"), bcrypt.MinCost)
+	require.NoError(t, err)
+	match, rehash, err = hasher.Verify("correct horse", string(legacy))
+	require.NoError(t, err)
+	assert.True(t, match)
+	assert.True(t, rehash)
+
+	match, _, err = hasher.Verify("", "")
+	require.NoError(t, err)
+	assert.False(t, match, "accounts without a password never match")
+
+	_, _, err = hasher.Verify("correct horse", "$argon2id$garbage")
+	assert.Error(t, err)
+}
+
+func TestPasswordPolicy(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "blocklist.txt")
+	require.NoError(t, os.WriteFile(path, []byte("# common\nletmein123\nHunter2Hunter2\n"), 0o600))
+	t.Setenv("PASSWORD_BLOCKLIST_FILE", path)
+	t.Setenv("PASSWORD_MIN_LENGTH", "10")
+
+	policy, err := auth.LoadPasswordPolicy()
+	require.NoError(t, err)
+
+	assert.Error(t, policy.Check("short"))
+	assert.Error(t, policy.Check("LetMeIn123"))
+	assert.Error(t, policy.Check("hunter2hunter2"))
+	assert.NoError(t, policy.Check("a much better passphrase"))
+
+	t.Setenv("PASSWORD_BLOCKLIST_FILE", filepath.Join(t.TempDir(), "missing.txt"))
+	_, err = auth.LoadPasswordPolicy()
+	assert.Error(t, err, "a configured blocklist must exist")
+
+	// Without one, the built-in list applies wherever the server runs from
+	t.Setenv("PASSWORD_BLOCKLIST_FILE", "")
+	t.Setenv("PASSWORD_MIN_LENGTH", "")
+	t.Chdir(t.TempDir())
+	policy, err = auth.LoadPasswordPolicy()
+	require.NoError(t, err)
+	assert.Error(t, policy.Check("123456789"))
+}
+
+func TestPasswordUpgradeOnLogin(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	keys := setupTestKeys(t, db)
+
+	authHandler := &handlers.AuthHandler{
+		DB:             db,
+		Mailer:         mailer.NewOutbox(""),
+		Keys:           keys,
+		PasswordPolicy: auth.NewPasswordPolicy(8, []string{"password123"}),
+	}
+	r := chi.NewRouter()
+	r.Post("/register", authHandler.Register)
+	r.Post("/login", authHandler.Login)
+
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+	client := ts.Client()
+
+	t.Run("PolicyOnRegister", func(t *testing.T) {
+		assert.Equal(t, http.StatusBadRequest, postJSON(t, client, ts.URL+"/register", map[string]string{"email": "weak@example.com", "password": "Password123"}))
+		assert.Equal(t, http.StatusBadRequest, postJSON(t, client, ts.URL+"/register", map[string]string{"email": "weak@example.com", "password": "short"}))
+		assert.Equal(t, http.StatusCreated, postJSON(t, client, ts.URL+"/register", map[string]string{"email": "weak@example.com", "password": "correct horse"}))
+	})
+
+	t.Run("BcryptRehash", func(t *testing.T) {
+		legacy, err := bcrypt.GenerateFromPassword([]byte("old-school-pw"), bcrypt.DefaultCost)
+		require.NoError(t, err)
+		_, err = db.CreateUser(context.Background(), "legacy@example.com", string(legacy))
+		require.NoError(t, err)
+
+		assert.Equal(t, http.StatusUnauthorized, postJSON(t, client, ts.URL+"/login", map[string]string{"email": "legacy@example.com", "password": "wrong-pw"}))
+		user, err := db.GetUserByEmail(context.Background(), "legacy@example.com")
+		require.NoError(t, err)
+		assert.Equal(t, string(legacy), user.PasswordHash, "failed logins don't touch the hash")
+
+		loginUser(t, client, ts.URL, "legacy@example.com", "old-school-pw")
+		user, err = db.GetUserByEmail(context.Background(), "legacy@example.com")
+		require.NoError(t, err)
+		assert.True(t, strings.HasPrefix(user.PasswordHash, "$argon2id$"))
+
+		loginUser(t, client, ts.URL, "legacy@example.com", "old-school-pw")
+	})
+}
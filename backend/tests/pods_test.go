@@ -0,0 +1,294 @@
+package tests
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bit2swaz/junto/internal/database"
+	"github.com/bit2swaz/junto/internal/handlers"
+	"github.com/bit2swaz/junto/internal/jobs"
+	"github.com/bit2swaz/junto/internal/mailer"
+	"github.com/bit2swaz/junto/internal/middleware"
+	wsInternal "github.com/bit2swaz/junto/internal/websocket"
+	"github.com/coder/websocket"
+	"github.com/coder/websocket/wsjson"
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPods(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	keys := setupTestKeys(t, db)
+
+	authHandler := &handlers.AuthHandler{DB: db, Mailer: mailer.NewOutbox(""), Keys: keys}
+	hub := wsInternal.NewHub(db, keys)
+	coupleHandler := &handlers.CoupleHandler{DB: db, Hub: hub}
+	vaultHandler := &handlers.VaultHandler{DB: db}
+
+	r := chi.NewRouter()
+	r.Post("/register", authHandler.Register)
+	r.Post("/login", authHandler.Login)
+	r.Get("/ws", hub.HandleWebSocket)
+	r.Group(func(r chi.Router) {
+		r.Use(middleware.AuthMiddleware(db, keys))
+		r.Post("/ws/ticket", hub.IssueTicket)
+		r.Post("/couples/code", coupleHandler.GeneratePairingCode)
+		r.Post("/couples/link", coupleHandler.LinkPartner)
+		r.Post("/couples/requests/{id}/accept", coupleHandler.AcceptPairingRequest)
+		r.Post("/couples/unlink", coupleHandler.RequestUnlink)
+		r.Post("/couples/unlink/cancel", coupleHandler.CancelUnlink)
+		r.Post("/couples/leave", coupleHandler.LeaveCouple)
+		r.Post("/vault", vaultHandler.AddToVault)
+		r.Get("/vault", vaultHandler.GetVaultItems)
+		r.Get("/vault/archive", vaultHandler.GetArchivedVaultItems)
+	})
+
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+	client := ts.Client()
+	wsURL := "ws" + strings.TrimPrefix(ts.URL, "http") + "/ws"
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	tokens := map[string]string{}
+	users := map[string]*database.User{}
+	for _, name := range []string{"owner", "second", "third"} {
+		email := name + "@pod.example.com"
+		registerUser(t, client, ts.URL, email, "password123")
+		verifyEmail(t, db, email)
+		tokens[name] = loginUser(t, client, ts.URL, email, "password123")
+		user, err := db.GetUserByEmail(ctx, email)
+		require.NoError(t, err)
+		users[name] = user
+	}
+	dial := func(name string) *websocket.Conn {
+		conn, _, err := websocket.Dial(ctx, wsURL+"?ticket="+wsTicket(t, client, ts.URL, tokens[name]), nil)
+		require.NoError(t, err)
+		return conn
+	}
+
+	linkPartner(t, client, ts.URL, tokens["owner"], tokens["second"], generatePairingCode(t, client, ts.URL, tokens["owner"]))
+	ownerConn := dial("owner")
+	defer ownerConn.Close(websocket.StatusNormalClosure, "")
+	secondConn := dial("second")
+	defer secondConn.Close(websocket.StatusNormalClosure, "")
+	thirdConn := dial("third")
+	defer thirdConn.Close(websocket.StatusNormalClosure, "")
+
+	// Written before third joins, so only the first two can read it
+	createVaultItem(t, client, ts.URL, tokens["owner"], "just us two", time.Now().Add(-time.Minute))
+
+	var coupleID int64
+	t.Run("OwnerInvitesThird", func(t *testing.T) {
+		// Members other than the owner cannot invite
+		assert.Equal(t, http.StatusConflict, doJSON(t, client, "POST", ts.URL+"/couples/code", tokens["second"], nil, nil))
+
+		linkPartner(t, client, ts.URL, tokens["owner"], tokens["third"], generatePairingCode(t, client, ts.URL, tokens["owner"]))
+
+		third, err := db.GetUserByEmail(ctx, "third@pod.example.com")
+		require.NoError(t, err)
+		require.NotNil(t, third.CoupleID)
+		coupleID = *third.CoupleID
+		assert.Equal(t, *users["owner"].CoupleID, coupleID)
+
+		couple, err := db.GetCoupleByID(ctx, coupleID)
+		require.NoError(t, err)
+		assert.ElementsMatch(t, []int64{users["owner"].ID, users["second"].ID, third.ID}, couple.ActiveMemberIDs())
+		assert.Equal(t, database.MemberRoleOwner, couple.RoleOf(users["owner"].ID))
+		assert.Equal(t, database.MemberRoleMember, couple.RoleOf(third.ID))
+	})
+
+	t.Run("Introductions", func(t *testing.T) {
+		// owner first hears of the request
+		var msg map[string]interface{}
+		require.NoError(t, wsjson.Read(ctx, ownerConn, &msg))
+		assert.Equal(t, wsInternal.MessagePairingRequested, msg["type"])
+
+		for _, conn := range []*websocket.Conn{ownerConn, secondConn} {
+			require.NoError(t, wsjson.Read(ctx, conn, &msg))
+			assert.Equal(t, wsInternal.MessagePartnerLinked, msg["type"])
+			assert.Equal(t, "third@pod.example.com", msg["partner"].(map[string]interface{})["email"])
+			assert.Len(t, msg["members"], 2)
+		}
+
+		// third also hears back about the request; the pushes are not ordered
+		var linked map[string]interface{}
+		for i := 0; i < 2; i++ {
+			require.NoError(t, wsjson.Read(ctx, thirdConn, &msg))
+			if msg["type"] == wsInternal.MessagePartnerLinked {
+				linked = msg
+			}
+		}
+		require.NotNil(t, linked)
+		assert.Equal(t, "owner@pod.example.com", linked["partner"].(map[string]interface{})["email"])
+		assert.Len(t, linked["members"], 2)
+	})
+
+	t.Run("RelayReachesEveryone", func(t *testing.T) {
+		require.NoError(t, wsjson.Write(ctx, thirdConn, map[string]string{"type": "TOUCH_START"}))
+		for _, conn := range []*websocket.Conn{ownerConn, secondConn} {
+			var msg map[string]interface{}
+			require.NoError(t, wsjson.Read(ctx, conn, &msg))
+			assert.Equal(t, "TOUCH_START", msg["type"])
+			assert.Equal(t, float64(users["third"].ID), msg["from"])
+		}
+	})
+
+	t.Run("SharedVault", func(t *testing.T) {
+		createVaultItem(t, client, ts.URL, tokens["owner"], "for everyone", time.Now().Add(-time.Minute))
+
+		var items []database.VaultItem
+		require.Equal(t, http.StatusOK, doJSON(t, client, "GET", ts.URL+"/vault", tokens["second"], nil, &items))
+		require.Len(t, items, 2)
+
+		// Members only see what was shared since they joined
+		require.Equal(t, http.StatusOK, doJSON(t, client, "GET", ts.URL+"/vault", tokens["third"], nil, &items))
+		require.Len(t, items, 1)
+		assert.Equal(t, "for everyone", items[0].ContentText)
+	})
+
+	t.Run("OnlyOwnerDissolves", func(t *testing.T) {
+		body := map[string]string{"vault_disposition": "delete"}
+		assert.Equal(t, http.StatusForbidden, doJSON(t, client, "POST", ts.URL+"/couples/unlink", tokens["second"], body, nil))
+
+		// Nor can they call off the owner's
+		require.Equal(t, http.StatusAccepted, doJSON(t, client, "POST", ts.URL+"/couples/unlink", tokens["owner"], body, nil))
+		for _, conn := range []*websocket.Conn{secondConn, thirdConn} {
+			var msg map[string]interface{}
+			require.NoError(t, wsjson.Read(ctx, conn, &msg))
+			assert.Equal(t, wsInternal.MessageUnlinkRequested, msg["type"])
+		}
+		assert.Equal(t, http.StatusForbidden, doJSON(t, client, "POST", ts.URL+"/couples/unlink/cancel", tokens["second"], nil, nil))
+		require.Equal(t, http.StatusNoContent, doJSON(t, client, "POST", ts.URL+"/couples/unlink/cancel", tokens["owner"], nil, nil))
+		for _, conn := range []*websocket.Conn{secondConn, thirdConn} {
+			var msg map[string]interface{}
+			require.NoError(t, wsjson.Read(ctx, conn, &msg))
+			assert.Equal(t, wsInternal.MessageUnlinkCancelled, msg["type"])
+		}
+	})
+
+	t.Run("Full", func(t *testing.T) {
+		// Fill the pod up directly
+		for i := 3; i < database.MaxCoupleMembers; i++ {
+			email := fmt.Sprintf("filler%d@pod.example.com", i)
+			registerUser(t, client, ts.URL, email, "password123")
+			filler, err := db.GetUserByEmail(ctx, email)
+			require.NoError(t, err)
+			request, err := db.CreatePairingRequest(ctx, users["owner"].ID, filler.ID, time.Now().Add(time.Hour))
+			require.NoError(t, err)
+			_, _, err = db.AcceptPairingRequest(ctx, request.ID, users["owner"].ID)
+			require.NoError(t, err)
+		}
+		assert.Equal(t, http.StatusConflict, doJSON(t, client, "POST", ts.URL+"/couples/code", tokens["owner"], nil, nil))
+
+		registerUser(t, client, ts.URL, "extra@pod.example.com", "password123")
+		extra, err := db.GetUserByEmail(ctx, "extra@pod.example.com")
+		require.NoError(t, err)
+		request, err := db.CreatePairingRequest(ctx, users["owner"].ID, extra.ID, time.Now().Add(time.Hour))
+		require.NoError(t, err)
+		_, _, err = db.AcceptPairingRequest(ctx, request.ID, users["owner"].ID)
+		assert.ErrorIs(t, err, database.ErrCoupleFull)
+	})
+
+	t.Run("OwnerDeleted", func(t *testing.T) {
+		// An unlink the owner asked for does not outlive them
+		require.Equal(t, http.StatusAccepted, doJSON(t, client, "POST", ts.URL+"/couples/unlink", tokens["owner"], map[string]string{"vault_disposition": "delete"}, nil))
+		for _, conn := range []*websocket.Conn{secondConn, thirdConn} {
+			var msg map[string]interface{}
+			require.NoError(t, wsjson.Read(ctx, conn, &msg))
+			assert.Equal(t, wsInternal.MessageUnlinkRequested, msg["type"])
+		}
+
+		require.NoError(t, db.ScheduleUserDeletion(ctx, users["owner"].ID, time.Now().Add(-time.Minute)))
+		job := &jobs.AccountDeletion{DB: db, Hub: hub, Interval: time.Hour}
+		n, err := job.RunOnce(ctx)
+		require.NoError(t, err)
+		require.Equal(t, 1, n)
+
+		for _, conn := range []*websocket.Conn{secondConn, thirdConn} {
+			var msg map[string]interface{}
+			require.NoError(t, wsjson.Read(ctx, conn, &msg))
+			assert.Equal(t, wsInternal.MessageMemberLeft, msg["type"])
+			assert.Equal(t, float64(users["owner"].ID), msg["user_id"])
+		}
+
+		// The pod carries on under its longest-standing member
+		couple, err := db.GetCoupleByID(ctx, coupleID)
+		require.NoError(t, err)
+		assert.Nil(t, couple.DissolvedAt)
+		assert.Nil(t, couple.UnlinkScheduledAt)
+		assert.Len(t, couple.ActiveMemberIDs(), database.MaxCoupleMembers-1)
+		assert.Equal(t, database.MemberRoleOwner, couple.RoleOf(users["second"].ID))
+	})
+
+	t.Run("MemberLeaves", func(t *testing.T) {
+		createVaultItem(t, client, ts.URL, tokens["third"], "third was here", time.Now().Add(-time.Minute))
+
+		assert.Equal(t, http.StatusBadRequest, doJSON(t, client, "POST", ts.URL+"/couples/leave", tokens["third"], map[string]string{"vault_disposition": "export"}, nil))
+		require.Equal(t, http.StatusNoContent, doJSON(t, client, "POST", ts.URL+"/couples/leave", tokens["third"], map[string]string{"vault_disposition": "archive"}, nil))
+
+		var msg map[string]interface{}
+		require.NoError(t, wsjson.Read(ctx, secondConn, &msg))
+		assert.Equal(t, wsInternal.MessageMemberLeft, msg["type"])
+		assert.Equal(t, float64(users["third"].ID), msg["user_id"])
+
+		couple, err := db.GetCoupleByID(ctx, coupleID)
+		require.NoError(t, err)
+		assert.Nil(t, couple.DissolvedAt)
+		assert.NotContains(t, couple.ActiveMemberIDs(), users["third"].ID)
+		assert.Equal(t, http.StatusBadRequest, doJSON(t, client, "GET", ts.URL+"/vault", tokens["third"], nil, nil))
+
+		// Archive leaves third's item with the pod, and third keeps it
+		var items []database.VaultItem
+		require.Equal(t, http.StatusOK, doJSON(t, client, "GET", ts.URL+"/vault", tokens["second"], nil, &items))
+		assert.Contains(t, vaultContents(items), "third was here")
+		require.Equal(t, http.StatusOK, doJSON(t, client, "GET", ts.URL+"/vault/archive", tokens["third"], nil, &items))
+		assert.Equal(t, []string{"third was here"}, vaultContents(items))
+
+		// Delete takes only the leaver's own items along
+		filler, err := db.GetUserByEmail(ctx, "filler3@pod.example.com")
+		require.NoError(t, err)
+		_, err = db.CreateVaultItem(ctx, coupleID, filler.ID, "filler was here", time.Now().Add(-time.Minute))
+		require.NoError(t, err)
+		left, err := db.LeaveCouple(ctx, coupleID, filler.ID, database.VaultDelete)
+		require.NoError(t, err)
+		require.NotNil(t, left)
+		require.Equal(t, http.StatusOK, doJSON(t, client, "GET", ts.URL+"/vault", tokens["second"], nil, &items))
+		assert.NotContains(t, vaultContents(items), "filler was here")
+		assert.Contains(t, vaultContents(items), "third was here")
+	})
+
+	t.Run("LeftMemberRejoins", func(t *testing.T) {
+		linkPartner(t, client, ts.URL, tokens["second"], tokens["third"], generatePairingCode(t, client, ts.URL, tokens["second"]))
+
+		couple, err := db.GetCoupleByID(ctx, coupleID)
+		require.NoError(t, err)
+		assert.Contains(t, couple.ActiveMemberIDs(), users["third"].ID)
+		assert.Equal(t, database.MemberRoleMember, couple.RoleOf(users["third"].ID))
+
+		// Back in, third sees what was shared since rejoining, while what
+		// they wrote last time stays in their archive
+		createVaultItem(t, client, ts.URL, tokens["second"], "welcome back", time.Now().Add(-time.Minute))
+		var items []database.VaultItem
+		require.Equal(t, http.StatusOK, doJSON(t, client, "GET", ts.URL+"/vault", tokens["third"], nil, &items))
+		assert.Equal(t, []string{"welcome back"}, vaultContents(items))
+		require.Equal(t, http.StatusOK, doJSON(t, client, "GET", ts.URL+"/vault/archive", tokens["third"], nil, &items))
+		assert.Equal(t, []string{"third was here"}, vaultContents(items))
+	})
+}
+
+func vaultContents(items []database.VaultItem) []string {
+	contents := []string{}
+	for _, item := range items {
+		contents = append(contents, item.ContentText)
+	}
+	return contents
+}
@@ -0,0 +1,86 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/bit2swaz/junto/internal/problem"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProblemResponses(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	keys := setupTestKeys(t, db)
+
+	ts := httptest.NewServer(setupRouter(db, keys))
+	defer ts.Close()
+	client := ts.Client()
+
+	post := func(t *testing.T, path, body string) (int, problem.Problem) {
+		resp, err := client.Post(ts.URL+path, "application/json", strings.NewReader(body))
+		require.NoError(t, err)
+		defer resp.Body.Close()
+
+		var p problem.Problem
+		if resp.StatusCode >= 400 {
+			assert.Equal(t, problem.ContentType, resp.Header.Get("Content-Type"))
+			require.NoError(t, json.NewDecoder(resp.Body).Decode(&p))
+			assert.Equal(t, resp.StatusCode, p.Status)
+		}
+		return resp.StatusCode, p
+	}
+
+	t.Run("DuplicateEmail", func(t *testing.T) {
+		registerUser(t, client, ts.URL, "dup@example.com", "password123")
+
+		status, p := post(t, "/register", `{"email":"DUP@example.com","password":"password123"}`)
+		assert.Equal(t, http.StatusConflict, status)
+		assert.Equal(t, problem.CodeEmailTaken, p.Code)
+	})
+
+	t.Run("Validation", func(t *testing.T) {
+		status, p := post(t, "/register", `{"email":"nope","password":""}`)
+		assert.Equal(t, http.StatusBadRequest, status)
+		assert.Equal(t, problem.CodeValidation, p.Code)
+
+		fields := map[string]bool{}
+		for _, fe := range p.Errors {
+			fields[fe.Field] = true
+		}
+		assert.True(t, fields["email"])
+		assert.True(t, fields["password"])
+	})
+
+	t.Run("StrictDecoding", func(t *testing.T) {
+		status, p := post(t, "/register", `{"email":"x@example.com","password":"password123","admin":true}`)
+		assert.Equal(t, http.StatusBadRequest, status)
+		assert.Equal(t, problem.CodeInvalidBody, p.Code)
+
+		status, p = post(t, "/register", `{"email":"x@example.com","password":"password123"}{}`)
+		assert.Equal(t, http.StatusBadRequest, status)
+		assert.Equal(t, problem.CodeInvalidBody, p.Code)
+
+		status, p = post(t, "/login", `{"email":`)
+		assert.Equal(t, http.StatusBadRequest, status)
+		assert.Equal(t, problem.CodeInvalidBody, p.Code)
+	})
+
+	t.Run("BodyLimit", func(t *testing.T) {
+		big := bytes.Repeat([]byte("a"), 1<<20)
+		status, p := post(t, "/register", `{"email":"big@example.com","password":"`+string(big)+`"}`)
+		assert.Equal(t, http.StatusRequestEntityTooLarge, status)
+		assert.Equal(t, problem.CodeBodyTooLarge, p.Code)
+	})
+
+	t.Run("Unauthorized", func(t *testing.T) {
+		status, p := post(t, "/couples/code", `{}`)
+		assert.Equal(t, http.StatusUnauthorized, status)
+		assert.Equal(t, problem.CodeAuthRequired, p.Code)
+	})
+}
@@ -0,0 +1,302 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"image/png"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bit2swaz/junto/internal/avatar"
+	"github.com/bit2swaz/junto/internal/handlers"
+	"github.com/bit2swaz/junto/internal/mailer"
+	"github.com/bit2swaz/junto/internal/middleware"
+	"github.com/bit2swaz/junto/internal/validate"
+	wsInternal "github.com/bit2swaz/junto/internal/websocket"
+	"github.com/coder/websocket"
+	"github.com/coder/websocket/wsjson"
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testAvatarConfig = `{
+	"version": 1,
+	"body": "bean",
+	"colors": {"body": "#FFB3C1", "accent": "#3a86ff", "background": "#fefae0"},
+	"accessories": ["glasses", "scarf"],
+	"expression": "grin"
+}`
+
+func TestAvatarConfig(t *testing.T) {
+	config, err := avatar.Parse(json.RawMessage(testAvatarConfig))
+	require.NoError(t, err)
+	assert.Equal(t, avatar.CurrentVersion, config.Version)
+	assert.Equal(t, "#ffb3c1", config.Colors.Body, "colors are normalized")
+
+	invalid := map[string]string{
+		"not an object":      `"round"`,
+		"unknown version":    strings.Replace(testAvatarConfig, `"version": 1`, `"version": 2`, 1),
+		"missing version":    strings.Replace(testAvatarConfig, `"version": 1,`, ``, 1),
+		"unknown field":      strings.Replace(testAvatarConfig, `"version": 1,`, `"version": 1, "tail": true,`, 1),
+		"unknown body":       strings.Replace(testAvatarConfig, `"bean"`, `"triangle"`, 1),
+		"bad color":          strings.Replace(testAvatarConfig, `"#3a86ff"`, `"blue"`, 1),
+		"unknown accessory":  strings.Replace(testAvatarConfig, `"scarf"`, `"cape"`, 1),
+		"repeated accessory": strings.Replace(testAvatarConfig, `"scarf"`, `"glasses"`, 1),
+		"too many":           strings.Replace(testAvatarConfig, `"scarf"`, `"scarf", "hat", "bow"`, 1),
+		"missing expression": strings.Replace(testAvatarConfig, `"expression": "grin"`, `"expression": ""`, 1),
+	}
+	for name, raw := range invalid {
+		t.Run(name, func(t *testing.T) {
+			_, err := avatar.Parse(json.RawMessage(raw))
+			var errs validate.Errors
+			require.ErrorAs(t, err, &errs)
+			assert.True(t, strings.HasPrefix(errs[0].Field, "avatar_config"), errs[0].Field)
+		})
+	}
+}
+
+func TestProfile(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	keys := setupTestKeys(t, db)
+
+	authHandler := &handlers.AuthHandler{DB: db, Mailer: mailer.NewOutbox(""), Keys: keys}
+	hub := wsInternal.NewHub(db, keys)
+	coupleHandler := &handlers.CoupleHandler{DB: db, Hub: hub}
+	profileHandler := &handlers.ProfileHandler{DB: db, Hub: hub}
+
+	r := chi.NewRouter()
+	r.Post("/register", authHandler.Register)
+	r.Post("/login", authHandler.Login)
+	r.Get("/ws", hub.HandleWebSocket)
+	r.Group(func(r chi.Router) {
+		r.Use(middleware.AuthMiddleware(db, keys))
+		r.Post("/ws/ticket", hub.IssueTicket)
+		r.Post("/couples/code", coupleHandler.GeneratePairingCode)
+		r.Post("/couples/link", coupleHandler.LinkPartner)
+		r.Post("/couples/requests/{id}/accept", coupleHandler.AcceptPairingRequest)
+		r.Get("/me/profile", profileHandler.GetProfile)
+		r.Patch("/me/profile", profileHandler.UpdateProfile)
+	})
+
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+	client := ts.Client()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	for _, email := range []string{"me-a@example.com", "me-b@example.com"} {
+		registerUser(t, client, ts.URL, email, "password123")
+		verifyEmail(t, db, email)
+	}
+	tokenA := loginUser(t, client, ts.URL, "me-a@example.com", "password123")
+	tokenB := loginUser(t, client, ts.URL, "me-b@example.com", "password123")
+
+	t.Run("Defaults", func(t *testing.T) {
+		var profile handlers.Profile
+		require.Equal(t, http.StatusOK, doJSON(t, client, "GET", ts.URL+"/me/profile", tokenA, nil, &profile))
+		assert.Empty(t, profile.DisplayName)
+		assert.Equal(t, "UTC", profile.Timezone)
+		assert.Equal(t, "null", string(profile.AvatarConfig))
+	})
+
+	t.Run("Update", func(t *testing.T) {
+		var profile handlers.Profile
+		require.Equal(t, http.StatusOK, doJSON(t, client, "PATCH", ts.URL+"/me/profile", tokenA, map[string]string{
+			"display_name": "Alex",
+			"pronouns":     "they/them",
+			"timezone":     "America/Sao_Paulo",
+		}, &profile))
+		assert.Equal(t, "Alex", profile.DisplayName)
+		assert.Equal(t, "they/them", profile.Pronouns)
+		assert.Equal(t, "America/Sao_Paulo", profile.Timezone)
+
+		// Fields left out are kept
+		require.Equal(t, http.StatusOK, doJSON(t, client, "PATCH", ts.URL+"/me/profile", tokenA, map[string]string{"pronouns": "she/her"}, &profile))
+		assert.Equal(t, "Alex", profile.DisplayName)
+		assert.Equal(t, "she/her", profile.Pronouns)
+	})
+
+	t.Run("Validation", func(t *testing.T) {
+		for _, body := range []map[string]interface{}{
+			{"timezone": "Mars/Olympus_Mons"},
+			{"timezone": "Local"},
+			{"display_name": strings.Repeat("x", 51)},
+			{"avatar_config": map[string]interface{}{"version": 99}},
+			{"avatar_config": nil},
+		} {
+			assert.Equal(t, http.StatusBadRequest, doJSON(t, client, "PATCH", ts.URL+"/me/profile", tokenA, body, nil), body)
+		}
+	})
+
+	t.Run("AvatarBroadcast", func(t *testing.T) {
+		linkPartner(t, client, ts.URL, tokenA, tokenB, generatePairingCode(t, client, ts.URL, tokenA))
+		wsURL := "ws" + strings.TrimPrefix(ts.URL, "http") + "/ws"
+		connB, _, err := websocket.Dial(ctx, wsURL+"?ticket="+wsTicket(t, client, ts.URL, tokenB), nil)
+		require.NoError(t, err)
+		defer connB.Close(websocket.StatusNormalClosure, "")
+
+		var profile handlers.Profile
+		require.Equal(t, http.StatusOK, doJSON(t, client, "PATCH", ts.URL+"/me/profile", tokenA,
+			map[string]json.RawMessage{"avatar_config": json.RawMessage(testAvatarConfig)}, &profile))
+		var stored avatar.Config
+		require.NoError(t, json.Unmarshal(profile.AvatarConfig, &stored))
+		assert.Equal(t, "#ffb3c1", stored.Colors.Body)
+
+		var msg struct {
+			Type    string                    `json:"type"`
+			Partner wsInternal.PartnerProfile `json:"partner"`
+		}
+		require.NoError(t, wsjson.Read(ctx, connB, &msg))
+		assert.Equal(t, wsInternal.MessageAvatarUpdated, msg.Type)
+		assert.Equal(t, "Alex", msg.Partner.DisplayName)
+		assert.JSONEq(t, string(profile.AvatarConfig), string(msg.Partner.AvatarConfig))
+	})
+}
+
+func TestAvatarRendering(t *testing.T) {
+	config, err := avatar.Parse(json.RawMessage(testAvatarConfig))
+	require.NoError(t, err)
+
+	svg := avatar.SVG(config, 64)
+	assert.Equal(t, svg, avatar.SVG(config, 64), "rendering is deterministic")
+	assert.True(t, bytes.HasPrefix(svg, []byte(`<svg xmlns="http://www.w3.org/2000/svg" width="64" height="64"`)))
+
+	// Accessories are drawn the same whatever order they are listed in
+	reordered := *config
+	reordered.Accessories = []string{"scarf", "glasses"}
+	assert.Equal(t, svg, avatar.SVG(&reordered, 64))
+
+	first, err := avatar.PNG(config, 48)
+	require.NoError(t, err)
+	second, err := avatar.PNG(config, 48)
+	require.NoError(t, err)
+	assert.Equal(t, first, second)
+	img, err := png.Decode(bytes.NewReader(first))
+	require.NoError(t, err)
+	assert.Equal(t, 48, img.Bounds().Dx())
+
+	// Every user gets a valid default that stays the same
+	for seed := int64(1); seed <= 50; seed++ {
+		def := avatar.Default(seed)
+		assert.Equal(t, def, avatar.Default(seed))
+		raw, err := json.Marshal(def)
+		require.NoError(t, err)
+		_, err = avatar.Parse(raw)
+		assert.NoError(t, err, string(raw))
+	}
+}
+
+func TestAvatarEndpoint(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	keys := setupTestKeys(t, db)
+
+	authHandler := &handlers.AuthHandler{DB: db, Mailer: mailer.NewOutbox(""), Keys: keys}
+	hub := wsInternal.NewHub(db, keys)
+	coupleHandler := &handlers.CoupleHandler{DB: db, Hub: hub}
+	profileHandler := &handlers.ProfileHandler{DB: db, Hub: hub}
+
+	r := chi.NewRouter()
+	r.Post("/register", authHandler.Register)
+	r.Post("/login", authHandler.Login)
+	r.Group(func(r chi.Router) {
+		r.Use(middleware.AuthMiddleware(db, keys))
+		r.Post("/couples/code", coupleHandler.GeneratePairingCode)
+		r.Post("/couples/link", coupleHandler.LinkPartner)
+		r.Post("/couples/requests/{id}/accept", coupleHandler.AcceptPairingRequest)
+		r.Patch("/me/profile", profileHandler.UpdateProfile)
+		r.Get("/users/{id}/avatar.svg", profileHandler.AvatarSVG)
+		r.Get("/users/{id}/avatar.png", profileHandler.AvatarPNG)
+	})
+
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+	client := ts.Client()
+
+	for _, email := range []string{"avatar-a@example.com", "avatar-b@example.com", "avatar-c@example.com"} {
+		registerUser(t, client, ts.URL, email, "password123")
+		verifyEmail(t, db, email)
+	}
+	tokenA := loginUser(t, client, ts.URL, "avatar-a@example.com", "password123")
+	tokenB := loginUser(t, client, ts.URL, "avatar-b@example.com", "password123")
+	tokenC := loginUser(t, client, ts.URL, "avatar-c@example.com", "password123")
+	linkPartner(t, client, ts.URL, tokenA, tokenB, generatePairingCode(t, client, ts.URL, tokenA))
+
+	userA, err := db.GetUserByEmail(context.Background(), "avatar-a@example.com")
+	require.NoError(t, err)
+	avatarURL := fmt.Sprintf("%s/users/%d/avatar", ts.URL, userA.ID)
+
+	get := func(t *testing.T, url, token, ifNoneMatch string) (*http.Response, []byte) {
+		req, err := http.NewRequest("GET", url, nil)
+		require.NoError(t, err)
+		req.Header.Set("Authorization", "Bearer "+token)
+		if ifNoneMatch != "" {
+			req.Header.Set("If-None-Match", ifNoneMatch)
+		}
+		resp, err := client.Do(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		return resp, body
+	}
+
+	t.Run("Access", func(t *testing.T) {
+		resp, body := get(t, avatarURL+".svg", tokenA, "")
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, "image/svg+xml", resp.Header.Get("Content-Type"))
+		assert.Equal(t, avatar.SVG(avatar.Default(userA.ID), avatar.DefaultSize), body, "users without a config get their default")
+
+		resp, _ = get(t, avatarURL+".svg", tokenB, "")
+		assert.Equal(t, http.StatusOK, resp.StatusCode, "partners can see each other's avatar")
+
+		resp, _ = get(t, avatarURL+".svg", tokenC, "")
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode, "strangers cannot")
+		resp, _ = get(t, ts.URL+"/users/999999/avatar.svg", tokenA, "")
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	})
+
+	t.Run("Sizes", func(t *testing.T) {
+		resp, body := get(t, avatarURL+".png?size=32", tokenB, "")
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, "image/png", resp.Header.Get("Content-Type"))
+		img, err := png.Decode(bytes.NewReader(body))
+		require.NoError(t, err)
+		assert.Equal(t, 32, img.Bounds().Dx())
+
+		for _, size := range []string{"8", "4096", "big"} {
+			resp, _ := get(t, avatarURL+".png?size="+size, tokenA, "")
+			assert.Equal(t, http.StatusBadRequest, resp.StatusCode, size)
+		}
+	})
+
+	t.Run("ETag", func(t *testing.T) {
+		resp, _ := get(t, avatarURL+".svg", tokenB, "")
+		etag := resp.Header.Get("ETag")
+		require.NotEmpty(t, etag)
+
+		resp, body := get(t, avatarURL+".svg", tokenB, etag)
+		assert.Equal(t, http.StatusNotModified, resp.StatusCode)
+		assert.Empty(t, body)
+
+		// Each size is its own image
+		resp, _ = get(t, avatarURL+".svg?size=64", tokenB, etag)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+		// Changing the avatar changes the tag
+		require.Equal(t, http.StatusOK, doJSON(t, client, "PATCH", ts.URL+"/me/profile", tokenA,
+			map[string]json.RawMessage{"avatar_config": json.RawMessage(testAvatarConfig)}, nil))
+		resp, _ = get(t, avatarURL+".svg", tokenB, etag)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.NotEqual(t, etag, resp.Header.Get("ETag"))
+	})
+}
@@ -0,0 +1,208 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bit2swaz/junto/internal/auth"
+	"github.com/bit2swaz/junto/internal/database"
+	"github.com/bit2swaz/junto/internal/handlers"
+	"github.com/bit2swaz/junto/internal/mailer"
+	"github.com/bit2swaz/junto/internal/middleware"
+	wsInternal "github.com/bit2swaz/junto/internal/websocket"
+	"github.com/coder/websocket"
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func setupSessionRouter(db database.Service, keys *auth.KeyManager) *chi.Mux {
+	authHandler := &handlers.AuthHandler{DB: db, Mailer: mailer.NewOutbox(""), Keys: keys}
+	hub := wsInternal.NewHub(db, keys)
+	sessionHandler := &handlers.SessionHandler{DB: db, Hub: hub}
+
+	r := chi.NewRouter()
+	r.Post("/register", authHandler.Register)
+	r.Post("/login", authHandler.Login)
+	r.Post("/refresh", authHandler.Refresh)
+	r.Get("/ws", hub.HandleWebSocket)
+
+	r.Group(func(r chi.Router) {
+		r.Use(middleware.AuthMiddleware(db, keys))
+		r.Get("/me", authHandler.Me)
+		r.Post("/logout", authHandler.Logout)
+		r.Post("/logout-all", authHandler.LogoutAll)
+		r.Get("/me/sessions", sessionHandler.ListSessions)
+		r.Delete("/me/sessions/{id}", sessionHandler.RevokeSession)
+		r.Post("/ws/ticket", hub.IssueTicket)
+	})
+
+	return r
+}
+
+func TestSessions(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	keys := setupTestKeys(t, db)
+
+	ts := httptest.NewServer(setupSessionRouter(db, keys))
+	defer ts.Close()
+	client := ts.Client()
+
+	email := "sessions@example.com"
+	pass := "password123"
+	registerUser(t, client, ts.URL, email, pass)
+
+	t.Run("RefreshRotation", func(t *testing.T) {
+		first := loginSession(t, client, ts.URL, email, pass)
+
+		status, second := refreshSession(t, client, ts.URL, first.RefreshToken)
+		require.Equal(t, http.StatusOK, status)
+		assert.NotEqual(t, first.RefreshToken, second.RefreshToken)
+		assert.Equal(t, http.StatusOK, getWithToken(t, client, ts.URL+"/me", second.Token))
+
+		// Replaying the rotated token kills the whole session family
+		status, _ = refreshSession(t, client, ts.URL, first.RefreshToken)
+		assert.Equal(t, http.StatusUnauthorized, status)
+		assert.Equal(t, http.StatusUnauthorized, getWithToken(t, client, ts.URL+"/me", second.Token))
+
+		status, _ = refreshSession(t, client, ts.URL, second.RefreshToken)
+		assert.Equal(t, http.StatusUnauthorized, status)
+	})
+
+	t.Run("RefreshRecordsDevice", func(t *testing.T) {
+		session := loginSession(t, client, ts.URL, email, pass)
+
+		reqBody, _ := json.Marshal(map[string]string{"refresh_token": session.RefreshToken})
+		req, err := http.NewRequest("POST", ts.URL+"/refresh", bytes.NewBuffer(reqBody))
+		require.NoError(t, err)
+		req.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) Firefox/128.0")
+		resp, err := client.Do(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+
+		sessionID, _, err := auth.ParseRefreshToken(session.RefreshToken)
+		require.NoError(t, err)
+		stored, err := db.GetSession(context.Background(), sessionID)
+		require.NoError(t, err)
+		require.NotNil(t, stored)
+		assert.Equal(t, "Firefox on Windows", stored.DeviceName)
+	})
+
+	t.Run("Logout", func(t *testing.T) {
+		session := loginSession(t, client, ts.URL, email, pass)
+		other := loginSession(t, client, ts.URL, email, pass)
+
+		assert.Equal(t, http.StatusOK, postWithToken(t, client, ts.URL+"/logout", session.Token))
+		assert.Equal(t, http.StatusUnauthorized, getWithToken(t, client, ts.URL+"/me", session.Token))
+		assert.Equal(t, http.StatusOK, getWithToken(t, client, ts.URL+"/me", other.Token))
+	})
+
+	t.Run("LogoutAll", func(t *testing.T) {
+		a := loginSession(t, client, ts.URL, email, pass)
+		b := loginSession(t, client, ts.URL, email, pass)
+
+		assert.Equal(t, http.StatusOK, postWithToken(t, client, ts.URL+"/logout-all", a.Token))
+		assert.Equal(t, http.StatusUnauthorized, getWithToken(t, client, ts.URL+"/me", a.Token))
+		assert.Equal(t, http.StatusUnauthorized, getWithToken(t, client, ts.URL+"/me", b.Token))
+
+		status, _ := refreshSession(t, client, ts.URL, b.RefreshToken)
+		assert.Equal(t, http.StatusUnauthorized, status)
+	})
+
+	t.Run("DeviceManagement", func(t *testing.T) {
+		a := loginSession(t, client, ts.URL, email, pass)
+		b := loginSession(t, client, ts.URL, email, pass)
+
+		var sessions []handlers.SessionResponse
+		require.Equal(t, http.StatusOK, doJSON(t, client, "GET", ts.URL+"/me/sessions", a.Token, nil, &sessions))
+		require.Len(t, sessions, 2)
+
+		var other handlers.SessionResponse
+		for _, s := range sessions {
+			assert.Equal(t, "127.0.0.1", s.IP)
+			assert.NotEmpty(t, s.UserAgent)
+			assert.NotEmpty(t, s.DeviceName)
+			assert.False(t, s.LastSeenAt.IsZero())
+			if !s.Current {
+				other = s
+			}
+		}
+		require.NotEmpty(t, other.ID)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		wsURL := "ws" + strings.TrimPrefix(ts.URL, "http") + "/ws?ticket=" + wsTicket(t, client, ts.URL, b.Token)
+		conn, _, err := websocket.Dial(ctx, wsURL, nil)
+		require.NoError(t, err)
+
+		require.Equal(t, http.StatusNoContent, doJSON(t, client, "DELETE", ts.URL+"/me/sessions/"+other.ID, a.Token, nil, nil))
+		assert.Equal(t, http.StatusUnauthorized, getWithToken(t, client, ts.URL+"/me", b.Token))
+		assert.Equal(t, http.StatusOK, getWithToken(t, client, ts.URL+"/me", a.Token))
+
+		// The revoked device's socket is dropped right away
+		_, _, err = conn.Read(ctx)
+		assert.Equal(t, websocket.StatusPolicyViolation, websocket.CloseStatus(err))
+
+		assert.Equal(t, http.StatusNotFound, doJSON(t, client, "DELETE", ts.URL+"/me/sessions/"+other.ID, a.Token, nil, nil))
+	})
+}
+
+func loginSession(t *testing.T, client *http.Client, baseURL, email, password string) handlers.AuthResponse {
+	reqBody, _ := json.Marshal(map[string]string{
+		"email":    email,
+		"password": password,
+	})
+	resp, err := client.Post(baseURL+"/login", "application/json", bytes.NewBuffer(reqBody))
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var res handlers.AuthResponse
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&res))
+	return res
+}
+
+func refreshSession(t *testing.T, client *http.Client, baseURL, refreshToken string) (int, handlers.AuthResponse) {
+	reqBody, _ := json.Marshal(map[string]string{
+		"refresh_token": refreshToken,
+	})
+	resp, err := client.Post(baseURL+"/refresh", "application/json", bytes.NewBuffer(reqBody))
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	var res handlers.AuthResponse
+	if resp.StatusCode == http.StatusOK {
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&res))
+	}
+	return resp.StatusCode, res
+}
+
+func getWithToken(t *testing.T, client *http.Client, url, token string) int {
+	req, err := http.NewRequest("GET", url, nil)
+	require.NoError(t, err)
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	resp, err := client.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	return resp.StatusCode
+}
+
+func postWithToken(t *testing.T, client *http.Client, url, token string) int {
+	req, err := http.NewRequest("POST", url, nil)
+	require.NoError(t, err)
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	resp, err := client.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	return resp.StatusCode
+}
@@ -0,0 +1,154 @@
+package tests
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bit2swaz/junto/internal/auth"
+	"github.com/bit2swaz/junto/internal/handlers"
+	"github.com/bit2swaz/junto/internal/mailer"
+	"github.com/bit2swaz/junto/internal/middleware"
+	wsInternal "github.com/bit2swaz/junto/internal/websocket"
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPersonalAccessTokens(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	keys := setupTestKeys(t, db)
+
+	authHandler := &handlers.AuthHandler{DB: db, Mailer: mailer.NewOutbox(""), Keys: keys}
+	hub := wsInternal.NewHub(db, keys)
+	coupleHandler := &handlers.CoupleHandler{DB: db, Hub: hub}
+	vaultHandler := &handlers.VaultHandler{DB: db}
+	roomHandler := &handlers.RoomHandler{DB: db, Hub: hub}
+	tokenHandler := &handlers.TokenHandler{DB: db}
+
+	r := chi.NewRouter()
+	r.Post("/register", authHandler.Register)
+	r.Post("/login", authHandler.Login)
+	r.Group(func(r chi.Router) {
+		r.Use(middleware.AuthMiddleware(db, keys))
+		r.Post("/vault", vaultHandler.AddToVault)
+		r.Get("/vault", vaultHandler.GetVaultItems)
+		r.Post("/room/touch", roomHandler.Touch)
+		r.Group(func(r chi.Router) {
+			r.Use(middleware.RequireSession)
+			r.Get("/me", authHandler.Me)
+			r.Post("/me/tokens", tokenHandler.CreateToken)
+			r.Get("/me/tokens", tokenHandler.ListTokens)
+			r.Delete("/me/tokens/{id}", tokenHandler.DeleteToken)
+			r.Post("/couples/code", coupleHandler.GeneratePairingCode)
+			r.Post("/couples/link", coupleHandler.LinkPartner)
+			r.Post("/couples/requests/{id}/accept", coupleHandler.AcceptPairingRequest)
+		})
+	})
+
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+	client := ts.Client()
+
+	registerUser(t, client, ts.URL, "pat-a@example.com", "password123")
+	registerUser(t, client, ts.URL, "pat-b@example.com", "password123")
+	verifyEmail(t, db, "pat-a@example.com")
+	verifyEmail(t, db, "pat-b@example.com")
+	tokenA := loginUser(t, client, ts.URL, "pat-a@example.com", "password123")
+	tokenB := loginUser(t, client, ts.URL, "pat-b@example.com", "password123")
+	linkPartner(t, client, ts.URL, tokenA, tokenB, generatePairingCode(t, client, ts.URL, tokenA))
+
+	create := func(t *testing.T, body map[string]interface{}) handlers.CreateTokenResponse {
+		var created handlers.CreateTokenResponse
+		require.Equal(t, http.StatusCreated, doJSON(t, client, "POST", ts.URL+"/me/tokens", tokenA, body, &created))
+		return created
+	}
+
+	t.Run("CreateAndList", func(t *testing.T) {
+		created := create(t, map[string]interface{}{"name": "dashboard", "scopes": []string{"vault:read"}})
+		assert.True(t, strings.HasPrefix(created.Token, auth.PersonalAccessTokenPrefix))
+		assert.WithinDuration(t, time.Now().Add(auth.DefaultPersonalAccessTokenTTL), created.ExpiresAt, time.Minute)
+
+		var tokens []map[string]interface{}
+		require.Equal(t, http.StatusOK, doJSON(t, client, "GET", ts.URL+"/me/tokens", tokenA, nil, &tokens))
+		require.NotEmpty(t, tokens)
+		for _, tok := range tokens {
+			assert.NotContains(t, tok, "token")
+			assert.NotContains(t, tok, "token_hash")
+		}
+	})
+
+	t.Run("RejectsBadRequests", func(t *testing.T) {
+		bad := []map[string]interface{}{
+			{"name": "x", "scopes": []string{}},
+			{"name": "x", "scopes": []string{"admin"}},
+			{"name": "x", "scopes": []string{"vault:read", "vault:read"}},
+			{"name": "x", "scopes": []string{"vault:read"}, "expires_at": time.Now().Add(-time.Hour)},
+			{"name": "x", "scopes": []string{"vault:read"}, "expires_at": time.Now().Add(2 * auth.MaxPersonalAccessTokenTTL)},
+		}
+		for _, body := range bad {
+			assert.Equal(t, http.StatusBadRequest, doJSON(t, client, "POST", ts.URL+"/me/tokens", tokenA, body, nil), body)
+		}
+	})
+
+	t.Run("ScopesEnforced", func(t *testing.T) {
+		reader := create(t, map[string]interface{}{"name": "reader", "scopes": []string{"vault:read"}}).Token
+		writer := create(t, map[string]interface{}{"name": "writer", "scopes": []string{"vault:write", "room:touch"}}).Token
+		item := map[string]interface{}{"content": "hello", "unlock_at": time.Now().Add(time.Hour)}
+
+		assert.Equal(t, http.StatusOK, doJSON(t, client, "GET", ts.URL+"/vault", reader, nil, nil))
+		assert.Equal(t, http.StatusForbidden, doJSON(t, client, "POST", ts.URL+"/vault", reader, item, nil))
+		assert.Equal(t, http.StatusForbidden, doJSON(t, client, "POST", ts.URL+"/room/touch", reader, map[string]string{"type": "TOUCH_START"}, nil))
+
+		assert.Equal(t, http.StatusCreated, doJSON(t, client, "POST", ts.URL+"/vault", writer, item, nil))
+		assert.Equal(t, http.StatusForbidden, doJSON(t, client, "GET", ts.URL+"/vault", writer, nil, nil))
+		assert.Equal(t, http.StatusAccepted, doJSON(t, client, "POST", ts.URL+"/room/touch", writer, map[string]string{"type": "TOUCH_START"}, nil))
+		assert.Equal(t, http.StatusBadRequest, doJSON(t, client, "POST", ts.URL+"/room/touch", writer, map[string]string{"type": "move"}, nil))
+	})
+
+	t.Run("SessionOnlyRoutes", func(t *testing.T) {
+		pat := create(t, map[string]interface{}{"name": "all", "scopes": []string{"vault:read", "vault:write", "room:touch"}}).Token
+		assert.Equal(t, http.StatusForbidden, doJSON(t, client, "GET", ts.URL+"/me", pat, nil, nil))
+		assert.Equal(t, http.StatusForbidden, doJSON(t, client, "GET", ts.URL+"/me/tokens", pat, nil, nil))
+		// A token must not be able to mint broader tokens
+		body := map[string]interface{}{"name": "escalate", "scopes": []string{"vault:read"}}
+		assert.Equal(t, http.StatusForbidden, doJSON(t, client, "POST", ts.URL+"/me/tokens", pat, body, nil))
+	})
+
+	t.Run("LastUsedTracked", func(t *testing.T) {
+		created := create(t, map[string]interface{}{"name": "tracked", "scopes": []string{"vault:read"}})
+		assert.Nil(t, created.LastUsedAt)
+		require.Equal(t, http.StatusOK, doJSON(t, client, "GET", ts.URL+"/vault", created.Token, nil, nil))
+
+		pat, err := db.GetPersonalAccessTokenByHash(context.Background(), auth.HashToken(created.Token))
+		require.NoError(t, err)
+		require.NotNil(t, pat.LastUsedAt)
+	})
+
+	t.Run("Expired", func(t *testing.T) {
+		user, err := db.GetUserByEmail(context.Background(), "pat-a@example.com")
+		require.NoError(t, err)
+		token, hash, err := auth.NewPersonalAccessToken()
+		require.NoError(t, err)
+		_, err = db.CreatePersonalAccessToken(context.Background(), user.ID, "old", hash, []string{"vault:read"}, time.Now().Add(-time.Minute))
+		require.NoError(t, err)
+
+		assert.Equal(t, http.StatusUnauthorized, doJSON(t, client, "GET", ts.URL+"/vault", token, nil, nil))
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		created := create(t, map[string]interface{}{"name": "doomed", "scopes": []string{"vault:read"}})
+		url := ts.URL + "/me/tokens/" + strconv.FormatInt(created.ID, 10)
+
+		// Not visible to someone else
+		assert.Equal(t, http.StatusNotFound, doJSON(t, client, "DELETE", url, tokenB, nil, nil))
+		assert.Equal(t, http.StatusNoContent, doJSON(t, client, "DELETE", url, tokenA, nil, nil))
+		assert.Equal(t, http.StatusNotFound, doJSON(t, client, "DELETE", url, tokenA, nil, nil))
+		assert.Equal(t, http.StatusUnauthorized, doJSON(t, client, "GET", ts.URL+"/vault", created.Token, nil, nil))
+	})
+}
@@ -0,0 +1,229 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bit2swaz/junto/internal/database"
+	"github.com/bit2swaz/junto/internal/handlers"
+	"github.com/bit2swaz/junto/internal/jobs"
+	"github.com/bit2swaz/junto/internal/mailer"
+	"github.com/bit2swaz/junto/internal/middleware"
+	wsInternal "github.com/bit2swaz/junto/internal/websocket"
+	"github.com/coder/websocket"
+	"github.com/coder/websocket/wsjson"
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUnlink(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	keys := setupTestKeys(t, db)
+
+	outbox := mailer.NewOutbox("")
+	authHandler := &handlers.AuthHandler{DB: db, Mailer: outbox, Keys: keys}
+	hub := wsInternal.NewHub(db, keys)
+	coupleHandler := &handlers.CoupleHandler{DB: db, Hub: hub}
+	vaultHandler := &handlers.VaultHandler{DB: db}
+	job := &jobs.CoupleUnlink{DB: db, Hub: hub, Mailer: outbox}
+
+	r := chi.NewRouter()
+	r.Post("/register", authHandler.Register)
+	r.Post("/login", authHandler.Login)
+	r.Get("/ws", hub.HandleWebSocket)
+	r.Group(func(r chi.Router) {
+		r.Use(middleware.AuthMiddleware(db, keys))
+		r.Post("/ws/ticket", hub.IssueTicket)
+		r.Post("/couples/code", coupleHandler.GeneratePairingCode)
+		r.Post("/couples/link", coupleHandler.LinkPartner)
+		r.Post("/couples/requests/{id}/accept", coupleHandler.AcceptPairingRequest)
+		r.Post("/couples/unlink", coupleHandler.RequestUnlink)
+		r.Get("/couples/unlink", coupleHandler.GetUnlink)
+		r.Post("/couples/unlink/cancel", coupleHandler.CancelUnlink)
+		r.Post("/couples/leave", coupleHandler.LeaveCouple)
+		r.Post("/vault", vaultHandler.AddToVault)
+		r.Get("/vault", vaultHandler.GetVaultItems)
+		r.Get("/vault/archive", vaultHandler.GetArchivedVaultItems)
+	})
+
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+	client := ts.Client()
+	wsURL := "ws" + strings.TrimPrefix(ts.URL, "http") + "/ws"
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// pair links two fresh users and opens a socket for each
+	pair := func(t *testing.T, prefix string) (tokenA, tokenB string, connA, connB *websocket.Conn) {
+		for _, who := range []string{"a", "b"} {
+			email := fmt.Sprintf("%s-%s@example.com", prefix, who)
+			registerUser(t, client, ts.URL, email, "password123")
+			verifyEmail(t, db, email)
+		}
+		tokenA = loginUser(t, client, ts.URL, prefix+"-a@example.com", "password123")
+		tokenB = loginUser(t, client, ts.URL, prefix+"-b@example.com", "password123")
+		linkPartner(t, client, ts.URL, tokenA, tokenB, generatePairingCode(t, client, ts.URL, tokenA))
+
+		var err error
+		connA, _, err = websocket.Dial(ctx, wsURL+"?ticket="+wsTicket(t, client, ts.URL, tokenA), nil)
+		require.NoError(t, err)
+		connB, _, err = websocket.Dial(ctx, wsURL+"?ticket="+wsTicket(t, client, ts.URL, tokenB), nil)
+		require.NoError(t, err)
+		return
+	}
+	readType := func(t *testing.T, conn *websocket.Conn) string {
+		var msg map[string]interface{}
+		require.NoError(t, wsjson.Read(ctx, conn, &msg))
+		return msg["type"].(string)
+	}
+	makeDue := func(t *testing.T) {
+		_, err := db.GetPool().Exec(ctx, `UPDATE couples SET unlink_scheduled_at = NOW() - INTERVAL '1 minute' WHERE unlink_scheduled_at IS NOT NULL AND dissolved_at IS NULL`)
+		require.NoError(t, err)
+	}
+
+	t.Run("RequestAndCancel", func(t *testing.T) {
+		tokenA, tokenB, connA, connB := pair(t, "cancel")
+		defer connA.Close(websocket.StatusNormalClosure, "")
+		defer connB.Close(websocket.StatusNormalClosure, "")
+
+		assert.Equal(t, http.StatusBadRequest, doJSON(t, client, "POST", ts.URL+"/couples/unlink", tokenA, map[string]string{"vault_disposition": "shred"}, nil))
+		// Leaving a couple of two would end it, which takes an unlink
+		assert.Equal(t, http.StatusConflict, doJSON(t, client, "POST", ts.URL+"/couples/leave", tokenA, map[string]string{"vault_disposition": "archive"}, nil))
+
+		var status handlers.UnlinkStatus
+		require.Equal(t, http.StatusAccepted, doJSON(t, client, "POST", ts.URL+"/couples/unlink", tokenA, map[string]string{"vault_disposition": "delete"}, &status))
+		assert.WithinDuration(t, time.Now().Add(handlers.UnlinkCoolingOff), status.ScheduledAt, time.Minute)
+		assert.Equal(t, wsInternal.MessageUnlinkRequested, readType(t, connB))
+
+		assert.Equal(t, http.StatusConflict, doJSON(t, client, "POST", ts.URL+"/couples/unlink", tokenB, map[string]string{"vault_disposition": "archive"}, nil))
+		assert.Equal(t, http.StatusOK, doJSON(t, client, "GET", ts.URL+"/couples/unlink", tokenB, nil, nil))
+
+		// The partner can call it off
+		require.Equal(t, http.StatusNoContent, doJSON(t, client, "POST", ts.URL+"/couples/unlink/cancel", tokenB, nil, nil))
+		assert.Equal(t, wsInternal.MessageUnlinkCancelled, readType(t, connA))
+		assert.Equal(t, http.StatusNotFound, doJSON(t, client, "GET", ts.URL+"/couples/unlink", tokenA, nil, nil))
+
+		makeDue(t)
+		n, err := job.RunOnce(ctx)
+		require.NoError(t, err)
+		assert.Zero(t, n)
+		assert.Equal(t, http.StatusOK, doJSON(t, client, "GET", ts.URL+"/vault", tokenA, nil, nil))
+	})
+
+	t.Run("Archive", func(t *testing.T) {
+		tokenA, tokenB, connA, connB := pair(t, "archive")
+		defer connA.Close(websocket.StatusNormalClosure, "")
+		defer connB.Close(websocket.StatusNormalClosure, "")
+		createVaultItem(t, client, ts.URL, tokenA, "keep this", time.Now().Add(-time.Minute))
+		userA, err := db.GetUserByEmail(ctx, "archive-a@example.com")
+		require.NoError(t, err)
+		coupleID := *userA.CoupleID
+
+		require.Equal(t, http.StatusAccepted, doJSON(t, client, "POST", ts.URL+"/couples/unlink", tokenA, map[string]string{"vault_disposition": "archive"}, nil))
+		assert.Equal(t, wsInternal.MessageUnlinkRequested, readType(t, connB))
+
+		makeDue(t)
+		n, err := job.RunOnce(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, 1, n)
+		assert.Equal(t, wsInternal.MessageUnlinked, readType(t, connA))
+		assert.Equal(t, wsInternal.MessageUnlinked, readType(t, connB))
+		assert.NotContains(t, hub.State().Rooms, coupleID)
+
+		assert.Equal(t, http.StatusBadRequest, doJSON(t, client, "GET", ts.URL+"/vault", tokenA, nil, nil))
+		for _, token := range []string{tokenA, tokenB} {
+			var items []database.VaultItem
+			require.Equal(t, http.StatusOK, doJSON(t, client, "GET", ts.URL+"/vault/archive", token, nil, &items))
+			require.Len(t, items, 1)
+			assert.Equal(t, "keep this", items[0].ContentText)
+		}
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		tokenA, tokenB, connA, connB := pair(t, "delete")
+		defer connA.Close(websocket.StatusNormalClosure, "")
+		defer connB.Close(websocket.StatusNormalClosure, "")
+		createVaultItem(t, client, ts.URL, tokenB, "forget this", time.Now().Add(-time.Minute))
+
+		require.Equal(t, http.StatusAccepted, doJSON(t, client, "POST", ts.URL+"/couples/unlink", tokenB, map[string]string{"vault_disposition": "delete"}, nil))
+		makeDue(t)
+		_, err := job.RunOnce(ctx)
+		require.NoError(t, err)
+
+		var items []database.VaultItem
+		require.Equal(t, http.StatusOK, doJSON(t, client, "GET", ts.URL+"/vault/archive", tokenA, nil, &items))
+		assert.Empty(t, items)
+
+		var count int
+		require.NoError(t, db.GetPool().QueryRow(ctx, `SELECT COUNT(*) FROM vault_items WHERE content_text = 'forget this'`).Scan(&count))
+		assert.Zero(t, count)
+	})
+
+	t.Run("Export", func(t *testing.T) {
+		tokenA, tokenB, connA, connB := pair(t, "export")
+		defer connA.Close(websocket.StatusNormalClosure, "")
+		defer connB.Close(websocket.StatusNormalClosure, "")
+		createVaultItem(t, client, ts.URL, tokenA, "a copy of this", time.Now().Add(-time.Minute))
+		createVaultItem(t, client, ts.URL, tokenA, "a secret for later", time.Now().Add(24*time.Hour))
+
+		require.Equal(t, http.StatusAccepted, doJSON(t, client, "POST", ts.URL+"/couples/unlink", tokenB, map[string]string{"vault_disposition": "export"}, nil))
+		makeDue(t)
+
+		// Nothing is deleted while a member has not had their copy
+		flaky := &jobs.CoupleUnlink{DB: db, Hub: hub, Mailer: refusingMailer{outbox, "export-b@example.com"}}
+		n, err := flaky.RunOnce(ctx)
+		require.NoError(t, err)
+		assert.Zero(t, n)
+		var count int
+		require.NoError(t, db.GetPool().QueryRow(ctx, `SELECT COUNT(*) FROM vault_items WHERE content_text = 'a copy of this'`).Scan(&count))
+		assert.Equal(t, 1, count)
+
+		n, err = job.RunOnce(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, 1, n)
+
+		for _, who := range []string{"a", "b"} {
+			msg, ok := outbox.Last("export-" + who + "@example.com")
+			require.True(t, ok, "member %s should get a copy", who)
+			assert.Contains(t, msg.Body, "a copy of this")
+
+			// The retry does not mail those who already had theirs
+			copies := 0
+			for _, m := range outbox.Messages() {
+				if m.To == "export-"+who+"@example.com" && m.Subject == msg.Subject {
+					copies++
+				}
+			}
+			assert.Equal(t, 1, copies, "member %s should get one copy", who)
+		}
+		msg, _ := outbox.Last("export-a@example.com")
+		assert.Contains(t, msg.Body, "a secret for later", "authors get their own locked items")
+		msg, _ = outbox.Last("export-b@example.com")
+		assert.NotContains(t, msg.Body, "a secret for later")
+
+		require.NoError(t, db.GetPool().QueryRow(ctx, `SELECT COUNT(*) FROM vault_items WHERE content_text = 'a copy of this'`).Scan(&count))
+		assert.Zero(t, count)
+	})
+}
+
+// refusingMailer fails every message to one address.
+type refusingMailer struct {
+	mailer.Mailer
+	to string
+}
+
+func (m refusingMailer) Send(ctx context.Context, msg mailer.Message) error {
+	if msg.To == m.to {
+		return errors.New("mailbox unavailable")
+	}
+	return m.Mailer.Send(ctx, msg)
+}
@@ -10,7 +10,9 @@ import (
 
 	"github.com/bit2swaz/junto/internal/database"
 	"github.com/bit2swaz/junto/internal/handlers"
+	"github.com/bit2swaz/junto/internal/mailer"
 	"github.com/bit2swaz/junto/internal/middleware"
+	wsInternal "github.com/bit2swaz/junto/internal/websocket"
 	"github.com/go-chi/chi/v5"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -19,20 +21,22 @@ import (
 func TestVaultLogic(t *testing.T) {
 	db := setupTestDB(t)
 	defer db.Close()
+	keys := setupTestKeys(t, db)
 
 	// Setup router
 	vaultHandler := &handlers.VaultHandler{DB: db}
-	authHandler := &handlers.AuthHandler{DB: db}
-	coupleHandler := &handlers.CoupleHandler{DB: db}
+	authHandler := &handlers.AuthHandler{DB: db, Mailer: mailer.NewOutbox(""), Keys: keys}
+	coupleHandler := &handlers.CoupleHandler{DB: db, Hub: wsInternal.NewHub(db, keys)}
 
 	r := chi.NewRouter()
 	r.Post("/login", authHandler.Login)
 	r.Post("/register", authHandler.Register)
 
 	r.Group(func(r chi.Router) {
-		r.Use(middleware.AuthMiddleware)
-		r.Post("/couples/code", coupleHandler.GeneratePairingCode)
-		r.Post("/couples/link", coupleHandler.LinkPartner)
+		r.Use(middleware.AuthMiddleware(db, keys))
+		r.With(middleware.RequireVerifiedEmail(db)).Post("/couples/code", coupleHandler.GeneratePairingCode)
+		r.With(middleware.RequireVerifiedEmail(db)).Post("/couples/link", coupleHandler.LinkPartner)
+		r.With(middleware.RequireVerifiedEmail(db)).Post("/couples/requests/{id}/accept", coupleHandler.AcceptPairingRequest)
 		r.Post("/vault", vaultHandler.AddToVault)
 		r.Get("/vault", vaultHandler.GetVaultItems)
 	})
@@ -45,15 +49,17 @@ func TestVaultLogic(t *testing.T) {
 	emailA := "alice@example.com"
 	passA := "password"
 	registerUser(t, client, ts.URL, emailA, passA)
+	verifyEmail(t, db, emailA)
 	tokenA := loginUser(t, client, ts.URL, emailA, passA)
 
 	emailB := "bob@example.com"
 	passB := "password"
 	registerUser(t, client, ts.URL, emailB, passB)
+	verifyEmail(t, db, emailB)
 	tokenB := loginUser(t, client, ts.URL, emailB, passB)
 
 	code := generatePairingCode(t, client, ts.URL, tokenA)
-	linkPartner(t, client, ts.URL, tokenB, code)
+	linkPartner(t, client, ts.URL, tokenA, tokenB, code)
 
 	// 2. Test Case 1 (Future): Insert item with unlock_at tomorrow (User A creates)
 	futureContent := "Future Secret"
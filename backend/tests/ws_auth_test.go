@@ -0,0 +1,128 @@
+package tests
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bit2swaz/junto/internal/auth"
+	"github.com/bit2swaz/junto/internal/database"
+	"github.com/bit2swaz/junto/internal/handlers"
+	"github.com/bit2swaz/junto/internal/mailer"
+	"github.com/bit2swaz/junto/internal/middleware"
+	wsInternal "github.com/bit2swaz/junto/internal/websocket"
+	"github.com/coder/websocket"
+	"github.com/coder/websocket/wsjson"
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWebSocketAuthLifetime(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	keys := setupTestKeys(t, db)
+
+	authHandler := &handlers.AuthHandler{DB: db, Mailer: mailer.NewOutbox(""), Keys: keys}
+	hub := wsInternal.NewHub(db, keys)
+	hub.SessionCheckInterval = 100 * time.Millisecond
+
+	r := chi.NewRouter()
+	r.Post("/register", authHandler.Register)
+	r.Post("/login", authHandler.Login)
+	r.Post("/refresh", authHandler.Refresh)
+	r.Get("/ws", hub.HandleWebSocket)
+	r.Group(func(r chi.Router) {
+		r.Use(middleware.AuthMiddleware(db, keys))
+		r.Post("/logout", authHandler.Logout)
+		r.Post("/ws/ticket", hub.IssueTicket)
+	})
+
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+	client := ts.Client()
+	wsURL := "ws" + strings.TrimPrefix(ts.URL, "http") + "/ws"
+
+	email := "socket@example.com"
+	registerUser(t, client, ts.URL, email, "password123")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	dial := func(t *testing.T, ticket string) *websocket.Conn {
+		conn, _, err := websocket.Dial(ctx, fmt.Sprintf("%s?ticket=%s", wsURL, ticket), nil)
+		require.NoError(t, err)
+		return conn
+	}
+
+	t.Run("ReauthInBand", func(t *testing.T) {
+		session := loginSession(t, client, ts.URL, email, "password123")
+		conn := dial(t, expiringTicket(t, db, keys, session.Token, 30*time.Second))
+		defer conn.Close(websocket.StatusNormalClosure, "")
+
+		var msg map[string]interface{}
+		require.NoError(t, wsjson.Read(ctx, conn, &msg))
+		assert.Equal(t, wsInternal.MessageReauthRequired, msg["type"])
+
+		status, refreshed := refreshSession(t, client, ts.URL, session.RefreshToken)
+		require.Equal(t, http.StatusOK, status)
+		require.NoError(t, wsjson.Write(ctx, conn, map[string]string{"type": wsInternal.MessageAuth, "token": refreshed.Token}))
+		require.NoError(t, wsjson.Read(ctx, conn, &msg))
+		assert.Equal(t, wsInternal.MessageAuthOK, msg["type"])
+	})
+
+	t.Run("ReauthWithForeignSession", func(t *testing.T) {
+		a := loginSession(t, client, ts.URL, email, "password123")
+		b := loginSession(t, client, ts.URL, email, "password123")
+
+		conn := dial(t, wsTicket(t, client, ts.URL, a.Token))
+		require.NoError(t, wsjson.Write(ctx, conn, map[string]string{"type": wsInternal.MessageAuth, "token": b.Token}))
+
+		var msg map[string]interface{}
+		err := wsjson.Read(ctx, conn, &msg)
+		assert.Equal(t, websocket.StatusPolicyViolation, websocket.CloseStatus(err))
+	})
+
+	t.Run("ClosedOnRevocation", func(t *testing.T) {
+		session := loginSession(t, client, ts.URL, email, "password123")
+		conn := dial(t, wsTicket(t, client, ts.URL, session.Token))
+
+		require.Equal(t, http.StatusOK, postWithToken(t, client, ts.URL+"/logout", session.Token))
+
+		var msg map[string]interface{}
+		err := wsjson.Read(ctx, conn, &msg)
+		assert.Equal(t, websocket.StatusPolicyViolation, websocket.CloseStatus(err))
+	})
+
+	t.Run("ClosedOnExpiry", func(t *testing.T) {
+		session := loginSession(t, client, ts.URL, email, "password123")
+		conn := dial(t, expiringTicket(t, db, keys, session.Token, 2*time.Second))
+
+		var msg map[string]interface{}
+		require.NoError(t, wsjson.Read(ctx, conn, &msg))
+		assert.Equal(t, wsInternal.MessageReauthRequired, msg["type"])
+
+		err := wsjson.Read(ctx, conn, &msg)
+		assert.Equal(t, websocket.StatusPolicyViolation, websocket.CloseStatus(err))
+	})
+}
+
+// expiringTicket mints a ticket directly, as if the access token it came
+// from expired after ttl.
+func expiringTicket(t *testing.T, db database.Service, keys *auth.KeyManager, token string, ttl time.Duration) string {
+	claims, err := keys.ParseAccessToken(token)
+	require.NoError(t, err)
+
+	ticket, err := auth.RandomToken(32)
+	require.NoError(t, err)
+	require.NoError(t, db.CreateWSTicket(context.Background(), auth.HashToken(ticket), database.WSTicket{
+		UserID:        claims.UserID,
+		SessionID:     claims.SessionID,
+		AuthExpiresAt: time.Now().Add(ttl),
+	}, wsInternal.TicketTTL))
+	return ticket
+}
@@ -0,0 +1,123 @@
+"use client";
+
+import { useCallback, useEffect, useState } from "react";
+import { useRouter } from "next/navigation";
+import { useAuth } from "@/context/AuthContext";
+import { useWebSocket } from "@/context/WebSocketContext";
+
+interface CoupleProfile {
+  display_name: string;
+  anniversary: string | null;
+  relationship_start: string | null;
+  cover_image_url: string;
+  version: number;
+}
+
+export default function CouplePage() {
+  const { user, token, isAuthenticated, isLoading } = useAuth();
+  const { subscribe } = useWebSocket();
+  const router = useRouter();
+  const [profile, setProfile] = useState<CoupleProfile | null>(null);
+  // The ETag of the profile the form was filled from; the server refuses
+  // a save if someone else changed it since
+  const [etag, setEtag] = useState("");
+  const [form, setForm] = useState({ display_name: "", anniversary: "", relationship_start: "", cover_image_url: "" });
+  const [message, setMessage] = useState("");
+
+  const show = useCallback((p: CoupleProfile, tag: string) => {
+    setProfile(p);
+    setEtag(tag);
+    setForm({
+      display_name: p.display_name,
+      anniversary: p.anniversary ?? "",
+      relationship_start: p.relationship_start ?? "",
+      cover_image_url: p.cover_image_url,
+    });
+  }, []);
+
+  const load = useCallback(async () => {
+    if (!token) return;
+    const res = await fetch("http://localhost:8080/couples/profile", {
+      headers: { Authorization: `Bearer ${token}` },
+    });
+    if (res.ok) show(await res.json(), res.headers.get("ETag") ?? "");
+  }, [token, show]);
+
+  useEffect(() => {
+    if (!isLoading && !isAuthenticated) router.push("/login");
+  }, [isLoading, isAuthenticated, router]);
+
+  useEffect(() => {
+    if (user?.couple_id) load();
+  }, [user?.couple_id, load]);
+
+  useEffect(() => {
+    const unsubscribe = subscribe((msg) => {
+      if (msg.type === "COUPLE_PROFILE_UPDATED") {
+        show(msg.profile, `"${msg.profile.version}"`);
+        setMessage("Your partner updated the profile");
+      }
+    });
+    return unsubscribe;
+  }, [subscribe, show]);
+
+  const save = async () => {
+    const res = await fetch("http://localhost:8080/couples/profile", {
+      method: "PATCH",
+      headers: {
+        "Content-Type": "application/json",
+        "If-Match": etag,
+        Authorization: `Bearer ${token}`,
+      },
+      body: JSON.stringify(form),
+    });
+    if (res.status === 412) {
+      await load();
+      setMessage("Your partner changed the profile while you were editing. Check their changes and save again.");
+      return;
+    }
+    const data = await res.json();
+    if (!res.ok) {
+      setMessage(data.errors?.[0] ? `${data.errors[0].field} ${data.errors[0].message}` : data.detail ?? "Failed to save");
+      return;
+    }
+    show(data, res.headers.get("ETag") ?? "");
+    setMessage("Saved");
+  };
+
+  if (!user) return <div>Loading...</div>;
+  if (!user.couple_id) return <div className="p-4">Pair with your partner to set up your couple profile.</div>;
+  if (!profile) return <div className="p-4">Loading...</div>;
+
+  const field = (name: keyof typeof form, label: string, type = "text") => (
+    <label className="block">
+      <span className="text-sm text-gray-600">{label}</span>
+      <input
+        type={type}
+        value={form[name]}
+        onChange={(e) => setForm({ ...form, [name]: e.target.value })}
+        className="w-full p-2 border rounded"
+      />
+    </label>
+  );
+
+  return (
+    <div className="p-4 pb-24 max-w-md mx-auto space-y-4">
+      {profile.cover_image_url && (
+        // eslint-disable-next-line @next/next/no-img-element
+        <img src={profile.cover_image_url} alt="" className="w-full h-40 object-cover rounded-lg" />
+      )}
+      <h1 className="text-2xl font-bold">{profile.display_name || "Our profile"}</h1>
+      <div className="bg-white p-6 rounded-lg shadow space-y-4">
+        {field("display_name", "Name")}
+        {field("anniversary", "Anniversary", "date")}
+        {field("relationship_start", "Together since", "date")}
+        {field("cover_image_url", "Cover image URL", "url")}
+        <button onClick={save} className="w-full py-2 px-4 bg-indigo-600 text-white rounded hover:bg-indigo-700">
+          Save
+        </button>
+        {message && <p className="text-gray-600">{message}</p>}
+      </div>
+    </div>
+  );
+}
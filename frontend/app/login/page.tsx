@@ -8,6 +8,8 @@ export default function LoginPage() {
   const [email, setEmail] = useState("");
   const [password, setPassword] = useState("");
   const [error, setError] = useState("");
+  const [mfaToken, setMfaToken] = useState("");
+  const [code, setCode] = useState("");
   const { login } = useAuth();
 
   const handleSubmit = async (e: React.FormEvent) => {
@@ -26,12 +28,72 @@ export default function LoginPage() {
       }
 
       const data = await res.json();
-      login(data.token);
+      if (data.mfa_required) {
+        setMfaToken(data.mfa_token);
+        return;
+      }
+      login(data.token, data.refresh_token);
     } catch {
       setError("Invalid email or password");
     }
   };
 
+  // Second step for accounts with two-factor enabled. Codes with a dash are
+  // treated as recovery codes.
+  const handleMfaSubmit = async (e: React.FormEvent) => {
+    e.preventDefault();
+    setError("");
+
+    const isRecovery = code.includes("-");
+    try {
+      const res = await fetch(`http://localhost:8080/login/mfa/${isRecovery ? "recovery" : "totp"}`, {
+        method: "POST",
+        headers: { "Content-Type": "application/json" },
+        body: JSON.stringify(isRecovery ? { mfa_token: mfaToken, recovery_code: code } : { mfa_token: mfaToken, code }),
+      });
+
+      if (!res.ok) {
+        throw new Error("Verification failed");
+      }
+
+      const data = await res.json();
+      login(data.token, data.refresh_token);
+    } catch {
+      setError("Invalid code");
+    }
+  };
+
+  if (mfaToken) {
+    return (
+      <div className="flex flex-col items-center justify-center min-h-screen p-4">
+        <div className="w-full max-w-md bg-white p-8 rounded-lg shadow-md">
+          <h1 className="text-2xl font-bold mb-6 text-center">Two-factor authentication</h1>
+          {error && <p className="text-red-500 mb-4 text-center">{error}</p>}
+          <form onSubmit={handleMfaSubmit} className="space-y-4">
+            <div>
+              <label className="block text-sm font-medium text-gray-700">Authenticator or recovery code</label>
+              <input
+                type="text"
+                inputMode="text"
+                autoComplete="one-time-code"
+                value={code}
+                onChange={(e) => setCode(e.target.value)}
+                className="mt-1 block w-full rounded-md border-gray-300 shadow-sm focus:border-indigo-500 focus:ring-indigo-500 sm:text-sm p-2 border"
+                required
+              />
+            </div>
+            <button
+              type="submit"
+              className="w-full flex justify-center py-2 px-4 border border-transparent rounded-md shadow-sm text-sm font-medium text-white bg-indigo-600 hover:bg-indigo-700 focus:outline-none focus:ring-2 focus:ring-offset-2 focus:ring-indigo-500"
+            >
+              Verify
+            </button>
+          </form>
+        </div>
+      </div>
+    );
+  }
+
   return (
     <div className="flex flex-col items-center justify-center min-h-screen p-4">
       <div className="w-full max-w-md bg-white p-8 rounded-lg shadow-md">
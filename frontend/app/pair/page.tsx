@@ -0,0 +1,63 @@
+"use client";
+
+import { Suspense, useEffect, useRef, useState } from "react";
+import { useRouter, useSearchParams } from "next/navigation";
+import Link from "next/link";
+import { useAuth } from "@/context/AuthContext";
+
+function Pair() {
+  const searchParams = useSearchParams();
+  const inviteToken = searchParams.get("token");
+  const { token, isAuthenticated, isLoading } = useAuth();
+  const router = useRouter();
+  const [status, setStatus] = useState<"pending" | "ok" | "error">("pending");
+  // Invites are single-use; don't redeem twice if the effect re-runs
+  const redeemed = useRef(false);
+
+  useEffect(() => {
+    if (isLoading) return;
+    if (!isAuthenticated) {
+      router.push("/login");
+      return;
+    }
+    if (!inviteToken) {
+      setStatus("error");
+      return;
+    }
+    if (redeemed.current) return;
+    redeemed.current = true;
+
+    fetch("http://localhost:8080/couples/link", {
+      method: "POST",
+      headers: {
+        "Content-Type": "application/json",
+        Authorization: `Bearer ${token}`,
+      },
+      body: JSON.stringify({ token: inviteToken }),
+    })
+      .then((res) => setStatus(res.ok ? "ok" : "error"))
+      .catch(() => setStatus("error"));
+  }, [inviteToken, token, isAuthenticated, isLoading, router]);
+
+  return (
+    <div className="flex flex-col items-center justify-center min-h-screen p-4">
+      <div className="w-full max-w-md bg-white p-8 rounded-lg shadow-md text-center">
+        <h1 className="text-2xl font-bold mb-6">Pair with your partner</h1>
+        {status === "pending" && <p className="text-gray-600">Sending request...</p>}
+        {status === "ok" && <p className="text-green-600">Request sent. You&apos;ll be linked once your partner accepts.</p>}
+        {status === "error" && <p className="text-red-500">This invite is invalid or has expired.</p>}
+        <Link href="/" className="mt-4 inline-block text-indigo-600 hover:text-indigo-500">
+          Back to Junto
+        </Link>
+      </div>
+    </div>
+  );
+}
+
+export default function PairPage() {
+  return (
+    <Suspense>
+      <Pair />
+    </Suspense>
+  );
+}
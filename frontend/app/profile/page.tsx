@@ -0,0 +1,169 @@
+"use client";
+
+import { useEffect, useState } from "react";
+import { useRouter } from "next/navigation";
+import { AvatarConfig, useAuth } from "@/context/AuthContext";
+
+// Keep in sync with the choices in backend/internal/avatar
+const bodies = ["round", "square", "tall", "bean"];
+const expressions = ["happy", "grin", "calm", "surprised", "sleepy", "wink"];
+const accessories = ["glasses", "hat", "bow", "scarf", "headphones"];
+const maxAccessories = 3;
+
+const defaultAvatar: AvatarConfig = {
+  version: 1,
+  body: "round",
+  colors: { body: "#ffb3c1", accent: "#3a86ff", background: "#fefae0" },
+  accessories: [],
+  expression: "happy",
+};
+
+interface Profile {
+  display_name: string;
+  pronouns: string;
+  timezone: string;
+  avatar_config: AvatarConfig | null;
+}
+
+export default function ProfilePage() {
+  const { token, isAuthenticated, isLoading, refreshUser } = useAuth();
+  const router = useRouter();
+  const [profile, setProfile] = useState<Profile | null>(null);
+  const [avatar, setAvatar] = useState<AvatarConfig>(defaultAvatar);
+  const [message, setMessage] = useState("");
+
+  useEffect(() => {
+    if (!isLoading && !isAuthenticated) router.push("/login");
+  }, [isLoading, isAuthenticated, router]);
+
+  useEffect(() => {
+    if (!token) return;
+    fetch("http://localhost:8080/me/profile", {
+      headers: { Authorization: `Bearer ${token}` },
+    })
+      .then((res) => (res.ok ? res.json() : null))
+      .then((p: Profile | null) => {
+        if (!p) return;
+        setProfile(p);
+        if (p.avatar_config) setAvatar(p.avatar_config);
+      })
+      .catch(() => setMessage("Failed to load your profile"));
+  }, [token]);
+
+  const save = async () => {
+    if (!profile) return;
+    const res = await fetch("http://localhost:8080/me/profile", {
+      method: "PATCH",
+      headers: {
+        "Content-Type": "application/json",
+        Authorization: `Bearer ${token}`,
+      },
+      body: JSON.stringify({
+        display_name: profile.display_name,
+        pronouns: profile.pronouns,
+        timezone: profile.timezone,
+        avatar_config: avatar,
+      }),
+    });
+    const data = await res.json();
+    if (!res.ok) {
+      setMessage(data.errors?.[0] ? `${data.errors[0].field} ${data.errors[0].message}` : data.detail ?? "Failed to save");
+      return;
+    }
+    setProfile(data);
+    setMessage("Saved");
+    await refreshUser(); // The room draws us from our avatar
+  };
+
+  const toggleAccessory = (a: string) => {
+    const worn = avatar.accessories.includes(a);
+    if (!worn && avatar.accessories.length >= maxAccessories) return;
+    setAvatar({
+      ...avatar,
+      accessories: worn ? avatar.accessories.filter((x) => x !== a) : [...avatar.accessories, a],
+    });
+  };
+
+  if (!profile) return <div className="p-4">Loading...</div>;
+
+  return (
+    <div className="p-4 pb-24 max-w-md mx-auto space-y-4">
+      <h1 className="text-2xl font-bold">Your profile</h1>
+      <div className="bg-white p-6 rounded-lg shadow space-y-4">
+        <label className="block">
+          <span className="text-sm text-gray-600">Name</span>
+          <input
+            value={profile.display_name}
+            onChange={(e) => setProfile({ ...profile, display_name: e.target.value })}
+            className="w-full p-2 border rounded"
+          />
+        </label>
+        <label className="block">
+          <span className="text-sm text-gray-600">Pronouns</span>
+          <input
+            value={profile.pronouns}
+            onChange={(e) => setProfile({ ...profile, pronouns: e.target.value })}
+            className="w-full p-2 border rounded"
+            placeholder="e.g. they/them"
+          />
+        </label>
+        <label className="block">
+          <span className="text-sm text-gray-600">Time zone</span>
+          <div className="flex gap-2">
+            <input
+              value={profile.timezone}
+              onChange={(e) => setProfile({ ...profile, timezone: e.target.value })}
+              className="flex-1 p-2 border rounded"
+            />
+            <button
+              onClick={() => setProfile({ ...profile, timezone: Intl.DateTimeFormat().resolvedOptions().timeZone })}
+              className="px-3 bg-gray-200 rounded hover:bg-gray-300"
+            >
+              Use mine
+            </button>
+          </div>
+        </label>
+      </div>
+
+      <div className="bg-white p-6 rounded-lg shadow space-y-4">
+        <h2 className="text-lg font-semibold">Avatar</h2>
+        <div className="flex gap-2">
+          <select value={avatar.body} onChange={(e) => setAvatar({ ...avatar, body: e.target.value })} className="flex-1 p-2 border rounded">
+            {bodies.map((b) => <option key={b}>{b}</option>)}
+          </select>
+          <select value={avatar.expression} onChange={(e) => setAvatar({ ...avatar, expression: e.target.value })} className="flex-1 p-2 border rounded">
+            {expressions.map((x) => <option key={x}>{x}</option>)}
+          </select>
+        </div>
+        <div className="flex gap-4">
+          {(["body", "accent", "background"] as const).map((c) => (
+            <label key={c} className="flex items-center gap-2 text-sm text-gray-600">
+              <input
+                type="color"
+                value={avatar.colors[c]}
+                onChange={(e) => setAvatar({ ...avatar, colors: { ...avatar.colors, [c]: e.target.value } })}
+              />
+              {c}
+            </label>
+          ))}
+        </div>
+        <div className="flex flex-wrap gap-2">
+          {accessories.map((a) => (
+            <button
+              key={a}
+              onClick={() => toggleAccessory(a)}
+              className={`px-3 py-1 rounded-full text-sm ${avatar.accessories.includes(a) ? "bg-indigo-600 text-white" : "bg-gray-200"}`}
+            >
+              {a}
+            </button>
+          ))}
+        </div>
+      </div>
+
+      <button onClick={save} className="w-full py-2 px-4 bg-indigo-600 text-white rounded hover:bg-indigo-700">
+        Save
+      </button>
+      {message && <p className="text-gray-600">{message}</p>}
+    </div>
+  );
+}
@@ -38,7 +38,7 @@ export default function RegisterPage() {
       }
 
       const data = await loginRes.json();
-      login(data.token);
+      login(data.token, data.refresh_token);
     } catch {
       setError("Registration failed. Email might be taken.");
     }
@@ -0,0 +1,47 @@
+"use client";
+
+import { Suspense, useEffect, useState } from "react";
+import { useSearchParams } from "next/navigation";
+import Link from "next/link";
+
+function VerifyEmail() {
+  const searchParams = useSearchParams();
+  const token = searchParams.get("token");
+  const [status, setStatus] = useState<"pending" | "ok" | "error">("pending");
+
+  useEffect(() => {
+    if (!token) {
+      setStatus("error");
+      return;
+    }
+    fetch("http://localhost:8080/verify-email", {
+      method: "POST",
+      headers: { "Content-Type": "application/json" },
+      body: JSON.stringify({ token }),
+    })
+      .then((res) => setStatus(res.ok ? "ok" : "error"))
+      .catch(() => setStatus("error"));
+  }, [token]);
+
+  return (
+    <div className="flex flex-col items-center justify-center min-h-screen p-4">
+      <div className="w-full max-w-md bg-white p-8 rounded-lg shadow-md text-center">
+        <h1 className="text-2xl font-bold mb-6">Confirm your email</h1>
+        {status === "pending" && <p className="text-gray-600">Verifying...</p>}
+        {status === "ok" && <p className="text-green-600">Your email is confirmed. You can now pair with your partner.</p>}
+        {status === "error" && <p className="text-red-500">This link is invalid or has expired.</p>}
+        <Link href="/" className="mt-4 inline-block text-indigo-600 hover:text-indigo-500">
+          Back to Junto
+        </Link>
+      </div>
+    </div>
+  );
+}
+
+export default function VerifyEmailPage() {
+  return (
+    <Suspense>
+      <VerifyEmail />
+    </Suspense>
+  );
+}
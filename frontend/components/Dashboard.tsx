@@ -1,15 +1,54 @@
 "use client";
 
-import { useState } from "react";
+import { useCallback, useEffect, useState } from "react";
 import { useAuth } from "@/context/AuthContext";
+import { useWebSocket } from "@/context/WebSocketContext";
 import RoomCanvas from "./RoomCanvas";
 import Vault from "./Vault";
 
 export default function Dashboard() {
   const { user, token, refreshUser } = useAuth();
   const [pairingCode, setPairingCode] = useState("");
+  const [inviteURL, setInviteURL] = useState("");
+  const [qrURL, setQrURL] = useState("");
   const [partnerCode, setPartnerCode] = useState("");
   const [error, setError] = useState("");
+  // Requests we sent that are waiting on the code owner, and requests
+  // from people who redeemed our code
+  const [requests, setRequests] = useState<PairingRequest[]>([]);
+  const { subscribe } = useWebSocket();
+
+  const loadRequests = useCallback(async () => {
+    if (!token) return;
+    try {
+      const res = await fetch("http://localhost:8080/couples/requests", {
+        headers: { Authorization: `Bearer ${token}` },
+      });
+      if (res.ok) setRequests(await res.json());
+    } catch {
+      // The list is refreshed on every pairing event; try again then
+    }
+  }, [token]);
+
+  useEffect(() => {
+    loadRequests();
+  }, [user?.couple_id, loadRequests]);
+
+  useEffect(() => {
+    const unsubscribe = subscribe((msg) => {
+      if (msg.type === "PAIRING_REQUESTED") {
+        loadRequests();
+      } else if (msg.type === "PARTNER_LINKED") {
+        // Our socket is already in the room; just pick up couple_id
+        refreshUser();
+        loadRequests();
+      } else if (msg.type === "PAIRING_REJECTED") {
+        setError("Your partner declined the request");
+        loadRequests();
+      }
+    });
+    return unsubscribe;
+  }, [subscribe, loadRequests, refreshUser]);
 
   const generateCode = async () => {
     try {
@@ -18,7 +57,21 @@ export default function Dashboard() {
         headers: { Authorization: `Bearer ${token}` },
       });
       const data = await res.json();
+      if (!res.ok) {
+        setError(data.detail ?? "Failed to generate code");
+        return;
+      }
       setPairingCode(data.code);
+      setInviteURL(data.invite_url);
+
+      // The QR endpoint needs our token, so it can't be an <img> src as is
+      const qr = await fetch("http://localhost:8080/couples/invite/qr.svg", {
+        headers: { Authorization: `Bearer ${token}` },
+      });
+      if (qr.ok) {
+        if (qrURL) URL.revokeObjectURL(qrURL);
+        setQrURL(URL.createObjectURL(await qr.blob()));
+      }
     } catch {
       setError("Failed to generate code");
     }
@@ -35,22 +88,113 @@ export default function Dashboard() {
         body: JSON.stringify({ code: partnerCode }),
       });
       if (!res.ok) throw new Error("Failed to link");
-      
-      await refreshUser(); // Refresh to get couple_id
+
+      // The code's owner has to accept before we are linked
+      setPartnerCode("");
+      setError("");
+      await loadRequests();
     } catch {
       setError("Failed to link partner");
     }
   };
 
+  const respond = async (id: number, answer: "accept" | "reject") => {
+    try {
+      const res = await fetch(`http://localhost:8080/couples/requests/${id}/${answer}`, {
+        method: "POST",
+        headers: { Authorization: `Bearer ${token}` },
+      });
+      if (!res.ok) throw new Error(`Failed to ${answer}`);
+
+      if (answer === "accept") {
+        await refreshUser(); // Refresh to get couple_id
+      } else {
+        await loadRequests();
+      }
+    } catch {
+      setError(`Failed to ${answer} request`);
+    }
+  };
+
   if (!user) return <div>Loading...</div>;
 
+  const incoming = requests.filter((r) => r.owner_id === user.id);
+  const outgoing = requests.filter((r) => r.requester_id === user.id);
+
+  const incomingCards = (
+    <>
+      {incoming.map((r) => (
+        <div key={r.id} className="bg-white p-6 rounded-lg shadow">
+          <h2 className="text-lg font-semibold mb-4">{r.requester_email} wants to pair with you</h2>
+          <div className="flex gap-2">
+            <button
+              onClick={() => respond(r.id, "accept")}
+              className="flex-1 py-2 px-4 bg-green-600 text-white rounded hover:bg-green-700"
+            >
+              Accept
+            </button>
+            <button
+              onClick={() => respond(r.id, "reject")}
+              className="flex-1 py-2 px-4 bg-gray-200 rounded hover:bg-gray-300"
+            >
+              Reject
+            </button>
+          </div>
+        </div>
+      ))}
+    </>
+  );
+
+  const inviteCard = (
+    <div className="bg-white p-6 rounded-lg shadow">
+      <h2 className="text-lg font-semibold mb-4">Your Pairing Code</h2>
+      {pairingCode ? (
+        <div className="space-y-4">
+          <div className="text-3xl font-mono text-center py-4 bg-gray-100 rounded">
+            {pairingCode}
+          </div>
+          {qrURL && (
+            // eslint-disable-next-line @next/next/no-img-element
+            <img src={qrURL} alt="Pairing QR code" className="mx-auto w-48 h-48" />
+          )}
+          {inviteURL && (
+            <input
+              type="text"
+              readOnly
+              value={inviteURL}
+              onFocus={(e) => e.target.select()}
+              className="w-full p-2 border rounded text-sm text-gray-600"
+            />
+          )}
+          <button
+            onClick={generateCode}
+            className="w-full py-2 px-4 bg-gray-200 rounded hover:bg-gray-300"
+          >
+            New Code
+          </button>
+        </div>
+      ) : (
+        <button
+          onClick={generateCode}
+          className="w-full py-2 px-4 bg-indigo-600 text-white rounded hover:bg-indigo-700"
+        >
+          Generate Code
+        </button>
+      )}
+    </div>
+  );
+
   if (user.couple_id) {
     return (
       <div className="h-[calc(100vh-100px)] flex flex-col md:flex-row gap-4 p-4">
         <div className="flex-1 flex items-center justify-center bg-gray-50 rounded-lg">
           <RoomCanvas />
         </div>
-        <div className="w-full md:w-96">
+        <div className="w-full md:w-96 space-y-4">
+          {incomingCards}
+          {/* Owners can bring more people into the pod */}
+          {inviteCard}
+          {error && <p className="text-red-500">{error}</p>}
           <Vault />
         </div>
       </div>
@@ -61,21 +205,9 @@ export default function Dashboard() {
     <div className="p-4 space-y-6">
       <h1 className="text-2xl font-bold">Connect with your Partner</h1>
       
-      <div className="bg-white p-6 rounded-lg shadow">
-        <h2 className="text-lg font-semibold mb-4">Your Pairing Code</h2>
-        {pairingCode ? (
-          <div className="text-3xl font-mono text-center py-4 bg-gray-100 rounded">
-            {pairingCode}
-          </div>
-        ) : (
-          <button
-            onClick={generateCode}
-            className="w-full py-2 px-4 bg-indigo-600 text-white rounded hover:bg-indigo-700"
-          >
-            Generate Code
-          </button>
-        )}
-      </div>
+      {incomingCards}
+
+      {inviteCard}
 
       <div className="bg-white p-6 rounded-lg shadow">
         <h2 className="text-lg font-semibold mb-4">Enter Partner&apos;s Code</h2>
@@ -94,8 +226,22 @@ export default function Dashboard() {
             Link Partner
           </button>
         </div>
+        {outgoing.map((r) => (
+          <p key={r.id} className="text-gray-600 mt-2">
+            Waiting for {r.owner_email} to accept your request
+          </p>
+        ))}
         {error && <p className="text-red-500 mt-2">{error}</p>}
       </div>
     </div>
   );
 }
+
+interface PairingRequest {
+  id: number;
+  owner_id: number;
+  owner_email: string;
+  requester_id: number;
+  requester_email: string;
+  expires_at: string;
+}
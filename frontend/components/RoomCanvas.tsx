@@ -1,16 +1,45 @@
 "use client";
 
-import { useEffect, useRef, useState, useMemo } from 'react';
+import { useCallback, useEffect, useRef, useState, useMemo } from 'react';
 import { useWebSocket } from '@/context/WebSocketContext';
+import { useAuth } from '@/context/AuthContext';
 import throttle from 'lodash/throttle';
 
 export default function RoomCanvas() {
   const canvasRef = useRef<HTMLCanvasElement>(null);
   const playerPos = useRef({ x: 150, y: 150 });
-  const partnerPos = useRef<{ x: number; y: number } | null>(null);
-  const displayedPartnerPos = useRef<{ x: number; y: number } | null>(null);
+  // Keyed by user ID; a room can hold more than one partner
+  const partnerPos = useRef<Map<number, { x: number; y: number }>>(new Map());
+  const displayedPartnerPos = useRef<Map<number, { x: number; y: number }>>(new Map());
+  // Everyone's avatar, drawn by the server, keyed by user ID
+  const avatars = useRef<Map<number, HTMLImageElement>>(new Map());
   
   const { sendMessage, isConnected, subscribe } = useWebSocket();
+  const { user, token } = useAuth();
+  const userID = useRef<number | undefined>(undefined);
+  useEffect(() => {
+    userID.current = user?.id;
+  }, [user?.id]);
+
+  // The avatar needs our token, so it can't be an image src as is
+  const loadAvatar = useCallback(async (id: number) => {
+    if (!token) return;
+    const res = await fetch(`http://localhost:8080/users/${id}/avatar.svg?size=40`, {
+      headers: { Authorization: `Bearer ${token}` },
+    });
+    if (!res.ok) return;
+    // Keep drawing the old one until the new one is ready
+    const img = new Image();
+    img.onload = () => {
+      avatars.current.set(id, img);
+      URL.revokeObjectURL(img.src);
+    };
+    img.src = URL.createObjectURL(await res.blob());
+  }, [token]);
+
+  useEffect(() => {
+    if (user) loadAvatar(user.id);
+  }, [user, loadAvatar]);
   
   // Joystick state
   const joystickRef = useRef<HTMLDivElement>(null);
@@ -20,7 +49,8 @@ export default function RoomCanvas() {
   const speed = 2;
 
   // Touch/Haptic state
-  const [isPartnerTouching, setIsPartnerTouching] = useState(false);
+  const [touchingPartners, setTouchingPartners] = useState<Set<number>>(new Set());
+  const isPartnerTouching = touchingPartners.size > 0;
 
   // Throttle sending updates to 30 times per second (~33ms)
   const sendMoveUpdate = useMemo(
@@ -35,18 +65,25 @@ export default function RoomCanvas() {
   useEffect(() => {
     const unsubscribe = subscribe((msg) => {
       if (msg.type === 'move') {
-        partnerPos.current = { x: msg.x, y: msg.y };
-        if (!displayedPartnerPos.current) {
-          displayedPartnerPos.current = { x: msg.x, y: msg.y };
+        partnerPos.current.set(msg.from, { x: msg.x, y: msg.y });
+        if (!displayedPartnerPos.current.has(msg.from)) {
+          displayedPartnerPos.current.set(msg.from, { x: msg.x, y: msg.y });
+          loadAvatar(msg.from);
         }
+      } else if (msg.type === 'AVATAR_UPDATED') {
+        loadAvatar(msg.partner.id);
       } else if (msg.type === 'TOUCH_START') {
-        setIsPartnerTouching(true);
+        setTouchingPartners((prev) => new Set(prev).add(msg.from));
       } else if (msg.type === 'TOUCH_END') {
-        setIsPartnerTouching(false);
+        setTouchingPartners((prev) => {
+          const next = new Set(prev);
+          next.delete(msg.from);
+          return next;
+        });
       }
     });
     return unsubscribe;
-  }, [subscribe]);
+  }, [subscribe, loadAvatar]);
 
   // Haptic feedback loop
   useEffect(() => {
@@ -99,18 +136,29 @@ export default function RoomCanvas() {
       // Clear canvas
       ctx.clearRect(0, 0, canvas.width, canvas.height);
 
-      // Draw partner (blue square) with Lerp
-      if (partnerPos.current && displayedPartnerPos.current) {
-        displayedPartnerPos.current.x = lerp(displayedPartnerPos.current.x, partnerPos.current.x, 0.1);
-        displayedPartnerPos.current.y = lerp(displayedPartnerPos.current.y, partnerPos.current.y, 0.1);
-        
-        ctx.fillStyle = 'blue';
-        ctx.fillRect(displayedPartnerPos.current.x, displayedPartnerPos.current.y, 20, 20);
-      }
+      // Everyone is a square until their avatar has loaded
+      const draw = (id: number | undefined, x: number, y: number, fallback: string) => {
+        const img = id === undefined ? undefined : avatars.current.get(id);
+        if (img) {
+          ctx.drawImage(img, x, y, 20, 20);
+        } else {
+          ctx.fillStyle = fallback;
+          ctx.fillRect(x, y, 20, 20);
+        }
+      };
+
+      // Draw partners with Lerp
+      partnerPos.current.forEach((target, id) => {
+        const displayed = displayedPartnerPos.current.get(id);
+        if (!displayed) return;
+        displayed.x = lerp(displayed.x, target.x, 0.1);
+        displayed.y = lerp(displayed.y, target.y, 0.1);
+
+        draw(id, displayed.x, displayed.y, 'blue');
+      });
 
-      // Draw player (red square)
-      ctx.fillStyle = 'red';
-      ctx.fillRect(playerPos.current.x, playerPos.current.y, 20, 20);
+      // Draw player
+      draw(userID.current, playerPos.current.x, playerPos.current.y, 'red');
 
       animationFrameId = requestAnimationFrame(render);
     };
@@ -7,13 +7,23 @@ import { useRouter } from "next/navigation";
 interface User {
   id: number;
   email: string;
+  display_name: string;
   couple_id?: number;
+  avatar_config: AvatarConfig | null;
+}
+
+export interface AvatarConfig {
+  version: number;
+  body: string;
+  colors: { body: string; accent: string; background: string };
+  accessories: string[];
+  expression: string;
 }
 
 interface AuthContextType {
   token: string | null;
   user: User | null;
-  login: (token: string) => void;
+  login: (token: string, refreshToken: string) => void;
   logout: () => void;
   isAuthenticated: boolean;
   isLoading: boolean;
@@ -29,12 +39,42 @@ export function AuthProvider({ children }: { children: React.ReactNode }) {
   const router = useRouter();
 
   const logout = () => {
+    const currentToken = localStorage.getItem("token");
+    if (currentToken) {
+      fetch("http://localhost:8080/logout", {
+        method: "POST",
+        headers: { Authorization: `Bearer ${currentToken}` },
+      }).catch(() => {});
+    }
     localStorage.removeItem("token");
+    localStorage.removeItem("refresh_token");
     setToken(null);
     setUser(null);
     router.push("/login");
   };
 
+  // Access tokens are short-lived; swap the refresh token for a new pair.
+  const refreshSession = async (): Promise<string | null> => {
+    const refreshToken = localStorage.getItem("refresh_token");
+    if (!refreshToken) return null;
+    try {
+      const res = await fetch("http://localhost:8080/refresh", {
+        method: "POST",
+        headers: { "Content-Type": "application/json" },
+        body: JSON.stringify({ refresh_token: refreshToken }),
+      });
+      if (!res.ok) return null;
+      const data = await res.json();
+      localStorage.setItem("token", data.token);
+      localStorage.setItem("refresh_token", data.refresh_token);
+      setToken(data.token);
+      return data.token;
+    } catch (err) {
+      console.error(err);
+      return null;
+    }
+  };
+
   const fetchUser = async (authToken: string) => {
     try {
       const res = await fetch("http://localhost:8080/me", {
@@ -43,7 +83,14 @@ export function AuthProvider({ children }: { children: React.ReactNode }) {
       if (res.ok) {
         const userData = await res.json();
         setUser(userData);
-      } else if (res.status === 401 || res.status === 404) {
+      } else if (res.status === 401) {
+        const refreshed = await refreshSession();
+        if (refreshed) {
+          await fetchUser(refreshed);
+        } else {
+          logout();
+        }
+      } else if (res.status === 404) {
         logout();
       }
     } catch (err) {
@@ -61,8 +108,15 @@ export function AuthProvider({ children }: { children: React.ReactNode }) {
     }
   }, []);
 
-  const login = (newToken: string) => {
+  useEffect(() => {
+    if (!token) return;
+    const interval = setInterval(refreshSession, 10 * 60 * 1000);
+    return () => clearInterval(interval);
+  }, [token]);
+
+  const login = (newToken: string, refreshToken: string) => {
     localStorage.setItem("token", newToken);
+    localStorage.setItem("refresh_token", refreshToken);
     setToken(newToken);
     fetchUser(newToken);
     router.push("/");
@@ -37,8 +37,27 @@ export const WebSocketProvider = ({ children }: { children: React.ReactNode }) =
       return;
     }
 
-    const connect = () => {
-      const wsUrl = `ws://localhost:8080/ws?token=${token}`;
+    let cancelled = false;
+
+    // Each connect needs a fresh single-use ticket; the access token itself
+    // never goes in the URL.
+    const connect = async () => {
+      let ticket: string;
+      try {
+        const res = await fetch("http://localhost:8080/ws/ticket", {
+          method: "POST",
+          headers: { Authorization: `Bearer ${localStorage.getItem('token')}` },
+        });
+        if (!res.ok) throw new Error(`ticket request failed: ${res.status}`);
+        ticket = (await res.json()).ticket;
+      } catch (e) {
+        console.error('Failed to get WS ticket', e);
+        if (!cancelled) reconnectTimeoutRef.current = setTimeout(connect, 3000);
+        return;
+      }
+      if (cancelled) return;
+
+      const wsUrl = `ws://localhost:8080/ws?ticket=${encodeURIComponent(ticket)}`;
       const ws = new WebSocket(wsUrl);
 
       ws.onopen = () => {
@@ -50,7 +69,7 @@ export const WebSocketProvider = ({ children }: { children: React.ReactNode }) =
         console.log('WebSocket Disconnected');
         setIsConnected(false);
         // Reconnect logic
-        reconnectTimeoutRef.current = setTimeout(connect, 3000);
+        if (!cancelled) reconnectTimeoutRef.current = setTimeout(connect, 3000);
       };
 
       ws.onerror = (err) => {
@@ -61,6 +80,13 @@ export const WebSocketProvider = ({ children }: { children: React.ReactNode }) =
       ws.onmessage = (event) => {
         try {
           const data = JSON.parse(event.data);
+          // The socket outlives the access token it was opened with; hand
+          // the server the current one before it expires.
+          if (data.type === 'REAUTH_REQUIRED') {
+            ws.send(JSON.stringify({ type: 'AUTH', token: localStorage.getItem('token') }));
+            return;
+          }
+          if (data.type === 'AUTH_OK') return;
           // Notify subscribers
           subscribersRef.current.forEach(handler => handler(data));
         } catch (e) {
@@ -74,6 +100,7 @@ export const WebSocketProvider = ({ children }: { children: React.ReactNode }) =
     connect();
 
     return () => {
+      cancelled = true;
       if (wsRef.current) {
         wsRef.current.close();
       }